@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"grpc/internal/config"
+	appdb "grpc/internal/database/app"
+	mfadb "grpc/internal/database/mfa"
+	"grpc/internal/database/postgresql"
+	"grpc/internal/lib/envelope"
+	"grpc/internal/logger"
+)
+
+// Re-encrypts the secrets of all app keys and TOTP authenticators with the
+// current master key, the first one configured. Run it after adding a new
+// master key in front of the old ones; the old keys can be removed once it
+// has finished.
+func main() {
+	cfg := config.MustLoad()
+
+	log := logger.New(cfg.Env)
+
+	provider, err := envelope.LoadLocalProvider(cfg.Encryption.KeyFile, cfg.Encryption.Keys)
+	if err != nil {
+		panic(err)
+	}
+
+	pool, err := postgresql.NewConection(context.Background(), log, cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer pool.Close()
+
+	cipher := envelope.New(provider)
+	appDB := appdb.NewAppDB(pool, log, cipher)
+	mfaDB := mfadb.NewMFADB(pool, log, cipher)
+
+	count, err := appDB.ReencryptAppKeys(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	totpCount, err := mfaDB.ReencryptTOTPSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("re-encrypted %d app keys and %d totp secrets with master key %q\n", count, totpCount, provider.KeyID())
+}
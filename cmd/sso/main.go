@@ -23,12 +23,22 @@ func main() {
 
 	stop := make(chan os.Signal, 1)
 	go application.GRPCSrv.MustRun()
+	if application.HTTPSrv != nil {
+		go application.HTTPSrv.MustRun()
+	}
+	go application.Rotator.Run()
+	go application.Outbox.Run()
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	stopSignal := <-stop
 	log.Info("stoppping application", slog.String("signal", stopSignal.String()))
 
 	application.GRPCSrv.Stop()
+	if application.HTTPSrv != nil {
+		application.HTTPSrv.Stop()
+	}
+	application.Rotator.Stop()
+	application.Outbox.Stop()
 
 	log.Info("application stopped")
 }
@@ -2,18 +2,42 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	grpcapp "grpc/internal/app/grpc"
+	httpapp "grpc/internal/app/http"
+	outboxapp "grpc/internal/app/outbox"
+	rotatorapp "grpc/internal/app/rotator"
 	"grpc/internal/config"
 	appdb "grpc/internal/database/app"
+	auditdb "grpc/internal/database/audit"
 	authdb "grpc/internal/database/auth"
+	clientdb "grpc/internal/database/client"
+	mfadb "grpc/internal/database/mfa"
+	outboxdb "grpc/internal/database/outbox"
+	passkeydb "grpc/internal/database/passkey"
 	"grpc/internal/database/postgresql"
+	roledb "grpc/internal/database/role"
+	sessiondb "grpc/internal/database/session"
+	tokendb "grpc/internal/database/token"
+	"grpc/internal/lib/breach"
+	"grpc/internal/lib/envelope"
 	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/mail"
+	"grpc/internal/lib/password"
+	"grpc/internal/logger"
 	authservice "grpc/internal/services/auth"
+	mailservice "grpc/internal/services/mail"
 	"log/slog"
+	"slices"
+	"time"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	HTTPSrv *httpapp.App
+	Rotator *rotatorapp.App
+	Outbox  *outboxapp.App
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
@@ -24,18 +48,190 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 		log.Error("failed connect to database", sl.OpErr(op, err))
 	}
 
+	var provider envelope.KeyProvider
+	localProvider, err := envelope.LoadLocalProvider(cfg.Encryption.KeyFile, cfg.Encryption.Keys)
+	switch {
+	case err == nil:
+		provider = localProvider
+	case errors.Is(err, envelope.ErrNoMasterKey):
+		if err := checkPlaintext(cfg.Env, cfg.Encryption); err != nil {
+			log.Error("failed to configure encryption", sl.OpErr(op, err))
+			panic(err)
+		}
+		log.Warn("no encryption key configured, app and TOTP secrets are stored in plaintext", slog.String("op", op))
+	default:
+		log.Error("failed to load encryption keys", sl.OpErr(op, err))
+		panic(err)
+	}
+	cipher := envelope.New(provider)
+
 	authDB := authdb.NewAuthDB(dbPool, log)
-	appDB := appdb.NewAppDB(dbPool, log)
+	appDB := appdb.NewAppDB(dbPool, log, cipher)
+	tokenDB := tokendb.NewTokenDB(dbPool, log)
+	sessionDB := sessiondb.NewSessionDB(dbPool, log)
+	roleDB := roledb.NewRoleDB(dbPool, log)
+	clientDB := clientdb.NewClientDB(dbPool, log)
+	auditDB := auditdb.NewAuditDB(dbPool, log)
+	mfaDB := mfadb.NewMFADB(dbPool, log, cipher)
+	passkeyDB := passkeydb.NewPasskeyDB(dbPool, log)
 	db := authservice.DB{
-		AuthDB: authDB,
-		AppDB:  appDB,
+		AuthDB:    authDB,
+		AppDB:     appDB,
+		TokenDB:   tokenDB,
+		SessionDB: sessionDB,
+		RoleDB:    roleDB,
+		ClientDB:  clientDB,
+		AuditDB:   auditDB,
+		MFADB:     mfaDB,
+		PasskeyDB: passkeyDB,
 	}
 
-	authService := authservice.NewAuthService(log, db, cfg.TokenExpires, cfg.RefreshTokenExpires)
+	passwords, err := newPasswordHashers(cfg.Password)
+	if err != nil {
+		log.Error("failed to configure password hashing", sl.OpErr(op, err))
+		panic(err)
+	}
 
-	grpcApp := grpcapp.New(log, cfg.GRPC.Port, authService)
+	var breachedPasswords authservice.BreachedPasswords
+	if cfg.Password.Breached.Enabled {
+		filter, err := breach.Load(cfg.Password.Breached.Path, cfg.Password.Breached.FalsePositiveRate, cfg.Password.Breached.MinCount)
+		if err != nil {
+			log.Error("failed to load breached passwords", sl.OpErr(op, err))
+			panic(err)
+		}
+		log.Info("breached passwords loaded", slog.Int("hashes", filter.Len()), slog.Int("bytes", filter.SizeBytes()))
+		breachedPasswords = filter
+	}
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Error("failed to configure mail", sl.OpErr(op, err))
+		panic(err)
+	}
+	if err := checkOutbox(cfg.Mail); err != nil {
+		log.Error("failed to configure mail outbox", sl.OpErr(op, err))
+		panic(err)
+	}
+
+	mailTemplates, err := mail.LoadTemplates(cfg.Mail.Templates, cfg.Mail.DefaultLocale)
+	if err != nil {
+		log.Error("failed to load mail templates", sl.OpErr(op, err))
+		panic(err)
+	}
+
+	authService := authservice.NewAuthService(log, db, cfg.TokenExpires, cfg.RefreshTokenExpires, cfg.KeyRotation, cfg.JWT, cfg.Apps, cfg.OAuth, cfg.MFA, cfg.WebAuthn, cfg.EmailVerification, cfg.PasswordReset, passwords, passwordPolicy(cfg.Password.Policy), breachedPasswords, mailTemplates)
+
+	grpcApp := grpcapp.New(log, cfg.GRPC.Port, authService, authService)
+
+	var httpApp *httpapp.App
+	if cfg.HTTP.Enabled {
+		httpApp = httpapp.New(log, cfg.HTTP.Port, cfg.HTTP.Timeout, cfg.JWT.Issuer, authService, authService, authService)
+	}
+
+	rotator := rotatorapp.New(log, cfg.KeyRotation.CheckInterval, authService)
+
+	mailService := mailservice.NewMailService(log, outboxdb.NewOutboxDB(dbPool, log), mailer, cfg.Mail.Outbox)
+	outbox := outboxapp.New(log, cfg.Mail.Outbox.PollInterval, mailService)
 
 	return &App{
 		GRPCSrv: grpcApp,
+		HTTPSrv: httpApp,
+		Rotator: rotator,
+		Outbox:  outbox,
+	}
+}
+
+// newMailer returns the configured sender of mail.
+func newMailer(cfg config.MailConfig) (mailservice.Mailer, error) {
+	switch cfg.Sender {
+	case "dir":
+		return mail.NewDir(cfg.Dir, cfg.From)
+	case "smtp":
+		return mail.NewSMTP(mail.SMTPServer{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			Security: cfg.SMTP.Security,
+			Timeout:  cfg.SMTP.Timeout,
+		}, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail sender %q", cfg.Sender)
+	}
+}
+
+// checkOutbox rejects outbox settings the outbox cannot work with. The lease
+// of a batch must last until its last mail timed out, or another instance
+// sends the mail again meanwhile.
+func checkOutbox(cfg config.MailConfig) error {
+	outbox := cfg.Outbox
+
+	switch {
+	case outbox.BatchSize <= 0:
+		return fmt.Errorf("mail outbox batch_size must be positive, got %d", outbox.BatchSize)
+	case outbox.PollInterval <= 0:
+		return fmt.Errorf("mail outbox poll_interval must be positive, got %s", outbox.PollInterval)
+	case cfg.Sender == "smtp" && outbox.Lease < time.Duration(outbox.BatchSize)*cfg.SMTP.Timeout:
+		return fmt.Errorf("mail outbox lease %s is shorter than batch_size times the smtp timeout %s", outbox.Lease, cfg.SMTP.Timeout)
+	}
+
+	return nil
+}
+
+// checkPlaintext refuses to store secrets in plaintext for lack of a master
+// key, except in local environments or where encryption.allow_plaintext
+// asks for it.
+func checkPlaintext(env string, cfg config.EncryptionConfig) error {
+	if env != logger.EnvLocal && !cfg.AllowPlaintext {
+		return errors.New("no encryption key configured: set ENCRYPTION_KEYS or ENCRYPTION_KEY_FILE, or encryption.allow_plaintext to store secrets in plaintext")
+	}
+
+	return nil
+}
+
+// newPasswordHashers hashes new passwords with the configured algorithm and
+// accepts hashes of all the others. Parameters out of range of any of them
+// are an error.
+func newPasswordHashers(cfg config.PasswordConfig) (*password.Hashers, error) {
+	hashers := []password.Hasher{
+		password.Bcrypt{Cost: cfg.BcryptCost},
+		password.Argon2id{
+			Memory:      cfg.Argon2id.Memory,
+			Iterations:  cfg.Argon2id.Iterations,
+			Parallelism: cfg.Argon2id.Parallelism,
+		},
+		password.Scrypt{
+			LogN:        cfg.Scrypt.LogN,
+			BlockSize:   cfg.Scrypt.BlockSize,
+			Parallelism: cfg.Scrypt.Parallelism,
+		},
+	}
+
+	for _, hasher := range hashers {
+		if err := hasher.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid password hashing parameters: %w", err)
+		}
+	}
+
+	for i, hasher := range hashers {
+		if hasher.ID() == cfg.Algorithm {
+			others := append(slices.Clone(hashers[:i]), hashers[i+1:]...)
+			return password.New(hasher, others...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+}
+
+func passwordPolicy(cfg config.PolicyConfig) password.Policy {
+	return password.Policy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireLower:     cfg.RequireLower,
+		RequireUpper:     cfg.RequireUpper,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+		DisallowUserInfo: cfg.DisallowUserInfo,
+		MinStrength:      cfg.MinStrength,
 	}
 }
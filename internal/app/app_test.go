@@ -0,0 +1,53 @@
+package app
+
+import (
+	"grpc/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOutbox(t *testing.T) {
+	valid := config.MailConfig{
+		Sender: "smtp",
+		SMTP:   config.SMTPConfig{Timeout: 30 * time.Second},
+		Outbox: config.OutboxConfig{
+			PollInterval: time.Second,
+			BatchSize:    10,
+			Lease:        5 * time.Minute,
+		},
+	}
+	require.NoError(t, checkOutbox(valid))
+
+	tests := []struct {
+		name   string
+		change func(cfg *config.MailConfig)
+	}{
+		{name: "zero batch size", change: func(cfg *config.MailConfig) { cfg.Outbox.BatchSize = 0 }},
+		{name: "negative batch size", change: func(cfg *config.MailConfig) { cfg.Outbox.BatchSize = -1 }},
+		{name: "zero poll interval", change: func(cfg *config.MailConfig) { cfg.Outbox.PollInterval = 0 }},
+		{name: "lease shorter than a batch", change: func(cfg *config.MailConfig) { cfg.Outbox.Lease = 4 * time.Minute }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.change(&cfg)
+			require.Error(t, checkOutbox(cfg))
+		})
+	}
+
+	// Mail written to a directory has no timeout to cover.
+	dir := valid
+	dir.Sender = "dir"
+	dir.Outbox.Lease = time.Second
+	require.NoError(t, checkOutbox(dir))
+}
+
+func TestCheckPlaintext(t *testing.T) {
+	require.NoError(t, checkPlaintext("local", config.EncryptionConfig{}))
+	require.NoError(t, checkPlaintext("prod", config.EncryptionConfig{AllowPlaintext: true}))
+	require.Error(t, checkPlaintext("dev", config.EncryptionConfig{}))
+	require.Error(t, checkPlaintext("prod", config.EncryptionConfig{}))
+}
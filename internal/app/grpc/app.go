@@ -2,6 +2,7 @@ package grpcapp
 
 import (
 	"fmt"
+	appsGRPC "grpc/internal/grpc/apps"
 	authGRPC "grpc/internal/grpc/auth"
 	"grpc/internal/lib/logger/sl"
 	"log/slog"
@@ -16,10 +17,13 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int, authService authGRPC.Auth) *App {
-	gRPCServer := grpc.NewServer()
+func New(log *slog.Logger, port int, authService authGRPC.Auth, appsService appsGRPC.Apps) *App {
+	gRPCServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(clientInfoInterceptor),
+	)
 
 	authGRPC.Register(gRPCServer, authService)
+	appsGRPC.Register(gRPCServer, appsService)
 
 	return &App{
 		log:        log,
@@ -40,7 +44,7 @@ func (a *App) MustRun() {
 func (a *App) Run() error {
 	const op = "app.grpcapp.Run"
 
-	a.log.Info("stating gRPC server")
+	a.log.Info("starting gRPC server")
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
 	if err != nil {
@@ -0,0 +1,32 @@
+package grpcapp
+
+import (
+	"context"
+	"grpc/internal/lib/clientinfo"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientInfoInterceptor stores the address and user agent of the calling
+// client in the request context.
+func clientInfoInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var client clientinfo.Info
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			client.UserAgent = userAgent[0]
+		}
+	}
+
+	return handler(clientinfo.WithInfo(ctx, client), req)
+}
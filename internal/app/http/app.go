@@ -0,0 +1,83 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	keysHTTP "grpc/internal/http/keys"
+	oauthHTTP "grpc/internal/http/oauth"
+	oidcHTTP "grpc/internal/http/oidc"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(log *slog.Logger, port int, timeout time.Duration, issuer string, keys keysHTTP.Keys, oauth oauthHTTP.OAuth, oidc oidcHTTP.OIDC) *App {
+	mux := http.NewServeMux()
+
+	keysHTTP.Register(mux, log, keys)
+	oauthHTTP.Register(mux, log, oauth)
+	oidcHTTP.Register(mux, log, issuer, oidc)
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Addr:         fmt.Sprintf(":%d", port),
+			Handler:      clientInfoMiddleware(mux),
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	const op = "app.httpapp.MustRun"
+
+	if err := a.Run(); err != nil {
+		a.log.Error("failed to run HTTP server", sl.OpErr(op, err))
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "app.httpapp.Run"
+
+	a.log.Info("starting HTTP server")
+
+	l, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		a.log.Error("failed to listen HTTP server", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("HTTP server is running", slog.String("addres", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		a.log.Error("failed to start HTTP server", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "app.httpapp.Stop"
+
+	a.log.Info("stopping HTTP server", slog.String("op", op), slog.Int("port", a.port))
+
+	if err := a.httpServer.Shutdown(context.Background()); err != nil {
+		a.log.Error("failed to stop HTTP server", sl.OpErr(op, err))
+	}
+}
@@ -0,0 +1,23 @@
+package httpapp
+
+import (
+	"grpc/internal/lib/clientinfo"
+	"net"
+	"net/http"
+)
+
+// clientInfoMiddleware stores the address and user agent of the calling
+// client in the request context.
+func clientInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientinfo.Info{
+			IP:        r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+
+		next.ServeHTTP(w, r.WithContext(clientinfo.WithInfo(r.Context(), client)))
+	})
+}
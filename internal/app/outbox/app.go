@@ -0,0 +1,70 @@
+package outboxapp
+
+import (
+	"context"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+type MailDeliverer interface {
+	DeliverMail(ctx context.Context) error
+}
+
+type App struct {
+	log       *slog.Logger
+	deliverer MailDeliverer
+	interval  time.Duration
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func New(log *slog.Logger, interval time.Duration, deliverer MailDeliverer) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &App{
+		log:       log,
+		deliverer: deliverer,
+		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+// Run delivers the mail in the outbox right away and then every interval
+// until Stop is called.
+func (a *App) Run() {
+	const op = "app.outboxapp.Run"
+
+	defer close(a.done)
+
+	a.log.Info("starting mail outbox", slog.String("op", op), slog.Duration("interval", a.interval))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.deliverer.DeliverMail(a.ctx); err != nil && a.ctx.Err() == nil {
+			a.log.Error("failed to deliver mail", sl.OpErr(op, err))
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop cancels the deliveries in flight and waits for Run to return. Mail
+// whose delivery was cut short is sent again once its lease ends.
+func (a *App) Stop() {
+	const op = "app.outboxapp.Stop"
+
+	a.log.Info("stopping mail outbox", slog.String("op", op))
+
+	a.cancel()
+	<-a.done
+}
@@ -0,0 +1,42 @@
+package outboxapp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDeliverer delivers until its context is canceled.
+type blockingDeliverer struct {
+	started chan struct{}
+}
+
+func (b *blockingDeliverer) DeliverMail(ctx context.Context) error {
+	close(b.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStopCancelsDelivery(t *testing.T) {
+	deliverer := &blockingDeliverer{started: make(chan struct{})}
+	app := New(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Hour, deliverer)
+
+	go app.Run()
+	<-deliverer.started
+
+	stopped := make(chan struct{})
+	go func() {
+		app.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Stop did not cancel the delivery in flight")
+	}
+}
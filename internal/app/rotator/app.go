@@ -0,0 +1,64 @@
+package rotatorapp
+
+import (
+	"context"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+type KeyRotator interface {
+	RotateKeys(ctx context.Context) error
+}
+
+type App struct {
+	log      *slog.Logger
+	rotator  KeyRotator
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(log *slog.Logger, interval time.Duration, rotator KeyRotator) *App {
+	return &App{
+		log:      log,
+		rotator:  rotator,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run rotates the keys right away and then every interval until Stop is
+// called.
+func (a *App) Run() {
+	const op = "app.rotatorapp.Run"
+
+	defer close(a.done)
+
+	a.log.Info("starting key rotator", slog.String("op", op), slog.Duration("interval", a.interval))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.rotator.RotateKeys(context.Background()); err != nil {
+			a.log.Error("failed to rotate keys", sl.OpErr(op, err))
+		}
+
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) Stop() {
+	const op = "app.rotatorapp.Stop"
+
+	a.log.Info("stopping key rotator", slog.String("op", op))
+
+	close(a.stop)
+	<-a.done
+}
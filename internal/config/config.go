@@ -10,12 +10,24 @@ import (
 )
 
 type Config struct {
-	Env                 string         `yaml:"env" env-required:"true"`
-	TokenExpires        time.Duration  `yaml:"token_expires" env-required:"true"`
-	RefreshTokenExpires time.Duration  `yaml:"refresh_token_expires" env-required:"true"`
-	Database            DatabaseConfig `yaml:"database" env-required:"true"`
-	GRPC                GRPCConfig     `yaml:"grpc" env-required:"true"`
-	MigrationsPath      string         `yaml:"migrations_path" env-required:"true"`
+	Env                 string                  `yaml:"env" env-required:"true"`
+	TokenExpires        time.Duration           `yaml:"token_expires" env-required:"true"`
+	RefreshTokenExpires time.Duration           `yaml:"refresh_token_expires" env-required:"true"`
+	KeyRotation         KeyRotationConfig       `yaml:"key_rotation"`
+	JWT                 JWTConfig               `yaml:"jwt"`
+	Apps                AppsConfig              `yaml:"apps"`
+	OAuth               OAuthConfig             `yaml:"oauth"`
+	Password            PasswordConfig          `yaml:"password"`
+	MFA                 MFAConfig               `yaml:"mfa"`
+	WebAuthn            WebAuthnConfig          `yaml:"webauthn"`
+	EmailVerification   EmailVerificationConfig `yaml:"email_verification"`
+	PasswordReset       PasswordResetConfig     `yaml:"password_reset"`
+	Mail                MailConfig              `yaml:"mail"`
+	Encryption          EncryptionConfig        `yaml:"encryption"`
+	Database            DatabaseConfig          `yaml:"database" env-required:"true"`
+	GRPC                GRPCConfig              `yaml:"grpc" env-required:"true"`
+	HTTP                HTTPConfig              `yaml:"http"`
+	MigrationsPath      string                  `yaml:"migrations_path" env-required:"true"`
 }
 
 type DatabaseConfig struct {
@@ -35,6 +47,181 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout" env-required:"true"`
 }
 
+type KeyRotationConfig struct {
+	Interval      time.Duration `yaml:"interval" env-default:"720h"`
+	Prepublish    time.Duration `yaml:"prepublish" env-default:"24h"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1h"`
+}
+
+type JWTConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"sso"`
+	ClockSkew    time.Duration `yaml:"clock_skew" env-default:"30s"`
+	MaxScopeSize int           `yaml:"max_scope_size" env-default:"2048"`
+
+	// ImpersonationExpires is the lifetime of impersonation tokens, which
+	// cannot be refreshed.
+	ImpersonationExpires time.Duration `yaml:"impersonation_expires" env-default:"15m"`
+}
+
+type AppsConfig struct {
+	AdminAppID int `yaml:"admin_app_id" env-default:"1"`
+}
+
+type OAuthConfig struct {
+	CodeExpires        time.Duration `yaml:"code_expires" env-default:"1m"`
+	ClientTokenExpires time.Duration `yaml:"client_token_expires" env-default:"5m"`
+	DeviceCodeExpires  time.Duration `yaml:"device_code_expires" env-default:"10m"`
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	// A client that typed UserCodeMaxAttempts unknown or expired user codes
+	// within UserCodeAttemptWindow cannot look up user codes until the
+	// oldest of them falls out of the window.
+	UserCodeMaxAttempts   int           `yaml:"user_code_max_attempts" env-default:"10"`
+	UserCodeAttemptWindow time.Duration `yaml:"user_code_attempt_window" env-default:"15m"`
+	// RedirectSchemes are the private-use URI schemes of native apps, e.g.
+	// com.example.app, that redirect URIs may have besides https and http
+	// for loopback addresses.
+	RedirectSchemes []string `yaml:"redirect_schemes"`
+}
+
+// PasswordConfig selects the algorithm new password hashes are created
+// with: bcrypt, argon2id or scrypt. Hashes of the other algorithms are
+// still accepted and replaced on login.
+type PasswordConfig struct {
+	Algorithm  string         `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int            `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2id   Argon2idConfig `yaml:"argon2id"`
+	Scrypt     ScryptConfig   `yaml:"scrypt"`
+	Policy     PolicyConfig   `yaml:"policy"`
+	Breached   BreachedConfig `yaml:"breached"`
+}
+
+type Argon2idConfig struct {
+	Memory      uint32 `yaml:"memory" env-default:"19456"`
+	Iterations  uint32 `yaml:"iterations" env-default:"2"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"1"`
+}
+
+type ScryptConfig struct {
+	LogN        int `yaml:"ln" env-default:"17"`
+	BlockSize   int `yaml:"r" env-default:"8"`
+	Parallelism int `yaml:"p" env-default:"1"`
+}
+
+// PolicyConfig is the password policy new passwords must follow.
+// MinStrength is the lowest accepted strength score from 0 to 4, where 0
+// disables the check.
+type PolicyConfig struct {
+	MinLength        int  `yaml:"min_length" env-default:"8"`
+	MaxLength        int  `yaml:"max_length" env-default:"128"`
+	RequireLower     bool `yaml:"require_lower" env-default:"false"`
+	RequireUpper     bool `yaml:"require_upper" env-default:"false"`
+	RequireDigit     bool `yaml:"require_digit" env-default:"false"`
+	RequireSymbol    bool `yaml:"require_symbol" env-default:"false"`
+	DisallowUserInfo bool `yaml:"disallow_user_info" env-default:"true"`
+	MinStrength      int  `yaml:"min_strength" env-default:"2"`
+}
+
+// BreachedConfig loads the SHA-1 hashes of breached passwords from a local
+// copy of the Have I Been Pwned list, a single file or a directory of range
+// files. Hashes seen fewer than MinCount times are left out to save memory.
+type BreachedConfig struct {
+	Enabled           bool    `yaml:"enabled" env-default:"false"`
+	Path              string  `yaml:"path"`
+	MinCount          int     `yaml:"min_count" env-default:"1"`
+	FalsePositiveRate float64 `yaml:"false_positive_rate" env-default:"0.001"`
+}
+
+// MFAConfig configures TOTP authenticators. Issuer names the account in
+// authenticator apps, Skew is the number of 30 second steps a code may be
+// off by, and a login challenge fails for good after MaxAttempts wrong
+// codes.
+type MFAConfig struct {
+	Issuer           string        `yaml:"issuer" env-default:"SSO"`
+	Skew             int64         `yaml:"skew" env-default:"1"`
+	ChallengeExpires time.Duration `yaml:"challenge_expires" env-default:"5m"`
+	MaxAttempts      int           `yaml:"max_attempts" env-default:"5"`
+	RecoveryCodes    int           `yaml:"recovery_codes" env-default:"10"`
+}
+
+// WebAuthnConfig describes the relying party passkeys are created for.
+// RPID is the domain of the login pages, which must be one of Origins or
+// a parent domain of it, and Timeout is the time a registration or login
+// ceremony may take.
+type WebAuthnConfig struct {
+	RPID    string        `yaml:"rp_id" env-default:"localhost"`
+	RPName  string        `yaml:"rp_name" env-default:"SSO"`
+	Origins []string      `yaml:"origins" env-default:"http://localhost:8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5m"`
+}
+
+// EmailVerificationConfig describes the mail that verifies the email of a
+// user. It links to URL with the token in the token query parameter, a
+// page of the app that passes it to VerifyEmail. A new mail is sent at
+// most once per ResendInterval.
+type EmailVerificationConfig struct {
+	URL            string        `yaml:"url" env-default:"http://localhost:3000/verify-email"`
+	TokenExpires   time.Duration `yaml:"token_expires" env-default:"24h"`
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+}
+
+// PasswordResetConfig describes the mail that lets a user who forgot the
+// password set a new one. It links to URL with the token in the token
+// query parameter, a page of the app that passes it to ResetPassword with
+// the new password.
+type PasswordResetConfig struct {
+	URL            string        `yaml:"url" env-default:"http://localhost:3000/reset-password"`
+	TokenExpires   time.Duration `yaml:"token_expires" env-default:"1h"`
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+}
+
+// MailConfig describes outgoing mail. Sender is "dir", which writes
+// messages to Dir as .eml files, or "smtp". Templates is a directory of
+// mail templates replacing or adding to the built-in ones.
+type MailConfig struct {
+	From          string       `yaml:"from" env-default:"SSO <no-reply@localhost>"`
+	Sender        string       `yaml:"sender" env-default:"dir"`
+	Dir           string       `yaml:"dir" env-default:"./data/mail"`
+	SMTP          SMTPConfig   `yaml:"smtp"`
+	Templates     string       `yaml:"templates"`
+	DefaultLocale string       `yaml:"default_locale" env-default:"en"`
+	Outbox        OutboxConfig `yaml:"outbox"`
+}
+
+// SMTPConfig describes the SMTP server. Security is "none", "starttls" or
+// "tls".
+type SMTPConfig struct {
+	Host     string        `yaml:"host" env:"SMTP_HOST"`
+	Port     int           `yaml:"port" env-default:"587"`
+	Username string        `yaml:"username" env:"SMTP_USERNAME"`
+	Password string        `yaml:"password" env:"SMTP_PASSWORD"`
+	Security string        `yaml:"security" env-default:"starttls"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"30s"`
+}
+
+// OutboxConfig describes the delivery of the mail outbox. A failed mail is
+// retried after RetryBackoff, doubled with every further attempt, until
+// MaxAttempts were made. A claimed mail is left to its sender for Lease
+// before another instance may try it.
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	BatchSize    int           `yaml:"batch_size" env-default:"10"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env-default:"1m"`
+	Lease        time.Duration `yaml:"lease" env-default:"5m"`
+}
+
+type EncryptionConfig struct {
+	KeyFile        string `yaml:"key_file" env:"ENCRYPTION_KEY_FILE"`
+	Keys           string `yaml:"keys" env:"ENCRYPTION_KEYS"`
+	AllowPlaintext bool   `yaml:"allow_plaintext" env:"ENCRYPTION_ALLOW_PLAINTEXT" env-default:"false"`
+}
+
+type HTTPConfig struct {
+	Enabled bool          `yaml:"enabled" env-default:"false"`
+	Port    int           `yaml:"port" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
 func MustLoad() *Config {
 	if err := godotenv.Load(".env"); err != nil {
 		log.Fatal("failed to load environment file, error: ", err)
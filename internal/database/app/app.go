@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"errors"
+	"grpc/internal/database"
 	"grpc/internal/domain/models"
 	"grpc/internal/lib/database/query"
 	"grpc/internal/lib/logger/sl"
@@ -12,15 +13,25 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Cipher encrypts the secrets of app keys before they are stored and
+// decrypts them when they are read.
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, value string) (string, error)
+	NeedsReencrypt(value string) bool
+}
+
 type AppDB struct {
-	pool *pgxpool.Pool
-	log  *slog.Logger
+	pool   *pgxpool.Pool
+	log    *slog.Logger
+	cipher Cipher
 }
 
-func NewAppDB(pool *pgxpool.Pool, log *slog.Logger) *AppDB {
+func NewAppDB(pool *pgxpool.Pool, log *slog.Logger, cipher Cipher) *AppDB {
 	return &AppDB{
-		pool: pool,
-		log:  log,
+		pool:   pool,
+		log:    log,
+		cipher: cipher,
 	}
 }
 
@@ -35,14 +46,14 @@ func (a *AppDB) GetAppByID(ctx context.Context, appID int) (models.App, error) {
 	defer tx.Rollback(ctx)
 
 	q := `
-		SELECT id, name, secret, refresh_secret FROM app WHERE id = $1;
+		SELECT id, name, signing_alg, require_verified_email FROM app WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	a.log.Debug("get app by id query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
 
 	var app models.App
 
-	err = tx.QueryRow(ctx, q, appID).Scan(&app.ID, &app.Name, &app.Secret, &app.RefreshSecret)
+	err = tx.QueryRow(ctx, q, appID).Scan(&app.ID, &app.Name, &app.SigningAlg, &app.RequireVerifiedEmail)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			a.log.Error("app not found", slog.String("op", op), slog.Int("id", appID))
@@ -55,3 +66,500 @@ func (a *AppDB) GetAppByID(ctx context.Context, appID int) (models.App, error) {
 	a.log.Info("successfully get app by id", slog.String("op", op), slog.Int("id", appID))
 	return app, nil
 }
+
+func (a *AppDB) GetApps(ctx context.Context) ([]models.App, error) {
+	const op = "database.app.GetApps"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT id, name, signing_alg, require_verified_email FROM app WHERE deleted_at IS NULL ORDER BY id;
+	`
+
+	a.log.Debug("get apps query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		a.log.Error("failed to get apps", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		var app models.App
+		if err := rows.Scan(&app.ID, &app.Name, &app.SigningAlg, &app.RequireVerifiedEmail); err != nil {
+			a.log.Error("failed to scan app", sl.OpErr(op, err))
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		a.log.Error("failed to read apps", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("successfully get apps", slog.String("op", op), slog.Int("count", len(apps)))
+	return apps, nil
+}
+
+// CreateApp creates the app together with its built-in admin role and its
+// signing keys, whose AppID is set here, and returns its id. It returns
+// database.ErrConflict if the name is taken.
+func (a *AppDB) CreateApp(ctx context.Context, app models.App, keys []models.AppKey) (int, error) {
+	const op = "database.app.CreateApp"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO app (name, signing_alg, require_verified_email) VALUES ($1, $2, $3) RETURNING id;
+	`
+
+	a.log.Debug("create app query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var appID int
+	if err := tx.QueryRow(ctx, q, app.Name, app.SigningAlg, app.RequireVerifiedEmail).Scan(&appID); err != nil {
+		if database.IsUniqueViolation(err) {
+			a.log.Error("app already exists", slog.String("op", op), slog.String("name", app.Name))
+			return 0, database.ErrConflict
+		}
+		a.log.Error("failed to create app", sl.OpErr(op, err))
+		return 0, errors.New("failed to create app")
+	}
+
+	q = `
+		WITH admin AS (
+			INSERT INTO role (app_id, name, description)
+			VALUES ($1, $2, 'Built-in role with every permission')
+			RETURNING id
+		)
+		INSERT INTO role_permission (role_id, permission) SELECT id, $3 FROM admin;
+	`
+
+	a.log.Debug("create admin role query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, appID, models.RoleAdmin, models.PermissionAll); err != nil {
+		a.log.Error("failed to create admin role", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	for _, key := range keys {
+		key.AppID = appID
+		if err := a.insertAppKey(ctx, tx, key); err != nil {
+			a.log.Error("failed to create app key", sl.OpErr(op, err))
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	a.log.Info("new app created", slog.String("op", op), slog.Int("id", appID), slog.String("name", app.Name))
+	return appID, nil
+}
+
+// UpdateApp renames the app and changes its settings. It returns
+// database.ErrNotFound if the app does not exist and database.ErrConflict if
+// the name is taken.
+func (a *AppDB) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "database.app.UpdateApp"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE app SET name = $2, require_verified_email = $3 WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	a.log.Debug("update app query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, app.ID, app.Name, app.RequireVerifiedEmail)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			a.log.Error("app already exists", slog.String("op", op), slog.String("name", app.Name))
+			return database.ErrConflict
+		}
+		a.log.Error("failed to update app", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("app not found", slog.String("op", op), slog.Int("id", app.ID))
+		return database.ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("app updated", slog.String("op", op), slog.Int("id", app.ID), slog.String("name", app.Name))
+	return nil
+}
+
+// DeleteApp marks the app as deleted and ends its sessions. The app and its
+// keys stay in the database. It returns database.ErrNotFound if the app
+// does not exist or was already deleted.
+func (a *AppDB) DeleteApp(ctx context.Context, appID int) error {
+	const op = "database.app.DeleteApp"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE app SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	a.log.Debug("delete app query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, appID)
+	if err != nil {
+		a.log.Error("failed to delete app", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("app not found", slog.String("op", op), slog.Int("id", appID))
+		return database.ErrNotFound
+	}
+
+	q = `
+		WITH ended AS (
+			UPDATE session SET ended_at = now()
+			WHERE app_id = $1 AND ended_at IS NULL
+		)
+		UPDATE refresh_token SET revoked_at = now()
+		WHERE app_id = $1 AND revoked_at IS NULL;
+	`
+
+	a.log.Debug("end app sessions query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, appID); err != nil {
+		a.log.Error("failed to end app sessions", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("app deleted", slog.String("op", op), slog.Int("id", appID))
+	return nil
+}
+
+func (a *AppDB) GetAppRedirectURIs(ctx context.Context, appID int) ([]string, error) {
+	const op = "database.app.GetAppRedirectURIs"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT uri FROM app_redirect_uri WHERE app_id = $1 ORDER BY uri;
+	`
+
+	a.log.Debug("get app redirect uris query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, appID)
+	if err != nil {
+		a.log.Error("failed to get app redirect uris", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	uris, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		a.log.Error("failed to read app redirect uris", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("successfully get app redirect uris", slog.String("op", op), slog.Int("app_id", appID), slog.Int("count", len(uris)))
+	return uris, nil
+}
+
+// SetAppRedirectURIs replaces the redirect URIs registered for the app.
+func (a *AppDB) SetAppRedirectURIs(ctx context.Context, appID int, uris []string) error {
+	const op = "database.app.SetAppRedirectURIs"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		DELETE FROM app_redirect_uri WHERE app_id = $1;
+	`
+
+	a.log.Debug("delete app redirect uris query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, appID); err != nil {
+		a.log.Error("failed to delete app redirect uris", sl.OpErr(op, err))
+		return err
+	}
+
+	q = `
+		INSERT INTO app_redirect_uri (app_id, uri) SELECT $1, unnest($2::TEXT[])
+		ON CONFLICT DO NOTHING;
+	`
+
+	a.log.Debug("create app redirect uris query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, appID, uris); err != nil {
+		a.log.Error("failed to create app redirect uris", sl.OpErr(op, err))
+		return errors.New("failed to create app redirect uris")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("app redirect uris updated", slog.String("op", op), slog.Int("app_id", appID), slog.Int("count", len(uris)))
+	return nil
+}
+
+// GetAppKeys returns every key of the app that is not retired, newest
+// activation first.
+func (a *AppDB) GetAppKeys(ctx context.Context, appID int) ([]models.AppKey, error) {
+	const op = "database.app.GetAppKeys"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT id, app_id, kind, algorithm, secret, status, activates_at, deactivated_at, created_at
+		FROM app_key
+		WHERE app_id = $1 AND status <> $2
+		ORDER BY activates_at DESC;
+	`
+
+	a.log.Debug("get app keys query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, appID, models.KeyStatusRetired)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.AppKey
+	for rows.Next() {
+		var key models.AppKey
+		err := rows.Scan(
+			&key.ID,
+			&key.AppID,
+			&key.Kind,
+			&key.Algorithm,
+			&key.Secret,
+			&key.Status,
+			&key.ActivatesAt,
+			&key.DeactivatedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			a.log.Error("failed to scan app key", sl.OpErr(op, err))
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		a.log.Error("failed to read app keys", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	for i := range keys {
+		keys[i].Secret, err = a.cipher.Decrypt(ctx, keys[i].Secret)
+		if err != nil {
+			a.log.Error("failed to decrypt app key", sl.OpErr(op, err), slog.String("kid", keys[i].ID))
+			return nil, err
+		}
+	}
+
+	a.log.Info("successfully get app keys", slog.String("op", op), slog.Int("app_id", appID), slog.Int("count", len(keys)))
+	return keys, nil
+}
+
+func (a *AppDB) CreateAppKey(ctx context.Context, key models.AppKey) error {
+	const op = "database.app.CreateAppKey"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := a.insertAppKey(ctx, tx, key); err != nil {
+		a.log.Error("failed to create app key", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("new app key created", slog.String("op", op), slog.Int("app_id", key.AppID), slog.String("kid", key.ID))
+	return nil
+}
+
+func (a *AppDB) insertAppKey(ctx context.Context, tx pgx.Tx, key models.AppKey) error {
+	const op = "database.app.insertAppKey"
+
+	q := `
+		INSERT INTO app_key (id, app_id, kind, algorithm, secret, status, activates_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	a.log.Debug("create app key query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	keySecret, err := a.cipher.Encrypt(ctx, key.Secret)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, q, key.ID, key.AppID, key.Kind, key.Algorithm, keySecret, key.Status, key.ActivatesAt)
+	return err
+}
+
+func (a *AppDB) UpdateAppKeyStatus(ctx context.Context, keyID string, status string) error {
+	const op = "database.app.UpdateAppKeyStatus"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE app_key SET
+			status = $2,
+			deactivated_at = CASE WHEN $2 = 'active' THEN NULL ELSE COALESCE(deactivated_at, now()) END
+		WHERE id = $1;
+	`
+
+	a.log.Debug("update app key status query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, keyID, status)
+	if err != nil {
+		a.log.Error("failed to update app key status", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("app key not found", slog.String("op", op), slog.String("kid", keyID))
+		return errors.New("app key not found")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("app key status updated", slog.String("op", op), slog.String("kid", keyID), slog.String("status", status))
+	return nil
+}
+
+// ReencryptAppKeys encrypts the secrets of all app keys, retired ones
+// included, that are stored in plaintext or under a previous master key
+// with the current master key. It returns the number of keys re-encrypted.
+func (a *AppDB) ReencryptAppKeys(ctx context.Context) (int, error) {
+	const op = "database.app.ReencryptAppKeys"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT id, secret FROM app_key ORDER BY id FOR UPDATE;
+	`
+
+	a.log.Debug("get app key secrets query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		a.log.Error("failed to get app key secrets", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	secrets := make(map[string]string)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			a.log.Error("failed to scan app key secret", sl.OpErr(op, err))
+			return 0, err
+		}
+		if a.cipher.NeedsReencrypt(value) {
+			secrets[id] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		a.log.Error("failed to read app key secrets", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	q = `
+		UPDATE app_key SET secret = $2 WHERE id = $1;
+	`
+
+	a.log.Debug("update app key secret query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	for id, value := range secrets {
+		plaintext, err := a.cipher.Decrypt(ctx, value)
+		if err != nil {
+			a.log.Error("failed to decrypt app key", sl.OpErr(op, err), slog.String("kid", id))
+			return 0, err
+		}
+
+		encrypted, err := a.cipher.Encrypt(ctx, plaintext)
+		if err != nil {
+			a.log.Error("failed to encrypt app key", sl.OpErr(op, err), slog.String("kid", id))
+			return 0, err
+		}
+
+		if _, err := tx.Exec(ctx, q, id, encrypted); err != nil {
+			a.log.Error("failed to update app key secret", sl.OpErr(op, err), slog.String("kid", id))
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	a.log.Info("app keys re-encrypted", slog.String("op", op), slog.Int("count", len(secrets)))
+	return len(secrets), nil
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewAuditDB(pool *pgxpool.Pool, log *slog.Logger) *AuditDB {
+	return &AuditDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (a *AuditDB) CreateImpersonationEvent(ctx context.Context, event models.ImpersonationEvent) error {
+	const op = "database.audit.CreateImpersonationEvent"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO impersonation_audit (event, token_id, actor_id, user_id, app_id, reason, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	a.log.Debug("create impersonation event query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q,
+		event.Event,
+		event.TokenID,
+		event.ActorID,
+		event.UserID,
+		event.AppID,
+		event.Reason,
+		event.IP,
+		event.UserAgent,
+	)
+	if err != nil {
+		a.log.Error("failed to create impersonation event", sl.OpErr(op, err))
+		return errors.New("failed to create impersonation event")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("impersonation event recorded",
+		slog.String("op", op),
+		slog.String("event", event.Event),
+		slog.String("jti", event.TokenID),
+		slog.Int64("actor_id", event.ActorID),
+		slog.Int64("user_id", event.UserID),
+	)
+	return nil
+}
@@ -3,10 +3,13 @@ package auth
 import (
 	"context"
 	"errors"
+	"grpc/internal/database"
+	"grpc/internal/database/outbox"
 	"grpc/internal/domain/models"
 	"grpc/internal/lib/database/query"
 	"grpc/internal/lib/logger/sl"
 	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -70,14 +73,14 @@ func (a *AuthDB) GetUserByEmail(ctx context.Context, email string) (models.User,
 	defer tx.Rollback(ctx)
 
 	q := `
-		SELECT id, name, email, hash_password FROM public.user WHERE email = $1;
+		SELECT id, name, email, hash_password, email_verified FROM public.user WHERE email = $1;
 	`
 
 	a.log.Debug("get user by email query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
 
 	var user models.User
 
-	err = tx.QueryRow(ctx, q, email).Scan(&user.ID, &user.Name, &user.Email, &user.PassHash)
+	err = tx.QueryRow(ctx, q, email).Scan(&user.ID, &user.Name, &user.Email, &user.PassHash, &user.EmailVerified)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			a.log.Error("user not found", slog.String("op", op), slog.String("email", email))
@@ -102,14 +105,14 @@ func (a *AuthDB) GetUserByID(ctx context.Context, userID int64) (models.User, er
 	defer tx.Rollback(ctx)
 
 	q := `
-		SELECT id, name, email, hash_password FROM public.user WHERE id = $1;
+		SELECT id, name, email, hash_password, email_verified FROM public.user WHERE id = $1;
 	`
 
 	a.log.Debug("get user by id query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
 
 	var user models.User
 
-	err = tx.QueryRow(ctx, q, userID).Scan(&user.ID, &user.Name, &user.Email, &user.PassHash)
+	err = tx.QueryRow(ctx, q, userID).Scan(&user.ID, &user.Name, &user.Email, &user.PassHash, &user.EmailVerified)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			a.log.Error("user not found", slog.String("op", op), slog.Int64("id", userID))
@@ -123,8 +126,8 @@ func (a *AuthDB) GetUserByID(ctx context.Context, userID int64) (models.User, er
 	return user, nil
 }
 
-func (a *AuthDB) IsAdmin(ctx context.Context, userID int64, appID int) (bool, error) {
-	const op = "database.auth.IsAdmin"
+func (a *AuthDB) CheckUser(ctx context.Context, email string) (bool, error) {
+	const op = "database.auth.CheckUser"
 
 	tx, err := a.pool.Begin(ctx)
 	if err != nil {
@@ -134,54 +137,392 @@ func (a *AuthDB) IsAdmin(ctx context.Context, userID int64, appID int) (bool, er
 	defer tx.Rollback(ctx)
 
 	q := `
-        SELECT id, user_id, app_id FROM admin 
-		WHERE user_id = $1 AND app_id = $2;
+        SELECT id FROM public.user WHERE email = $1;
     `
 
-	a.log.Debug("is admin query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+	a.log.Debug("check user query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
 
-	var isAdmin models.Admin
+	var userID int
 
-	if err = tx.QueryRow(ctx, q, userID, appID).Scan(&isAdmin.ID, &isAdmin.UserID, &isAdmin.AppID); err != nil {
+	if err := tx.QueryRow(ctx, q, email).Scan(&userID); err != nil {
 		if err == pgx.ErrNoRows {
-			a.log.Error("user not found", slog.String("op", op), slog.Int64("id", userID))
+			a.log.Info("user not found", slog.String("op", op), slog.String("email", email))
 			return false, nil
 		}
-		a.log.Error("failed to get user by id", sl.OpErr(op, err))
+		a.log.Error("failed to check user", sl.OpErr(op, err))
 		return false, err
 	}
 
-	a.log.Info("successfully check user is admin", slog.String("op", op), slog.Int64("id", userID), slog.Bool("is_admin", true))
+	a.log.Info("successfully check user", slog.String("op", op), slog.String("email", email), slog.Int("id", userID))
 	return true, nil
 }
 
-func (a *AuthDB) CheckUser(ctx context.Context, email string) (bool, error) {
-	const op = "database.auth.CheckUser"
+// UpdatePasswordHash replaces the password hash of the user if it is still
+// oldHash. It returns database.ErrConflict otherwise, for example when the
+// password was changed since oldHash was read.
+func (a *AuthDB) UpdatePasswordHash(ctx context.Context, userID int64, oldHash string, passHash string) error {
+	const op = "database.auth.UpdatePasswordHash"
 
 	tx, err := a.pool.Begin(ctx)
 	if err != nil {
 		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
-		return false, err
+		return err
 	}
 	defer tx.Rollback(ctx)
 
 	q := `
-        SELECT id FROM public.user WHERE email = $1;
-    `
+		UPDATE public.user SET hash_password = $3 WHERE id = $1 AND hash_password = $2;
+	`
 
-	a.log.Debug("check user query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+	a.log.Debug("update password hash query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
 
-	var userID int
+	tag, err := tx.Exec(ctx, q, userID, oldHash, passHash)
+	if err != nil {
+		a.log.Error("failed to update password hash", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("password hash changed", slog.String("op", op), slog.Int64("id", userID))
+		return database.ErrConflict
+	}
 
-	if err := tx.QueryRow(ctx, q, email).Scan(&userID); err != nil {
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("password hash updated", slog.String("op", op), slog.Int64("id", userID))
+	return nil
+}
+
+// CreateEmailVerificationToken stores a verification token for the user
+// and puts the mail with it into the outbox. It returns
+// database.ErrConflict if a token was created for the user less than
+// resendInterval ago, so that a mailbox cannot be flooded.
+func (a *AuthDB) CreateEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken, resendInterval time.Duration, mail models.Mail) error {
+	const op = "database.auth.CreateEmailVerificationToken"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO email_verification_token (token_hash, user_id, email, expires_at)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM email_verification_token
+			WHERE user_id = $2 AND created_at > now() - make_interval(secs => $5)
+		);
+	`
+
+	a.log.Debug("create email verification token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, token.TokenHash, token.UserID, token.Email, token.ExpiresAt, resendInterval.Seconds())
+	if err != nil {
+		a.log.Error("failed to create email verification token", sl.OpErr(op, err))
+		return errors.New("failed to create email verification token")
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Info("email verification token created recently", slog.String("op", op), slog.Int64("id", token.UserID))
+		return database.ErrConflict
+	}
+
+	if err := outbox.Add(ctx, tx, mail); err != nil {
+		a.log.Error("failed to add verification mail to outbox", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("email verification token created", slog.String("op", op), slog.Int64("id", token.UserID))
+	return nil
+}
+
+// VerifyEmail uses up the verification token and marks the email of its
+// user as verified. The other tokens of the user are used up as well. It
+// returns database.ErrNotFound if there is no such token, it expired or
+// was used before, or the user changed the email since it was created.
+func (a *AuthDB) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "database.auth.VerifyEmail"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE email_verification_token SET consumed_at = now()
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > now()
+		RETURNING user_id, email;
+	`
+
+	a.log.Debug("consume email verification token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var (
+		userID int64
+		email  string
+	)
+	if err := tx.QueryRow(ctx, q, tokenHash).Scan(&userID, &email); err != nil {
 		if err == pgx.ErrNoRows {
-			a.log.Info("user not found", slog.String("op", op), slog.String("email", email))
-			return false, nil
+			a.log.Error("email verification token not found", slog.String("op", op))
+			return 0, database.ErrNotFound
 		}
-		a.log.Error("failed to check user", sl.OpErr(op, err))
-		return false, err
+		a.log.Error("failed to consume email verification token", sl.OpErr(op, err))
+		return 0, err
 	}
 
-	a.log.Info("successfully check user", slog.String("op", op), slog.String("email", email), slog.Int("id", userID))
-	return true, nil
+	q = `
+		UPDATE public.user SET email_verified = TRUE WHERE id = $1 AND email = $2;
+	`
+
+	a.log.Debug("verify email query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userID, email)
+	if err != nil {
+		a.log.Error("failed to verify email", sl.OpErr(op, err))
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("email changed since the token was created", slog.String("op", op), slog.Int64("id", userID))
+		return 0, database.ErrNotFound
+	}
+
+	q = `
+		UPDATE email_verification_token SET consumed_at = now()
+		WHERE user_id = $1 AND consumed_at IS NULL;
+	`
+
+	a.log.Debug("consume user email verification tokens query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID); err != nil {
+		a.log.Error("failed to consume email verification tokens", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	a.log.Info("email verified", slog.String("op", op), slog.Int64("id", userID))
+	return userID, nil
+}
+
+// CreatePasswordResetToken stores a password reset token for the user and
+// puts the mail with it into the outbox. It returns database.ErrConflict if
+// a token was created for the user less than resendInterval ago.
+func (a *AuthDB) CreatePasswordResetToken(ctx context.Context, token models.PasswordResetToken, resendInterval time.Duration, mail models.Mail) error {
+	const op = "database.auth.CreatePasswordResetToken"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO password_reset_token (token_hash, user_id, email, app_id, locale, expires_at)
+		SELECT $1, $2, $3, NULLIF($4, 0), $5, $6
+		WHERE NOT EXISTS (
+			SELECT 1 FROM password_reset_token
+			WHERE user_id = $2 AND created_at > now() - make_interval(secs => $7)
+		);
+	`
+
+	a.log.Debug("create password reset token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q,
+		token.TokenHash,
+		token.UserID,
+		token.Email,
+		token.AppID,
+		token.Locale,
+		token.ExpiresAt,
+		resendInterval.Seconds(),
+	)
+	if err != nil {
+		a.log.Error("failed to create password reset token", sl.OpErr(op, err))
+		return errors.New("failed to create password reset token")
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Info("password reset token created recently", slog.String("op", op), slog.Int64("id", token.UserID))
+		return database.ErrConflict
+	}
+
+	if err := outbox.Add(ctx, tx, mail); err != nil {
+		a.log.Error("failed to add password reset mail to outbox", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("password reset token created", slog.String("op", op), slog.Int64("id", token.UserID))
+	return nil
+}
+
+// GetPasswordResetToken returns the password reset token. It returns
+// database.ErrNotFound if there is no such token, or it expired or was
+// used before.
+func (a *AuthDB) GetPasswordResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	const op = "database.auth.GetPasswordResetToken"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.PasswordResetToken{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT token_hash, user_id, email, COALESCE(app_id, 0), locale, expires_at FROM password_reset_token
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > now();
+	`
+
+	a.log.Debug("get password reset token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var token models.PasswordResetToken
+	err = tx.QueryRow(ctx, q, tokenHash).Scan(
+		&token.TokenHash,
+		&token.UserID,
+		&token.Email,
+		&token.AppID,
+		&token.Locale,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			a.log.Error("password reset token not found", slog.String("op", op))
+			return models.PasswordResetToken{}, database.ErrNotFound
+		}
+		a.log.Error("failed to get password reset token", sl.OpErr(op, err))
+		return models.PasswordResetToken{}, err
+	}
+
+	return token, nil
+}
+
+// ResetPassword uses up the password reset token, replaces the password
+// hash of its user and puts the notice about it into the outbox. The mail
+// with the token reached the user, so the email counts as verified from
+// then on. The other reset tokens of the user are used up as well, the
+// sessions of the user are ended and impersonation tokens of the user
+// issued within impersonationExpires are revoked, all in the same
+// transaction. It returns database.ErrNotFound if there is no such token,
+// it expired or was used before, or the user changed the email since it was
+// created.
+func (a *AuthDB) ResetPassword(ctx context.Context, tokenHash string, passHash string, impersonationExpires time.Duration, notice models.Mail) (int64, error) {
+	const op = "database.auth.ResetPassword"
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		a.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE password_reset_token SET consumed_at = now()
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > now()
+		RETURNING user_id, email;
+	`
+
+	a.log.Debug("consume password reset token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var (
+		userID int64
+		email  string
+	)
+	if err := tx.QueryRow(ctx, q, tokenHash).Scan(&userID, &email); err != nil {
+		if err == pgx.ErrNoRows {
+			a.log.Error("password reset token not found", slog.String("op", op))
+			return 0, database.ErrNotFound
+		}
+		a.log.Error("failed to consume password reset token", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	q = `
+		UPDATE public.user SET hash_password = $3, email_verified = TRUE WHERE id = $1 AND email = $2;
+	`
+
+	a.log.Debug("reset password query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userID, email, passHash)
+	if err != nil {
+		a.log.Error("failed to reset password", sl.OpErr(op, err))
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		a.log.Error("email changed since the token was created", slog.String("op", op), slog.Int64("id", userID))
+		return 0, database.ErrNotFound
+	}
+
+	q = `
+		UPDATE password_reset_token SET consumed_at = now()
+		WHERE user_id = $1 AND consumed_at IS NULL;
+	`
+
+	a.log.Debug("consume user password reset tokens query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID); err != nil {
+		a.log.Error("failed to consume password reset tokens", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	q = `
+		WITH ended AS (
+			UPDATE session SET ended_at = now()
+			WHERE user_id = $1 AND ended_at IS NULL
+		)
+		UPDATE refresh_token SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`
+
+	a.log.Debug("end user sessions query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID); err != nil {
+		a.log.Error("failed to end user sessions", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	// Impersonation tokens have no session, so they are revoked one by one.
+	q = `
+		INSERT INTO revoked_token (jti, user_id, app_id, revoked_by, expires_at)
+		SELECT token_id, user_id, app_id, user_id, created_at + make_interval(secs => $3)
+		FROM impersonation_audit
+		WHERE user_id = $1 AND event = $2 AND created_at > now() - make_interval(secs => $3)
+		ON CONFLICT (jti) DO NOTHING;
+	`
+
+	a.log.Debug("revoke impersonation tokens query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID, models.ImpersonationIssued, impersonationExpires.Seconds()); err != nil {
+		a.log.Error("failed to revoke impersonation tokens", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := outbox.Add(ctx, tx, notice); err != nil {
+		a.log.Error("failed to add password reset notice to outbox", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		a.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	a.log.Info("password reset", slog.String("op", op), slog.Int64("id", userID))
+	return userID, nil
 }
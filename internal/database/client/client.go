@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ClientDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewClientDB(pool *pgxpool.Pool, log *slog.Logger) *ClientDB {
+	return &ClientDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (c *ClientDB) CreateServiceClient(ctx context.Context, client models.ServiceClient) error {
+	const op = "database.client.CreateServiceClient"
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		c.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO service_client (id, app_id, name, secret_hash, scope, audiences)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6::integer[], '{}'));
+	`
+
+	c.log.Debug("create service client query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q, client.ID, client.AppID, client.Name, client.SecretHash, client.Scope, client.Audiences)
+	if err != nil {
+		c.log.Error("failed to create service client", sl.OpErr(op, err))
+		return errors.New("failed to create service client")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	c.log.Info("new service client created", slog.String("op", op), slog.String("id", client.ID), slog.Int("app_id", client.AppID))
+	return nil
+}
+
+// GetServiceClient returns the client unless it or its app was deleted.
+func (c *ClientDB) GetServiceClient(ctx context.Context, clientID string) (models.ServiceClient, error) {
+	const op = "database.client.GetServiceClient"
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		c.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.ServiceClient{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT c.id, c.app_id, c.name, c.secret_hash, c.scope, c.audiences, c.created_at
+		FROM service_client c
+		JOIN app a ON a.id = c.app_id
+		WHERE c.id = $1 AND a.deleted_at IS NULL;
+	`
+
+	c.log.Debug("get service client query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var client models.ServiceClient
+	err = tx.QueryRow(ctx, q, clientID).Scan(
+		&client.ID,
+		&client.AppID,
+		&client.Name,
+		&client.SecretHash,
+		&client.Scope,
+		&client.Audiences,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.log.Error("service client not found", slog.String("op", op), slog.String("id", clientID))
+			return models.ServiceClient{}, database.ErrNotFound
+		}
+		c.log.Error("failed to get service client", sl.OpErr(op, err))
+		return models.ServiceClient{}, err
+	}
+
+	c.log.Info("successfully get service client", slog.String("op", op), slog.String("id", clientID))
+	return client, nil
+}
+
+// UpdateServiceClientSecretHash replaces the secret hash of the client. It
+// returns database.ErrConflict if the hash is no longer oldHash.
+func (c *ClientDB) UpdateServiceClientSecretHash(ctx context.Context, clientID string, oldHash string, secretHash string) error {
+	const op = "database.client.UpdateServiceClientSecretHash"
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		c.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE service_client SET secret_hash = $3 WHERE id = $1 AND secret_hash = $2;
+	`
+
+	c.log.Debug("update service client secret hash query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, clientID, oldHash, secretHash)
+	if err != nil {
+		c.log.Error("failed to update service client secret hash", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		c.log.Error("service client secret hash changed", slog.String("op", op), slog.String("id", clientID))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	c.log.Info("service client secret hash updated", slog.String("op", op), slog.String("id", clientID))
+	return nil
+}
+
+func (c *ClientDB) DeleteServiceClient(ctx context.Context, clientID string) error {
+	const op = "database.client.DeleteServiceClient"
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		c.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		DELETE FROM service_client WHERE id = $1;
+	`
+
+	c.log.Debug("delete service client query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, clientID)
+	if err != nil {
+		c.log.Error("failed to delete service client", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		c.log.Error("service client not found", slog.String("op", op), slog.String("id", clientID))
+		return database.ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	c.log.Info("service client deleted", slog.String("op", op), slog.String("id", clientID))
+	return nil
+}
@@ -0,0 +1,462 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Cipher encrypts the TOTP secrets before they are stored and decrypts
+// them when they are read.
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, value string) (string, error)
+	NeedsReencrypt(value string) bool
+}
+
+type MFADB struct {
+	pool   *pgxpool.Pool
+	log    *slog.Logger
+	cipher Cipher
+}
+
+func NewMFADB(pool *pgxpool.Pool, log *slog.Logger, cipher Cipher) *MFADB {
+	return &MFADB{
+		pool:   pool,
+		log:    log,
+		cipher: cipher,
+	}
+}
+
+// SaveTOTP stores a new, unconfirmed TOTP secret for the user, replacing an
+// earlier unconfirmed one. It returns database.ErrConflict if the user
+// already confirmed a TOTP authenticator.
+func (m *MFADB) SaveTOTP(ctx context.Context, userID int64, secret string) error {
+	const op = "database.mfa.SaveTOTP"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO mfa_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_used_step = 0, created_at = now()
+		WHERE mfa_totp.confirmed_at IS NULL;
+	`
+
+	m.log.Debug("save totp query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	encrypted, err := m.cipher.Encrypt(ctx, secret)
+	if err != nil {
+		m.log.Error("failed to encrypt totp secret", sl.OpErr(op, err))
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, q, userID, encrypted)
+	if err != nil {
+		m.log.Error("failed to save totp", sl.OpErr(op, err))
+		return errors.New("failed to save totp")
+	}
+	if tag.RowsAffected() == 0 {
+		m.log.Error("totp already confirmed", slog.String("op", op), slog.Int64("user_id", userID))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	m.log.Info("totp saved", slog.String("op", op), slog.Int64("user_id", userID))
+	return nil
+}
+
+func (m *MFADB) GetTOTP(ctx context.Context, userID int64) (models.TOTPFactor, error) {
+	const op = "database.mfa.GetTOTP"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.TOTPFactor{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT user_id, secret, last_used_step, confirmed_at, created_at
+		FROM mfa_totp WHERE user_id = $1;
+	`
+
+	m.log.Debug("get totp query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var factor models.TOTPFactor
+	err = tx.QueryRow(ctx, q, userID).Scan(
+		&factor.UserID,
+		&factor.Secret,
+		&factor.LastUsedStep,
+		&factor.ConfirmedAt,
+		&factor.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return models.TOTPFactor{}, database.ErrNotFound
+		}
+		m.log.Error("failed to get totp", sl.OpErr(op, err))
+		return models.TOTPFactor{}, err
+	}
+
+	factor.Secret, err = m.cipher.Decrypt(ctx, factor.Secret)
+	if err != nil {
+		m.log.Error("failed to decrypt totp secret", sl.OpErr(op, err), slog.Int64("user_id", userID))
+		return models.TOTPFactor{}, err
+	}
+
+	return factor, nil
+}
+
+// ConfirmTOTP marks the TOTP authenticator of the user as enrolled, with
+// the step of the code it was confirmed with as used, and replaces the
+// recovery codes of the user. It returns database.ErrConflict if the
+// authenticator was confirmed before.
+func (m *MFADB) ConfirmTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error {
+	const op = "database.mfa.ConfirmTOTP"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mfa_totp SET confirmed_at = now(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL;
+	`
+
+	m.log.Debug("confirm totp query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userID, step)
+	if err != nil {
+		m.log.Error("failed to confirm totp", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		m.log.Error("totp already confirmed", slog.String("op", op), slog.Int64("user_id", userID))
+		return database.ErrConflict
+	}
+
+	q = `
+		DELETE FROM mfa_recovery_code WHERE user_id = $1;
+	`
+
+	m.log.Debug("delete recovery codes query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID); err != nil {
+		m.log.Error("failed to delete recovery codes", sl.OpErr(op, err))
+		return err
+	}
+
+	q = `
+		INSERT INTO mfa_recovery_code (user_id, code_hash) VALUES ($1, $2);
+	`
+
+	m.log.Debug("create recovery code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, q, userID, codeHash); err != nil {
+			m.log.Error("failed to create recovery code", sl.OpErr(op, err))
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	m.log.Info("totp confirmed", slog.String("op", op), slog.Int64("user_id", userID))
+	return nil
+}
+
+// UseTOTPStep records that a code of the step was accepted. It returns
+// database.ErrConflict if a code of the step or a later one was accepted
+// before, which is how a code is refused when presented again.
+func (m *MFADB) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	const op = "database.mfa.UseTOTPStep"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mfa_totp SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2;
+	`
+
+	m.log.Debug("use totp step query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userID, step)
+	if err != nil {
+		m.log.Error("failed to use totp step", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		m.log.Error("totp step already used", slog.String("op", op), slog.Int64("user_id", userID))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the unused recovery code of the user with the hash
+// as used. It returns database.ErrNotFound if there is no such code.
+func (m *MFADB) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	const op = "database.mfa.UseRecoveryCode"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mfa_recovery_code SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+	`
+
+	m.log.Debug("use recovery code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userID, codeHash)
+	if err != nil {
+		m.log.Error("failed to use recovery code", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		m.log.Error("recovery code not found", slog.String("op", op), slog.Int64("user_id", userID))
+		return database.ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	m.log.Info("recovery code used", slog.String("op", op), slog.Int64("user_id", userID))
+	return nil
+}
+
+func (m *MFADB) CreateMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error {
+	const op = "database.mfa.CreateMFAChallenge"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO mfa_challenge (challenge_hash, user_id, app_id, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	m.log.Debug("create mfa challenge query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q, challenge.ChallengeHash, challenge.UserID, challenge.AppID, challenge.Scope, challenge.ExpiresAt)
+	if err != nil {
+		m.log.Error("failed to create mfa challenge", sl.OpErr(op, err))
+		return errors.New("failed to create mfa challenge")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	m.log.Info("mfa challenge created", slog.String("op", op), slog.Int64("user_id", challenge.UserID), slog.Int("app_id", challenge.AppID))
+	return nil
+}
+
+// AttemptMFAChallenge counts an attempt to answer the challenge and
+// returns it. Every attempt counts, so that parallel guesses cannot get
+// past maxAttempts. It returns database.ErrNotFound if the challenge does
+// not exist, expired, was answered or has no attempts left.
+func (m *MFADB) AttemptMFAChallenge(ctx context.Context, challengeHash string, maxAttempts int) (models.MFAChallenge, error) {
+	const op = "database.mfa.AttemptMFAChallenge"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.MFAChallenge{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mfa_challenge SET attempts = attempts + 1
+		WHERE challenge_hash = $1 AND consumed_at IS NULL AND expires_at > now() AND attempts < $2
+		RETURNING challenge_hash, user_id, app_id, scope, attempts, expires_at, consumed_at;
+	`
+
+	m.log.Debug("attempt mfa challenge query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var challenge models.MFAChallenge
+	err = tx.QueryRow(ctx, q, challengeHash, maxAttempts).Scan(
+		&challenge.ChallengeHash,
+		&challenge.UserID,
+		&challenge.AppID,
+		&challenge.Scope,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&challenge.ConsumedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			m.log.Error("mfa challenge not found", slog.String("op", op))
+			return models.MFAChallenge{}, database.ErrNotFound
+		}
+		m.log.Error("failed to attempt mfa challenge", sl.OpErr(op, err))
+		return models.MFAChallenge{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return models.MFAChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// ConsumeMFAChallenge marks the challenge as answered. It returns
+// database.ErrConflict if it was answered before.
+func (m *MFADB) ConsumeMFAChallenge(ctx context.Context, challengeHash string) error {
+	const op = "database.mfa.ConsumeMFAChallenge"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mfa_challenge SET consumed_at = now()
+		WHERE challenge_hash = $1 AND consumed_at IS NULL;
+	`
+
+	m.log.Debug("consume mfa challenge query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, challengeHash)
+	if err != nil {
+		m.log.Error("failed to consume mfa challenge", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		m.log.Error("mfa challenge already consumed", slog.String("op", op))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// ReencryptTOTPSecrets encrypts the TOTP secrets that are stored in
+// plaintext or under an old master key with the current master key. It
+// returns the number of secrets re-encrypted.
+func (m *MFADB) ReencryptTOTPSecrets(ctx context.Context) (int, error) {
+	const op = "database.mfa.ReencryptTOTPSecrets"
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		m.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT user_id, secret FROM mfa_totp FOR UPDATE;
+	`
+
+	m.log.Debug("get totp secrets query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		m.log.Error("failed to get totp secrets", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	secrets := make(map[int64]string)
+	for rows.Next() {
+		var (
+			userID int64
+			value  string
+		)
+		if err := rows.Scan(&userID, &value); err != nil {
+			rows.Close()
+			m.log.Error("failed to scan totp secret", sl.OpErr(op, err))
+			return 0, err
+		}
+		if m.cipher.NeedsReencrypt(value) {
+			secrets[userID] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		m.log.Error("failed to read totp secrets", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	q = `
+		UPDATE mfa_totp SET secret = $2 WHERE user_id = $1;
+	`
+
+	m.log.Debug("update totp secret query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	for userID, value := range secrets {
+		plaintext, err := m.cipher.Decrypt(ctx, value)
+		if err != nil {
+			m.log.Error("failed to decrypt totp secret", sl.OpErr(op, err), slog.Int64("user_id", userID))
+			return 0, err
+		}
+
+		encrypted, err := m.cipher.Encrypt(ctx, plaintext)
+		if err != nil {
+			m.log.Error("failed to encrypt totp secret", sl.OpErr(op, err), slog.Int64("user_id", userID))
+			return 0, err
+		}
+
+		if _, err := tx.Exec(ctx, q, userID, encrypted); err != nil {
+			m.log.Error("failed to update totp secret", sl.OpErr(op, err), slog.Int64("user_id", userID))
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		m.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	m.log.Info("totp secrets re-encrypted", slog.String("op", op), slog.Int("count", len(secrets)))
+	return len(secrets), nil
+}
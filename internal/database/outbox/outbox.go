@@ -0,0 +1,202 @@
+package outbox
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OutboxDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewOutboxDB(pool *pgxpool.Pool, log *slog.Logger) *OutboxDB {
+	return &OutboxDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+// Add puts the mail into the outbox as part of tx, so that it is only
+// delivered if the transaction that triggered it commits.
+func Add(ctx context.Context, tx pgx.Tx, mail models.Mail) error {
+	q := `
+		INSERT INTO mail_outbox (recipient, subject, text_body, html_body)
+		VALUES ($1, $2, $3, $4);
+	`
+
+	_, err := tx.Exec(ctx, q, mail.To, mail.Subject, mail.Text, mail.HTML)
+	return err
+}
+
+// ClaimMail returns up to limit mails that are due for delivery and counts
+// the attempt. The mails are not due again for the lease, so that other
+// instances skip them while they are sent, and a mail whose sender died is
+// retried once it ends.
+func (o *OutboxDB) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	const op = "database.outbox.ClaimMail"
+
+	tx, err := o.pool.Begin(ctx)
+	if err != nil {
+		o.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mail_outbox SET attempts = attempts + 1, next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM mail_outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, subject, text_body, html_body, attempts, created_at;
+	`
+
+	o.log.Debug("claim mail query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		o.log.Error("failed to claim mail", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mails []models.OutboxMail
+	for rows.Next() {
+		var mail models.OutboxMail
+		err := rows.Scan(
+			&mail.ID,
+			&mail.Mail.To,
+			&mail.Mail.Subject,
+			&mail.Mail.Text,
+			&mail.Mail.HTML,
+			&mail.Attempts,
+			&mail.CreatedAt,
+		)
+		if err != nil {
+			o.log.Error("failed to scan mail", sl.OpErr(op, err))
+			return nil, err
+		}
+		mails = append(mails, mail)
+	}
+	if err := rows.Err(); err != nil {
+		o.log.Error("failed to read mail", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		o.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	return mails, nil
+}
+
+// MarkMailSent records the delivery of the mail. Its bodies are cleared,
+// since they may hold links with secret tokens.
+func (o *OutboxDB) MarkMailSent(ctx context.Context, id int64) error {
+	const op = "database.outbox.MarkMailSent"
+
+	tx, err := o.pool.Begin(ctx)
+	if err != nil {
+		o.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mail_outbox SET sent_at = now(), text_body = '', html_body = '', last_error = ''
+		WHERE id = $1;
+	`
+
+	o.log.Debug("mark mail sent query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, id); err != nil {
+		o.log.Error("failed to mark mail sent", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		o.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	o.log.Info("mail sent", slog.String("op", op), slog.Int64("mail_id", id))
+	return nil
+}
+
+// RetryMail records a failed delivery of the mail and tries it again after
+// delay.
+func (o *OutboxDB) RetryMail(ctx context.Context, id int64, lastError string, delay time.Duration) error {
+	const op = "database.outbox.RetryMail"
+
+	tx, err := o.pool.Begin(ctx)
+	if err != nil {
+		o.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mail_outbox SET next_attempt_at = now() + make_interval(secs => $3), last_error = $2
+		WHERE id = $1;
+	`
+
+	o.log.Debug("retry mail query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, id, lastError, delay.Seconds()); err != nil {
+		o.log.Error("failed to retry mail", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		o.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	o.log.Info("mail delivery postponed", slog.String("op", op), slog.Int64("mail_id", id), slog.Duration("delay", delay))
+	return nil
+}
+
+// FailMail gives up on the mail after its last failed delivery. Its bodies
+// are cleared as for sent mail.
+func (o *OutboxDB) FailMail(ctx context.Context, id int64, lastError string) error {
+	const op = "database.outbox.FailMail"
+
+	tx, err := o.pool.Begin(ctx)
+	if err != nil {
+		o.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE mail_outbox SET failed_at = now(), text_body = '', html_body = '', last_error = $2
+		WHERE id = $1;
+	`
+
+	o.log.Debug("fail mail query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, id, lastError); err != nil {
+		o.log.Error("failed to mark mail failed", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		o.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	o.log.Warn("mail delivery failed for good", slog.String("op", op), slog.Int64("mail_id", id))
+	return nil
+}
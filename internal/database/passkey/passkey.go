@@ -0,0 +1,288 @@
+package passkey
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PasskeyDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewPasskeyDB(pool *pgxpool.Pool, log *slog.Logger) *PasskeyDB {
+	return &PasskeyDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (p *PasskeyDB) CreatePasskeyChallenge(ctx context.Context, challenge models.PasskeyChallenge) error {
+	const op = "database.passkey.CreatePasskeyChallenge"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO passkey_challenge (challenge_hash, kind, user_id, app_id, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	p.log.Debug("create passkey challenge query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q,
+		challenge.ChallengeHash,
+		challenge.Kind,
+		challenge.UserID,
+		challenge.AppID,
+		challenge.Scope,
+		challenge.ExpiresAt,
+	)
+	if err != nil {
+		p.log.Error("failed to create passkey challenge", sl.OpErr(op, err))
+		return errors.New("failed to create passkey challenge")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		p.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	p.log.Info("passkey challenge created", slog.String("op", op), slog.String("kind", challenge.Kind), slog.Int("app_id", challenge.AppID))
+	return nil
+}
+
+// ConsumePasskeyChallenge marks the challenge of the kind as used and
+// returns it. It returns database.ErrNotFound if there is no such
+// challenge, or it expired or was used before.
+func (p *PasskeyDB) ConsumePasskeyChallenge(ctx context.Context, challengeHash string, kind string) (models.PasskeyChallenge, error) {
+	const op = "database.passkey.ConsumePasskeyChallenge"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.PasskeyChallenge{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE passkey_challenge SET consumed_at = now()
+		WHERE challenge_hash = $1 AND kind = $2 AND consumed_at IS NULL AND expires_at > now()
+		RETURNING challenge_hash, kind, user_id, app_id, scope, expires_at;
+	`
+
+	p.log.Debug("consume passkey challenge query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var challenge models.PasskeyChallenge
+	err = tx.QueryRow(ctx, q, challengeHash, kind).Scan(
+		&challenge.ChallengeHash,
+		&challenge.Kind,
+		&challenge.UserID,
+		&challenge.AppID,
+		&challenge.Scope,
+		&challenge.ExpiresAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			p.log.Error("passkey challenge not found", slog.String("op", op))
+			return models.PasskeyChallenge{}, database.ErrNotFound
+		}
+		p.log.Error("failed to consume passkey challenge", sl.OpErr(op, err))
+		return models.PasskeyChallenge{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		p.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return models.PasskeyChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// CreatePasskey stores a new passkey. It returns database.ErrConflict if
+// the credential is registered already.
+func (p *PasskeyDB) CreatePasskey(ctx context.Context, passkey models.Passkey) error {
+	const op = "database.passkey.CreatePasskey"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO passkey (credential_id, user_id, name, public_key, algorithm, sign_count, transports, aaguid, backup_eligible, backed_up)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+	`
+
+	p.log.Debug("create passkey query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q,
+		passkey.CredentialID,
+		passkey.UserID,
+		passkey.Name,
+		passkey.PublicKey,
+		passkey.Algorithm,
+		int64(passkey.SignCount),
+		passkey.Transports,
+		passkey.AAGUID,
+		passkey.BackupEligible,
+		passkey.BackedUp,
+	)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			p.log.Error("passkey already exists", slog.String("op", op))
+			return database.ErrConflict
+		}
+		p.log.Error("failed to create passkey", sl.OpErr(op, err))
+		return errors.New("failed to create passkey")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		p.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	p.log.Info("new passkey created", slog.String("op", op), slog.Int64("user_id", passkey.UserID))
+	return nil
+}
+
+func (p *PasskeyDB) GetPasskey(ctx context.Context, credentialID []byte) (models.Passkey, error) {
+	const op = "database.passkey.GetPasskey"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.Passkey{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT credential_id, user_id, name, public_key, algorithm, sign_count, transports, aaguid, backup_eligible, backed_up, last_used_at, created_at
+		FROM passkey WHERE credential_id = $1;
+	`
+
+	p.log.Debug("get passkey query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	passkey, err := scanPasskey(tx.QueryRow(ctx, q, credentialID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			p.log.Error("passkey not found", slog.String("op", op))
+			return models.Passkey{}, database.ErrNotFound
+		}
+		p.log.Error("failed to get passkey", sl.OpErr(op, err))
+		return models.Passkey{}, err
+	}
+
+	return passkey, nil
+}
+
+func (p *PasskeyDB) GetUserPasskeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	const op = "database.passkey.GetUserPasskeys"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT credential_id, user_id, name, public_key, algorithm, sign_count, transports, aaguid, backup_eligible, backed_up, last_used_at, created_at
+		FROM passkey WHERE user_id = $1 ORDER BY created_at;
+	`
+
+	p.log.Debug("get user passkeys query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, userID)
+	if err != nil {
+		p.log.Error("failed to get user passkeys", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			p.log.Error("failed to scan passkey", sl.OpErr(op, err))
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		p.log.Error("failed to read user passkeys", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// UpdatePasskeyUse records a login with the passkey and the signature
+// counter and backup state the authenticator sent with it.
+func (p *PasskeyDB) UpdatePasskeyUse(ctx context.Context, credentialID []byte, signCount uint32, backedUp bool) error {
+	const op = "database.passkey.UpdatePasskeyUse"
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		p.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE passkey SET sign_count = $2, backed_up = $3, last_used_at = now()
+		WHERE credential_id = $1;
+	`
+
+	p.log.Debug("update passkey use query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, credentialID, int64(signCount), backedUp); err != nil {
+		p.log.Error("failed to update passkey use", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		p.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+func scanPasskey(row pgx.Row) (models.Passkey, error) {
+	var (
+		passkey   models.Passkey
+		signCount int64
+	)
+	err := row.Scan(
+		&passkey.CredentialID,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.PublicKey,
+		&passkey.Algorithm,
+		&signCount,
+		&passkey.Transports,
+		&passkey.AAGUID,
+		&passkey.BackupEligible,
+		&passkey.BackedUp,
+		&passkey.LastUsedAt,
+		&passkey.CreatedAt,
+	)
+	passkey.SignCount = uint32(signCount)
+
+	return passkey, err
+}
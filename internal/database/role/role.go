@@ -0,0 +1,184 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RoleDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewRoleDB(pool *pgxpool.Pool, log *slog.Logger) *RoleDB {
+	return &RoleDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (r *RoleDB) GetRole(ctx context.Context, appID int, name string) (models.Role, error) {
+	const op = "database.role.GetRole"
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.Role{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT r.id, r.app_id, r.name, r.description, r.created_at,
+			COALESCE(array_agg(p.permission ORDER BY p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM role r
+		LEFT JOIN role_permission p ON p.role_id = r.id
+		WHERE r.app_id = $1 AND r.name = $2
+		GROUP BY r.id;
+	`
+
+	r.log.Debug("get role query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var role models.Role
+	err = tx.QueryRow(ctx, q, appID, name).Scan(
+		&role.ID,
+		&role.AppID,
+		&role.Name,
+		&role.Description,
+		&role.CreatedAt,
+		&role.Permissions,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			r.log.Error("role not found", slog.String("op", op), slog.Int("app_id", appID), slog.String("name", name))
+			return models.Role{}, database.ErrNotFound
+		}
+		r.log.Error("failed to get role", sl.OpErr(op, err))
+		return models.Role{}, err
+	}
+
+	r.log.Info("successfully get role", slog.String("op", op), slog.Int("id", role.ID))
+	return role, nil
+}
+
+// GetUserRoles returns the roles the user has in the app with their
+// permissions, ordered by name.
+func (r *RoleDB) GetUserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "database.role.GetUserRoles"
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT r.id, r.app_id, r.name, r.description, r.created_at,
+			COALESCE(array_agg(p.permission ORDER BY p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM user_role ur
+		JOIN role r ON r.id = ur.role_id
+		LEFT JOIN role_permission p ON p.role_id = r.id
+		WHERE ur.user_id = $1 AND r.app_id = $2
+		GROUP BY r.id
+		ORDER BY r.name;
+	`
+
+	r.log.Debug("get user roles query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, userID, appID)
+	if err != nil {
+		r.log.Error("failed to get user roles", sl.OpErr(op, err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &role.Permissions); err != nil {
+			r.log.Error("failed to scan role", sl.OpErr(op, err))
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		r.log.Error("failed to read user roles", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	r.log.Info("successfully get user roles", slog.String("op", op), slog.Int64("user_id", userID), slog.Int("count", len(roles)))
+	return roles, nil
+}
+
+// AssignRole assigns the role to the user. Assigning a role the user
+// already has succeeds.
+func (r *RoleDB) AssignRole(ctx context.Context, userID int64, roleID int) error {
+	const op = "database.role.AssignRole"
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO user_role (user_id, role_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+
+	r.log.Debug("assign role query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID, roleID); err != nil {
+		r.log.Error("failed to assign role", sl.OpErr(op, err))
+		return errors.New("failed to assign role")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	r.log.Info("role assigned", slog.String("op", op), slog.Int64("user_id", userID), slog.Int("role_id", roleID))
+	return nil
+}
+
+// UnassignRole takes the role from the user. Taking a role the user does
+// not have succeeds.
+func (r *RoleDB) UnassignRole(ctx context.Context, userID int64, roleID int) error {
+	const op = "database.role.UnassignRole"
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		DELETE FROM user_role WHERE user_id = $1 AND role_id = $2;
+	`
+
+	r.log.Debug("unassign role query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, userID, roleID); err != nil {
+		r.log.Error("failed to unassign role", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	r.log.Info("role unassigned", slog.String("op", op), slog.Int64("user_id", userID), slog.Int("role_id", roleID))
+	return nil
+}
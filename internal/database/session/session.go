@@ -0,0 +1,224 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewSessionDB(pool *pgxpool.Pool, log *slog.Logger) *SessionDB {
+	return &SessionDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (s *SessionDB) CreateSession(ctx context.Context, session models.Session) error {
+	const op = "database.session.CreateSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO session (id, user_id, app_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	s.log.Debug("create session query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q, session.ID, session.UserID, session.AppID, session.UserAgent, session.IP)
+	if err != nil {
+		s.log.Error("failed to create session", sl.OpErr(op, err))
+		return errors.New("failed to create session")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	s.log.Info("new session created", slog.String("op", op), slog.String("id", session.ID), slog.Int64("user_id", session.UserID))
+	return nil
+}
+
+func (s *SessionDB) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	const op = "database.session.GetSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.Session{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT id, user_id, app_id, user_agent, ip, created_at, last_seen_at, ended_at
+		FROM session WHERE id = $1;
+	`
+
+	s.log.Debug("get session query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var session models.Session
+	err = tx.QueryRow(ctx, q, sessionID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.AppID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.EndedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.log.Error("session not found", slog.String("op", op), slog.String("id", sessionID))
+			return models.Session{}, database.ErrNotFound
+		}
+		s.log.Error("failed to get session", sl.OpErr(op, err))
+		return models.Session{}, err
+	}
+
+	s.log.Info("successfully get session", slog.String("op", op), slog.String("id", sessionID))
+	return session, nil
+}
+
+func (s *SessionDB) TouchSession(ctx context.Context, sessionID string) error {
+	const op = "database.session.TouchSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE session SET last_seen_at = now() WHERE id = $1 AND ended_at IS NULL;
+	`
+
+	s.log.Debug("touch session query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, sessionID); err != nil {
+		s.log.Error("failed to touch session", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// EndSession ends the session and revokes the refresh tokens issued for it.
+func (s *SessionDB) EndSession(ctx context.Context, sessionID string) error {
+	const op = "database.session.EndSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE session SET ended_at = now() WHERE id = $1 AND ended_at IS NULL;
+	`
+
+	s.log.Debug("end session query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, sessionID); err != nil {
+		s.log.Error("failed to end session", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := s.revokeRefreshTokens(ctx, tx, []string{sessionID}); err != nil {
+		s.log.Error("failed to revoke refresh tokens", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	s.log.Info("session ended", slog.String("op", op), slog.String("id", sessionID))
+	return nil
+}
+
+// EndUserSessions ends every open session of the user and revokes their
+// refresh tokens. It returns the number of sessions ended.
+func (s *SessionDB) EndUserSessions(ctx context.Context, userID int64) (int64, error) {
+	const op = "database.session.EndUserSessions"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE session SET ended_at = now()
+		WHERE user_id = $1 AND ended_at IS NULL
+		RETURNING id;
+	`
+
+	s.log.Debug("end user sessions query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	rows, err := tx.Query(ctx, q, userID)
+	if err != nil {
+		s.log.Error("failed to end user sessions", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		s.log.Error("failed to read ended sessions", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := s.revokeRefreshTokens(ctx, tx, ids); err != nil {
+		s.log.Error("failed to revoke refresh tokens", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	s.log.Info("user sessions ended", slog.String("op", op), slog.Int64("user_id", userID), slog.Int("count", len(ids)))
+	return int64(len(ids)), nil
+}
+
+func (s *SessionDB) revokeRefreshTokens(ctx context.Context, tx pgx.Tx, sessionIDs []string) error {
+	const op = "database.session.revokeRefreshTokens"
+
+	q := `
+		UPDATE refresh_token SET revoked_at = now()
+		WHERE family_id = ANY($1) AND revoked_at IS NULL;
+	`
+
+	s.log.Debug("revoke refresh tokens query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err := tx.Exec(ctx, q, sessionIDs)
+	return err
+}
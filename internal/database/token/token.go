@@ -0,0 +1,721 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/database/query"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TokenDB struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewTokenDB(pool *pgxpool.Pool, log *slog.Logger) *TokenDB {
+	return &TokenDB{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (t *TokenDB) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	const op = "database.token.CreateRefreshToken"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := t.insertRefreshToken(ctx, tx, token); err != nil {
+		t.log.Error("failed to create refresh token", sl.OpErr(op, err))
+		return errors.New("failed to create refresh token")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("new refresh token created", slog.String("op", op), slog.String("family_id", token.FamilyID))
+	return nil
+}
+
+func (t *TokenDB) GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "database.token.GetRefreshToken"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.RefreshToken{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT id, token_hash, family_id, user_id, app_id, scope, expires_at, consumed_at, revoked_at, created_at
+		FROM refresh_token WHERE token_hash = $1;
+	`
+
+	t.log.Debug("get refresh token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var token models.RefreshToken
+	err = tx.QueryRow(ctx, q, tokenHash).Scan(
+		&token.ID,
+		&token.TokenHash,
+		&token.FamilyID,
+		&token.UserID,
+		&token.AppID,
+		&token.Scope,
+		&token.ExpiresAt,
+		&token.ConsumedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			t.log.Error("refresh token not found", slog.String("op", op))
+			return models.RefreshToken{}, database.ErrNotFound
+		}
+		t.log.Error("failed to get refresh token", sl.OpErr(op, err))
+		return models.RefreshToken{}, err
+	}
+
+	t.log.Info("successfully get refresh token", slog.String("op", op), slog.String("family_id", token.FamilyID))
+	return token, nil
+}
+
+// RotateRefreshToken marks the token as consumed and stores its successor in
+// one transaction. It returns database.ErrConflict if the token was consumed
+// or revoked in the meantime.
+func (t *TokenDB) RotateRefreshToken(ctx context.Context, tokenHash string, next models.RefreshToken) error {
+	const op = "database.token.RotateRefreshToken"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE refresh_token SET consumed_at = now()
+		WHERE token_hash = $1 AND consumed_at IS NULL AND revoked_at IS NULL;
+	`
+
+	t.log.Debug("consume refresh token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, tokenHash)
+	if err != nil {
+		t.log.Error("failed to consume refresh token", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		t.log.Error("refresh token already consumed", slog.String("op", op))
+		return database.ErrConflict
+	}
+
+	if err := t.insertRefreshToken(ctx, tx, next); err != nil {
+		t.log.Error("failed to create refresh token", sl.OpErr(op, err))
+		return errors.New("failed to create refresh token")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("refresh token rotated", slog.String("op", op), slog.String("family_id", next.FamilyID))
+	return nil
+}
+
+// RevokeAccessToken adds the token to the revocation list and drops entries
+// of tokens that have expired since. Revoking a token twice keeps the first
+// entry.
+func (t *TokenDB) RevokeAccessToken(ctx context.Context, token models.RevokedToken) error {
+	const op = "database.token.RevokeAccessToken"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO revoked_token (jti, user_id, client_id, app_id, revoked_by, revoked_by_client, expires_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, NULLIF($5, 0), NULLIF($6, ''), $7)
+		ON CONFLICT (jti) DO NOTHING;
+	`
+
+	t.log.Debug("revoke access token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q,
+		token.TokenID,
+		token.UserID,
+		token.ClientID,
+		token.AppID,
+		token.RevokedBy,
+		token.RevokedByClient,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		t.log.Error("failed to revoke access token", sl.OpErr(op, err))
+		return errors.New("failed to revoke access token")
+	}
+
+	q = `
+		DELETE FROM revoked_token WHERE expires_at < now();
+	`
+
+	t.log.Debug("delete expired revoked tokens query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q); err != nil {
+		t.log.Error("failed to delete expired revoked tokens", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("access token revoked",
+		slog.String("op", op),
+		slog.String("jti", token.TokenID),
+		slog.Int64("user_id", token.UserID),
+		slog.String("client_id", token.ClientID),
+	)
+	return nil
+}
+
+// GetRevokedToken returns the revocation list entry of the token or
+// database.ErrNotFound if the token is not revoked.
+func (t *TokenDB) GetRevokedToken(ctx context.Context, tokenID string) (models.RevokedToken, error) {
+	const op = "database.token.GetRevokedToken"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.RevokedToken{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT jti, COALESCE(user_id, 0), COALESCE(client_id, ''), app_id,
+			COALESCE(revoked_by, 0), COALESCE(revoked_by_client, ''), expires_at, revoked_at
+		FROM revoked_token WHERE jti = $1;
+	`
+
+	t.log.Debug("get revoked token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var token models.RevokedToken
+	err = tx.QueryRow(ctx, q, tokenID).Scan(
+		&token.TokenID,
+		&token.UserID,
+		&token.ClientID,
+		&token.AppID,
+		&token.RevokedBy,
+		&token.RevokedByClient,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return models.RevokedToken{}, database.ErrNotFound
+		}
+		t.log.Error("failed to get revoked token", sl.OpErr(op, err))
+		return models.RevokedToken{}, err
+	}
+
+	return token, nil
+}
+
+func (t *TokenDB) CreateAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error {
+	const op = "database.token.CreateAuthorizationCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		INSERT INTO authorization_code (code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	t.log.Debug("create authorization code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q, code.CodeHash, code.AppID, code.UserID, code.RedirectURI, code.CodeChallenge, code.Scope, code.Nonce, code.ExpiresAt)
+	if err != nil {
+		t.log.Error("failed to create authorization code", sl.OpErr(op, err))
+		return errors.New("failed to create authorization code")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("new authorization code created", slog.String("op", op), slog.Int64("user_id", code.UserID), slog.Int("app_id", code.AppID))
+	return nil
+}
+
+// ConsumeAuthorizationCode marks the code as used and returns it. It
+// returns database.ErrNotFound for unknown codes, and the code together
+// with database.ErrConflict if it was used before.
+func (t *TokenDB) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error) {
+	const op = "database.token.ConsumeAuthorizationCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.AuthorizationCode{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, session_id, expires_at, used_at, created_at
+		FROM authorization_code WHERE code_hash = $1 FOR UPDATE;
+	`
+
+	t.log.Debug("get authorization code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var code models.AuthorizationCode
+	err = tx.QueryRow(ctx, q, codeHash).Scan(
+		&code.CodeHash,
+		&code.AppID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.CodeChallenge,
+		&code.Scope,
+		&code.Nonce,
+		&code.SessionID,
+		&code.ExpiresAt,
+		&code.UsedAt,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			t.log.Error("authorization code not found", slog.String("op", op))
+			return models.AuthorizationCode{}, database.ErrNotFound
+		}
+		t.log.Error("failed to get authorization code", sl.OpErr(op, err))
+		return models.AuthorizationCode{}, err
+	}
+
+	if code.UsedAt != nil {
+		t.log.Error("authorization code already used", slog.String("op", op), slog.Int64("user_id", code.UserID))
+		return code, database.ErrConflict
+	}
+
+	q = `
+		UPDATE authorization_code SET used_at = now() WHERE code_hash = $1;
+	`
+
+	t.log.Debug("consume authorization code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, codeHash); err != nil {
+		t.log.Error("failed to consume authorization code", sl.OpErr(op, err))
+		return models.AuthorizationCode{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return models.AuthorizationCode{}, err
+	}
+
+	t.log.Info("authorization code consumed", slog.String("op", op), slog.Int64("user_id", code.UserID))
+	return code, nil
+}
+
+// SetAuthorizationCodeSession records the session started with the code,
+// so that it can be ended if the code is replayed.
+func (t *TokenDB) SetAuthorizationCodeSession(ctx context.Context, codeHash string, sessionID string) error {
+	const op = "database.token.SetAuthorizationCodeSession"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE authorization_code SET session_id = $2 WHERE code_hash = $1;
+	`
+
+	t.log.Debug("set authorization code session query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, codeHash, sessionID); err != nil {
+		t.log.Error("failed to set authorization code session", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// CreateDeviceCode stores a device authorization request and removes
+// requests that expired a day ago. It returns database.ErrConflict if the
+// user code is taken.
+func (t *TokenDB) CreateDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const op = "database.token.CreateDeviceCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		DELETE FROM device_code WHERE expires_at < now() - interval '1 day';
+	`
+
+	t.log.Debug("delete expired device codes query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q); err != nil {
+		t.log.Error("failed to delete expired device codes", sl.OpErr(op, err))
+		return err
+	}
+
+	q = `
+		INSERT INTO device_code (device_code_hash, user_code, app_id, scope, interval_seconds, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	t.log.Debug("create device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err = tx.Exec(ctx, q, code.DeviceCodeHash, code.UserCode, code.AppID, code.Scope, int(code.Interval.Seconds()), code.ExpiresAt)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return database.ErrConflict
+		}
+		t.log.Error("failed to create device code", sl.OpErr(op, err))
+		return errors.New("failed to create device code")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("new device code created", slog.String("op", op), slog.Int("app_id", code.AppID))
+	return nil
+}
+
+func (t *TokenDB) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "database.token.GetDeviceCodeByUserCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT device_code_hash, user_code, app_id, scope, user_id, status, interval_seconds, last_polled_at, expires_at, created_at
+		FROM device_code WHERE user_code = $1;
+	`
+
+	t.log.Debug("get device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	code, err := scanDeviceCode(tx.QueryRow(ctx, q, userCode))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			t.log.Error("device code not found", slog.String("op", op))
+			return models.DeviceCode{}, database.ErrNotFound
+		}
+		t.log.Error("failed to get device code", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+
+	return code, nil
+}
+
+// DecideDeviceCode records the decision of the user on a pending device
+// code. It returns database.ErrConflict if the code is no longer pending.
+func (t *TokenDB) DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error {
+	const op = "database.token.DecideDeviceCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE device_code SET status = $3, user_id = $2
+		WHERE user_code = $1 AND status = 'pending';
+	`
+
+	t.log.Debug("decide device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, userCode, userID, status)
+	if err != nil {
+		t.log.Error("failed to decide device code", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		t.log.Error("device code is not pending", slog.String("op", op))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("device code decided", slog.String("op", op), slog.Int64("user_id", userID), slog.String("status", status))
+	return nil
+}
+
+// PollDeviceCode records a poll of the device for the app and returns the
+// code as it was before the poll. It returns database.ErrNotFound for
+// unknown codes and codes of another app, and database.ErrExpired for
+// expired codes, neither of which count as a poll. The code stays approved
+// until ConsumeDeviceCode.
+func (t *TokenDB) PollDeviceCode(ctx context.Context, deviceCodeHash string, appID int) (models.DeviceCode, error) {
+	const op = "database.token.PollDeviceCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT device_code_hash, user_code, app_id, scope, user_id, status, interval_seconds, last_polled_at, expires_at, created_at
+		FROM device_code WHERE device_code_hash = $1 FOR UPDATE;
+	`
+
+	t.log.Debug("get device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	code, err := scanDeviceCode(tx.QueryRow(ctx, q, deviceCodeHash))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			t.log.Error("device code not found", slog.String("op", op))
+			return models.DeviceCode{}, database.ErrNotFound
+		}
+		t.log.Error("failed to get device code", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+
+	if code.AppID != appID {
+		t.log.Error("device code belongs to another app", slog.String("op", op), slog.Int("app_id", appID))
+		return models.DeviceCode{}, database.ErrNotFound
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return models.DeviceCode{}, database.ErrExpired
+	}
+
+	q = `
+		UPDATE device_code SET last_polled_at = now() WHERE device_code_hash = $1;
+	`
+
+	t.log.Debug("poll device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, deviceCodeHash); err != nil {
+		t.log.Error("failed to poll device code", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+
+	return code, nil
+}
+
+// ConsumeDeviceCode marks the approved device code as used once tokens
+// were issued for it. It returns database.ErrConflict if the code is no
+// longer approved, because another poll used it first.
+func (t *TokenDB) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	const op = "database.token.ConsumeDeviceCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE device_code SET status = 'consumed'
+		WHERE device_code_hash = $1 AND status = 'approved';
+	`
+
+	t.log.Debug("consume device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	tag, err := tx.Exec(ctx, q, deviceCodeHash)
+	if err != nil {
+		t.log.Error("failed to consume device code", sl.OpErr(op, err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		t.log.Error("device code is not approved", slog.String("op", op))
+		return database.ErrConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	t.log.Info("device code consumed", slog.String("op", op))
+	return nil
+}
+
+// SlowDownDeviceCode increases the polling interval of the device code.
+func (t *TokenDB) SlowDownDeviceCode(ctx context.Context, deviceCodeHash string, step time.Duration) error {
+	const op = "database.token.SlowDownDeviceCode"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		UPDATE device_code SET interval_seconds = interval_seconds + $2 WHERE device_code_hash = $1;
+	`
+
+	t.log.Debug("slow down device code query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, deviceCodeHash, int(step.Seconds())); err != nil {
+		t.log.Error("failed to slow down device code", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// CountUserCodeFailures returns the number of unknown or expired user codes
+// the client typed since the time.
+func (t *TokenDB) CountUserCodeFailures(ctx context.Context, clientIP string, since time.Time) (int, error) {
+	const op = "database.token.CountUserCodeFailures"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		SELECT count(*) FROM user_code_failure WHERE client_ip = $1 AND failed_at > $2;
+	`
+
+	t.log.Debug("count user code failures query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	var count int
+	if err := tx.QueryRow(ctx, q, clientIP, since).Scan(&count); err != nil {
+		t.log.Error("failed to count user code failures", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CreateUserCodeFailure records that the client typed an unknown or
+// expired user code, and removes failures older than a day.
+func (t *TokenDB) CreateUserCodeFailure(ctx context.Context, clientIP string) error {
+	const op = "database.token.CreateUserCodeFailure"
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		t.log.Error("failed to begin transaction", sl.OpErr(op, err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `
+		DELETE FROM user_code_failure WHERE failed_at < now() - interval '1 day';
+	`
+
+	t.log.Debug("delete old user code failures query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q); err != nil {
+		t.log.Error("failed to delete old user code failures", sl.OpErr(op, err))
+		return err
+	}
+
+	q = `
+		INSERT INTO user_code_failure (client_ip) VALUES ($1);
+	`
+
+	t.log.Debug("create user code failure query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	if _, err := tx.Exec(ctx, q, clientIP); err != nil {
+		t.log.Error("failed to create user code failure", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.log.Error("failed to commit transaction", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+func scanDeviceCode(row pgx.Row) (models.DeviceCode, error) {
+	var (
+		code     models.DeviceCode
+		interval int
+	)
+	err := row.Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.AppID,
+		&code.Scope,
+		&code.UserID,
+		&code.Status,
+		&interval,
+		&code.LastPolledAt,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+	code.Interval = time.Duration(interval) * time.Second
+
+	return code, err
+}
+
+func (t *TokenDB) insertRefreshToken(ctx context.Context, tx pgx.Tx, token models.RefreshToken) error {
+	const op = "database.token.insertRefreshToken"
+
+	q := `
+		INSERT INTO refresh_token (token_hash, family_id, user_id, app_id, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	t.log.Debug("create refresh token query", slog.String("op", op), slog.String("query", query.QueryToString(q)))
+
+	_, err := tx.Exec(ctx, q, token.TokenHash, token.FamilyID, token.UserID, token.AppID, token.Scope, token.ExpiresAt)
+	return err
+}
@@ -1,7 +0,0 @@
-package models
-
-type Admin struct {
-	ID     int64
-	UserID int64
-	AppID  int
-}
@@ -1,8 +1,40 @@
 package models
 
+import "time"
+
+// App is an application users sign in to. Apps with RequireVerifiedEmail
+// refuse to sign in users who did not verify their email address.
 type App struct {
-	ID            int
-	Name          string
+	ID                   int
+	Name                 string
+	SigningAlg           string
+	RequireVerifiedEmail bool
+}
+
+const (
+	KeyKindAccess  = "access"
+	KeyKindRefresh = "refresh"
+)
+
+const (
+	// KeyStatusActive keys sign tokens once their activation time has come
+	// and verify tokens before and after it.
+	KeyStatusActive = "active"
+	// KeyStatusVerifying keys were superseded and only verify tokens that
+	// are still in circulation.
+	KeyStatusVerifying = "verifying"
+	// KeyStatusRetired keys are kept for the record and are never used.
+	KeyStatusRetired = "retired"
+)
+
+type AppKey struct {
+	ID            string
+	AppID         int
+	Kind          string
+	Algorithm     string
 	Secret        string
-	RefreshSecret string
+	Status        string
+	ActivatesAt   time.Time
+	DeactivatedAt *time.Time
+	CreatedAt     time.Time
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	ImpersonationIssued = "issued"
+	ImpersonationUsed   = "used"
+)
+
+// ImpersonationEvent is an audit record of an impersonation token, written
+// when the token is issued and every time it is accepted.
+type ImpersonationEvent struct {
+	ID        int64
+	Event     string
+	TokenID   string
+	ActorID   int64
+	UserID    int64
+	AppID     int
+	Reason    string
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ServiceClient is a confidential client of an app that gets access tokens
+// for itself with the client credentials grant. Scope is the space
+// separated list of permissions the app granted it, and Audiences are the
+// apps it may exchange tokens of users for.
+type ServiceClient struct {
+	ID         string
+	AppID      int
+	Name       string
+	SecretHash string
+	Scope      string
+	Audiences  []int
+	CreatedAt  time.Time
+}
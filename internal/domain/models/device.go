@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Statuses of a device code. A pending code is approved or denied by the
+// user and an approved code is consumed when the device gets its tokens.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeConsumed = "consumed"
+)
+
+// DeviceCode is a device authorization request. Only the hash of the device
+// code is stored; the user code is stored without separators.
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	AppID          int
+	Scope          string
+	UserID         *int64
+	Status         string
+	Interval       time.Duration
+	LastPolledAt   *time.Time
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+// DeviceAuthorization is the response to a device authorization request,
+// as described in RFC 8628, section 3.2.
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// DeviceRequest is what the verification page shows the user about a
+// pending device authorization request before they decide on it (RFC 8628,
+// section 5.4).
+type DeviceRequest struct {
+	UserCode string
+	AppName  string
+	Scope    string
+}
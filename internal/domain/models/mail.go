@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Mail is a message to one recipient, with a plain text body and an
+// optional HTML alternative.
+type Mail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// OutboxMail is a mail waiting in the outbox to be delivered. Attempts
+// counts the deliveries tried, including the current one.
+type OutboxMail struct {
+	ID        int64
+	Mail      Mail
+	Attempts  int
+	CreatedAt time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// TOTPFactor is the TOTP authenticator of a user. It is enrolled once the
+// user confirmed it with a first code. LastUsedStep is the time step of the
+// last accepted code, codes of that step or earlier are refused.
+type TOTPFactor struct {
+	UserID       int64
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// TOTPEnrollment is what the user adds to the authenticator app, the
+// secret itself or the otpauth URI, usually shown as a QR code.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFAChallenge is a login waiting for the second factor. Only the hash of
+// the challenge id is stored.
+type MFAChallenge struct {
+	ChallengeHash string
+	UserID        int64
+	AppID         int
+	Scope         string
+	Attempts      int
+	ExpiresAt     time.Time
+	ConsumedAt    *time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const CodeChallengeS256 = "S256"
+
+// AuthorizationRequest is the request of a client to /authorize on behalf
+// of a user.
+type AuthorizationRequest struct {
+	AppID               int
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationCode is an issued authorization code. Only its hash is
+// stored. SessionID is set once the code was exchanged for tokens.
+type AuthorizationCode struct {
+	CodeHash      string
+	AppID         int
+	UserID        int64
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	Nonce         string
+	SessionID     *string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
@@ -0,0 +1,32 @@
+package models
+
+import "github.com/golang-jwt/jwt/v5"
+
+// OpenID Connect scope values. They select the ID token and the profile
+// claims in it and are not permissions.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// IDToken are the claims of an OpenID Connect ID token. Name is only set
+// when the profile scope was requested, Email and EmailVerified when the
+// email scope was.
+type IDToken struct {
+	jwt.RegisteredClaims
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	SessionID     string           `json:"sid,omitempty"`
+	Name          string           `json:"name,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+}
+
+// UserInfo are the claims returned by the userinfo endpoint.
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Kinds of passkey challenges.
+const (
+	PasskeyRegistration = "registration"
+	PasskeyLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential of a user. PublicKey is COSE encoded,
+// SignCount is the last signature counter the authenticator sent.
+type Passkey struct {
+	CredentialID   []byte
+	UserID         int64
+	Name           string
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	Transports     []string
+	AAGUID         []byte
+	BackupEligible bool
+	BackedUp       bool
+	LastUsedAt     *time.Time
+	CreatedAt      time.Time
+}
+
+// PasskeyChallenge is a registration or login ceremony in progress. Only
+// the hash of the challenge is stored. Login challenges have no user, the
+// passkey tells who logs in.
+type PasskeyChallenge struct {
+	ChallengeHash string
+	Kind          string
+	UserID        *int64
+	AppID         int
+	Scope         string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// RoleAdmin is the built-in role every app has. It grants every
+	// permission and backs IsAdmin.
+	RoleAdmin = "admin"
+
+	// PermissionAll grants every permission.
+	PermissionAll = "*"
+)
+
+type Role struct {
+	ID          int
+	AppID       int
+	Name        string
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+// Grants reports whether the role grants the permission. Besides the
+// permission itself, "*" grants every permission and a permission ending in
+// ":*" grants every permission with that prefix, e.g. "billing:*" grants
+// "billing:read".
+func (r Role) Grants(permission string) bool {
+	for _, granted := range r.Permissions {
+		switch {
+		case granted == permission, granted == PermissionAll:
+			return true
+		case strings.HasSuffix(granted, ":*") && strings.HasPrefix(permission, strings.TrimSuffix(granted, "*")):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is a login of a user into an app. The refresh tokens issued for
+// it form a family whose id is the session id.
+type Session struct {
+	ID         string
+	UserID     int64
+	AppID      int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	EndedAt    *time.Time
+}
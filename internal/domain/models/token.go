@@ -8,12 +8,92 @@ import (
 
 type Token struct {
 	jwt.RegisteredClaims
-	UserID  int64         `json:"user_id"`
-	AppID   int           `json:"app_id"`
-	Expires time.Duration `json:"exp"`
+	UserID    int64  `json:"user_id"`
+	AppID     int    `json:"app_id"`
+	SessionID string `json:"sid,omitempty"`
+
+	// ClientID is set instead of UserID in tokens of service clients.
+	ClientID string `json:"client_id,omitempty"`
+
+	// Actor is the service client acting on behalf of the user in tokens
+	// issued by token exchange, or the admin in impersonation tokens.
+	Actor *Actor `json:"act,omitempty"`
+
+	// Roles and Scope, a space separated list of permissions, are only set
+	// in access tokens. RolesOmitted is set instead when they did not fit
+	// into the token.
+	Roles        []string `json:"roles,omitempty"`
+	Scope        string   `json:"scope,omitempty"`
+	RolesOmitted bool     `json:"roles_omitted,omitempty"`
+}
+
+// Actor is the act claim of RFC 8693, section 4.1. When a token issued by
+// token exchange is exchanged again, the previous actor is nested in Actor.
+// UserID is set when the actor is an admin impersonating the user.
+type Actor struct {
+	Subject string `json:"sub"`
+	UserID  int64  `json:"user_id,omitempty"`
+	Actor   *Actor `json:"act,omitempty"`
 }
 
 type TokensPair struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string        `json:"access_token"`
+	RefreshToken string        `json:"refresh_token"`
+	IDToken      string        `json:"id_token,omitempty"`
+	ExpiresIn    time.Duration `json:"-"`
+	Scope        string        `json:"-"`
+
+	// MFAChallengeID is set instead of the tokens when the user has to
+	// finish the login with a second factor.
+	MFAChallengeID string `json:"-"`
+}
+
+type RefreshToken struct {
+	ID         int64
+	TokenHash  string
+	FamilyID   string
+	UserID     int64
+	AppID      int
+	Scope      string
+	ExpiresAt  time.Time
+	ConsumedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Introspection is the state of a token as described in RFC 7662. Only
+// Active is set for tokens that are not active.
+type Introspection struct {
+	Active    bool
+	TokenType string
+	Subject   string
+	UserID    int64
+	AppID     int
+	Scope     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	SessionID string
+	TokenID   string
+	ClientID  string
+	Actor     *Actor
+}
+
+// RevokedToken is an access token revoked before it expired. It is kept
+// until ExpiresAt, after which the token is rejected anyway. ClientID is
+// set instead of UserID for tokens of service clients, and RevokedByClient
+// instead of RevokedBy when a service client revoked the token.
+type RevokedToken struct {
+	TokenID         string
+	UserID          int64
+	ClientID        string
+	AppID           int
+	RevokedBy       int64
+	RevokedByClient string
+	ExpiresAt       time.Time
+	RevokedAt       time.Time
 }
@@ -1,14 +1,39 @@
 package models
 
+import "time"
+
 type User struct {
-	ID       int64
-	Name     string
-	Email    string
-	PassHash string
+	ID            int64
+	Name          string
+	Email         string
+	PassHash      string
+	EmailVerified bool
 }
 
 type UserRead struct {
-	ID    int64
-	Name  string
-	Email string
+	ID            int64
+	Name          string
+	Email         string
+	EmailVerified bool
+}
+
+// EmailVerificationToken proves that the user can read mail sent to Email.
+// Only the hash of the token is stored.
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    int64
+	Email     string
+	ExpiresAt time.Time
+}
+
+// PasswordResetToken lets the user with Email set a new password. Only the
+// hash of the token is stored. AppID, zero for none, and Locale pick the
+// templates of the mail telling the user the password was reset.
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    int64
+	Email     string
+	AppID     int
+	Locale    string
+	ExpiresAt time.Time
 }
@@ -0,0 +1,276 @@
+package apps
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	authGRPC "grpc/internal/grpc/auth"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emptyValue = 0
+)
+
+type Apps interface {
+	CreateApp(ctx context.Context, token string, name string, signingAlg string, requireVerifiedEmail bool) (app models.App, secret string, err error)
+	UpdateApp(ctx context.Context, token string, appID int, name string, requireVerifiedEmail *bool) (models.App, error)
+	ListApps(ctx context.Context, token string) ([]models.App, error)
+	RotateAppSecret(ctx context.Context, token string, appID int, retirePrevious bool) (secret string, err error)
+	DeleteApp(ctx context.Context, token string, appID int) error
+	SetRedirectURIs(ctx context.Context, token string, appID int, uris []string) ([]string, error)
+	CreateServiceClient(ctx context.Context, token string, appID int, name string, scope string, audiences []int) (client models.ServiceClient, secret string, err error)
+	DeleteServiceClient(ctx context.Context, token string, clientID string) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAppsServer
+	apps Apps
+}
+
+func Register(gRPC *grpc.Server, apps Apps) {
+	ssov1.RegisterAppsServer(gRPC, &serverAPI{apps: apps})
+}
+
+func (s *serverAPI) CreateApp(ctx context.Context, req *ssov1.CreateAppRequest) (*ssov1.CreateAppResponse, error) {
+	if err := validateCreateApp(req); err != nil {
+		return nil, err
+	}
+
+	app, secret, err := s.apps.CreateApp(ctx, req.GetToken(), req.GetName(), req.GetSigningAlg(), req.GetRequireVerifiedEmail())
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.CreateAppResponse{
+		App:    toApp(app),
+		Secret: secret,
+	}, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *ssov1.UpdateAppRequest) (*ssov1.UpdateAppResponse, error) {
+	if err := validateUpdateApp(req); err != nil {
+		return nil, err
+	}
+
+	var requireVerifiedEmail *bool
+	if req.GetUpdateRequireVerifiedEmail() {
+		requireVerifiedEmail = &req.RequireVerifiedEmail
+	}
+
+	app, err := s.apps.UpdateApp(ctx, req.GetToken(), int(req.GetAppId()), req.GetName(), requireVerifiedEmail)
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.UpdateAppResponse{
+		App: toApp(app),
+	}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *ssov1.ListAppsRequest) (*ssov1.ListAppsResponse, error) {
+	if err := validateListApps(req); err != nil {
+		return nil, err
+	}
+
+	apps, err := s.apps.ListApps(ctx, req.GetToken())
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	resp := &ssov1.ListAppsResponse{
+		Apps: make([]*ssov1.App, 0, len(apps)),
+	}
+	for _, app := range apps {
+		resp.Apps = append(resp.Apps, toApp(app))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RotateAppSecret(ctx context.Context, req *ssov1.RotateAppSecretRequest) (*ssov1.RotateAppSecretResponse, error) {
+	if err := validateRotateAppSecret(req); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.apps.RotateAppSecret(ctx, req.GetToken(), int(req.GetAppId()), req.GetRetirePrevious())
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.RotateAppSecretResponse{
+		Secret: secret,
+	}, nil
+}
+
+func (s *serverAPI) DeleteApp(ctx context.Context, req *ssov1.DeleteAppRequest) (*ssov1.DeleteAppResponse, error) {
+	if err := validateDeleteApp(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.apps.DeleteApp(ctx, req.GetToken(), int(req.GetAppId())); err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.DeleteAppResponse{}, nil
+}
+
+func (s *serverAPI) SetRedirectURIs(ctx context.Context, req *ssov1.SetRedirectURIsRequest) (*ssov1.SetRedirectURIsResponse, error) {
+	if err := validateSetRedirectURIs(req); err != nil {
+		return nil, err
+	}
+
+	uris, err := s.apps.SetRedirectURIs(ctx, req.GetToken(), int(req.GetAppId()), req.GetRedirectUris())
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.SetRedirectURIsResponse{
+		RedirectUris: uris,
+	}, nil
+}
+
+func (s *serverAPI) CreateServiceClient(ctx context.Context, req *ssov1.CreateServiceClientRequest) (*ssov1.CreateServiceClientResponse, error) {
+	if err := validateCreateServiceClient(req); err != nil {
+		return nil, err
+	}
+
+	audiences := make([]int, 0, len(req.GetAudiences()))
+	for _, audience := range req.GetAudiences() {
+		audiences = append(audiences, int(audience))
+	}
+
+	client, secret, err := s.apps.CreateServiceClient(ctx, req.GetToken(), int(req.GetAppId()), req.GetName(), req.GetScope(), audiences)
+	if err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.CreateServiceClientResponse{
+		ClientId:     client.ID,
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *serverAPI) DeleteServiceClient(ctx context.Context, req *ssov1.DeleteServiceClientRequest) (*ssov1.DeleteServiceClientResponse, error) {
+	if err := validateDeleteServiceClient(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.apps.DeleteServiceClient(ctx, req.GetToken(), req.GetClientId()); err != nil {
+		return nil, authGRPC.ResponseError(err)
+	}
+
+	return &ssov1.DeleteServiceClientResponse{}, nil
+}
+
+func toApp(app models.App) *ssov1.App {
+	return &ssov1.App{
+		Id:                   int32(app.ID),
+		Name:                 app.Name,
+		SigningAlg:           app.SigningAlg,
+		RequireVerifiedEmail: app.RequireVerifiedEmail,
+	}
+}
+
+func validateCreateApp(req *ssov1.CreateAppRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "empty name")
+	}
+
+	return nil
+}
+
+func validateUpdateApp(req *ssov1.UpdateAppRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "empty name")
+	}
+
+	return nil
+}
+
+func validateListApps(req *ssov1.ListAppsRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	return nil
+}
+
+func validateRotateAppSecret(req *ssov1.RotateAppSecretRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateDeleteApp(req *ssov1.DeleteAppRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateSetRedirectURIs(req *ssov1.SetRedirectURIsRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateCreateServiceClient(req *ssov1.CreateServiceClientRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "empty name")
+	}
+
+	return nil
+}
+
+func validateDeleteServiceClient(req *ssov1.DeleteServiceClientRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetClientId() == "" {
+		return status.Error(codes.InvalidArgument, "empty client id")
+	}
+
+	return nil
+}
@@ -1,13 +1,22 @@
 package auth
 
 import (
+	"errors"
 	service "grpc/internal/services/auth"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const errorDomain = "sso"
+
 func ResponseError(err error) error {
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return passwordPolicyError(policyErr)
+	}
+
 	switch err {
 	case service.ErrInvPassOrEmail:
 		return status.Error(codes.InvalidArgument, service.ErrInvPassOrEmail.Error())
@@ -17,7 +26,63 @@ func ResponseError(err error) error {
 		return status.Error(codes.InvalidArgument, service.ErrInvalidData.Error())
 	case service.ErrUnauthorized:
 		return status.Error(codes.Unauthenticated, service.ErrUnauthorized.Error())
+	case service.ErrForbidden:
+		return status.Error(codes.PermissionDenied, service.ErrForbidden.Error())
+	case service.ErrAppAlreadyExist:
+		return status.Error(codes.AlreadyExists, service.ErrAppAlreadyExist.Error())
+	case service.ErrInvalidClient:
+		return status.Error(codes.Unauthenticated, service.ErrInvalidClient.Error())
+	case service.ErrInvalidGrant:
+		return status.Error(codes.InvalidArgument, service.ErrInvalidGrant.Error())
+	case service.ErrAuthorizationPending:
+		return status.Error(codes.FailedPrecondition, service.ErrAuthorizationPending.Error())
+	case service.ErrSlowDown:
+		return status.Error(codes.ResourceExhausted, service.ErrSlowDown.Error())
+	case service.ErrTooManyAttempts:
+		return status.Error(codes.ResourceExhausted, service.ErrTooManyAttempts.Error())
+	case service.ErrAccessDenied:
+		return status.Error(codes.PermissionDenied, service.ErrAccessDenied.Error())
+	case service.ErrExpiredToken:
+		return status.Error(codes.DeadlineExceeded, service.ErrExpiredToken.Error())
+	case service.ErrInvalidTarget:
+		return status.Error(codes.InvalidArgument, service.ErrInvalidTarget.Error())
+	case service.ErrInvalidRedirectURI:
+		return status.Error(codes.InvalidArgument, service.ErrInvalidRedirectURI.Error())
+	case service.ErrInvalidMFACode:
+		return status.Error(codes.InvalidArgument, service.ErrInvalidMFACode.Error())
+	case service.ErrMFAAlreadyEnrolled:
+		return status.Error(codes.AlreadyExists, service.ErrMFAAlreadyEnrolled.Error())
+	case service.ErrEmailNotVerified:
+		return status.Error(codes.FailedPrecondition, service.ErrEmailNotVerified.Error())
 	default:
 		return status.Error(codes.Internal, "internal error")
 	}
 }
+
+// passwordPolicyError returns InvalidArgument with the broken rules as
+// BadRequest field violations, and an ErrorInfo whose metadata maps every
+// broken rule to its description.
+func passwordPolicyError(err *service.PasswordPolicyError) error {
+	st := status.New(codes.InvalidArgument, "weak password")
+
+	badRequest := &errdetails.BadRequest{}
+	info := &errdetails.ErrorInfo{
+		Reason:   "PASSWORD_POLICY",
+		Domain:   errorDomain,
+		Metadata: make(map[string]string, len(err.Violations)),
+	}
+	for _, violation := range err.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: violation.Description,
+		})
+		info.Metadata[violation.Rule] = violation.Description
+	}
+
+	detailed, detailsErr := st.WithDetails(badRequest, info)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -2,7 +2,10 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/webauthn"
 
 	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
 	"google.golang.org/grpc"
@@ -15,11 +18,37 @@ const (
 )
 
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appID int) (tokens models.TokensPair, err error)
-	Register(ctx context.Context, email string, password string, name string) (userID int64, err error)
+	Login(ctx context.Context, email string, password string, appID int, scope string) (tokens models.TokensPair, err error)
+	Register(ctx context.Context, email string, password string, name string, appID int, locale string) (userID int64, err error)
 	IsAdmin(ctx context.Context, userID int64, appID int) (bool, error)
-	RefreshToken(ctx context.Context, token string, appID int) (tokens models.TokensPair, err error)
+	RefreshToken(ctx context.Context, token string, appID int, scope string) (tokens models.TokensPair, err error)
 	CurrentUser(ctx context.Context, token string, appID int) (models.UserRead, error)
+	JWKS(ctx context.Context, appID int) ([]jwt.JWK, error)
+	Logout(ctx context.Context, token string, appID int) error
+	LogoutAll(ctx context.Context, token string, appID int) (int64, error)
+	Introspect(ctx context.Context, token string, appID int, tokenTypeHint string) (models.Introspection, error)
+	RevokeToken(ctx context.Context, token string, appID int, revokeToken string) error
+	CheckPermission(ctx context.Context, token string, userID int64, appID int, permission string) (bool, error)
+	ListUserRoles(ctx context.Context, token string, userID int64, appID int) ([]models.Role, error)
+	AssignRole(ctx context.Context, token string, appID int, userID int64, role string) error
+	UnassignRole(ctx context.Context, token string, appID int, userID int64, role string) error
+	ClientCredentials(ctx context.Context, clientID string, clientSecret string, scope string) (tokens models.TokensPair, err error)
+	DeviceAuthorization(ctx context.Context, appID int, scope string) (models.DeviceAuthorization, error)
+	ApproveDevice(ctx context.Context, token string, userCode string, approve bool) error
+	DeviceToken(ctx context.Context, appID int, deviceCode string) (tokens models.TokensPair, err error)
+	TokenExchange(ctx context.Context, clientID string, clientSecret string, subjectToken string, audience int, scope string) (tokens models.TokensPair, err error)
+	Impersonate(ctx context.Context, token string, appID int, userID int64, reason string) (tokens models.TokensPair, err error)
+	EnrollTOTP(ctx context.Context, token string, appID int) (models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, token string, appID int, code string) (recoveryCodes []string, err error)
+	VerifyMFA(ctx context.Context, challengeID string, code string, appID int) (tokens models.TokensPair, err error)
+	BeginPasskeyRegistration(ctx context.Context, token string, appID int) (webauthn.CreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, token string, appID int, clientDataJSON []byte, attestationObject []byte, transports []string, name string) (credentialID string, err error)
+	BeginPasskeyLogin(ctx context.Context, appID int, scope string) (webauthn.RequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, appID int, credentialID []byte, clientDataJSON []byte, authenticatorData []byte, signature []byte, userHandle []byte) (tokens models.TokensPair, err error)
+	SendVerificationEmail(ctx context.Context, email string, appID int, locale string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string, appID int, locale string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
 }
 
 type serverAPI struct {
@@ -36,14 +65,16 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 		return nil, err
 	}
 
-	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()), req.GetScope())
 	if err != nil {
 		return nil, ResponseError(err)
 	}
 
 	return &ssov1.LoginResponse{
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
+		AccessToken:    tokens.AccessToken,
+		RefreshToken:   tokens.RefreshToken,
+		IdToken:        tokens.IDToken,
+		MfaChallengeId: tokens.MFAChallengeID,
 	}, nil
 }
 
@@ -52,7 +83,7 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 		return nil, err
 	}
 
-	userID, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword(), req.GetName())
+	userID, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword(), req.GetName(), int(req.GetAppId()), req.GetLocale())
 	if err != nil {
 		return nil, ResponseError(err)
 	}
@@ -82,7 +113,7 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshTokenReq
 		return nil, err
 	}
 
-	tokens, err := s.auth.RefreshToken(ctx, req.GetToken(), int(req.GetAppId()))
+	tokens, err := s.auth.RefreshToken(ctx, req.GetToken(), int(req.GetAppId()), req.GetScope())
 	if err != nil {
 		return nil, ResponseError(err)
 	}
@@ -90,6 +121,7 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshTokenReq
 	return &ssov1.RefreshTokenResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
 	}, nil
 }
 
@@ -104,75 +136,908 @@ func (s *serverAPI) CurrentUser(ctx context.Context, req *ssov1.CurrentUserReque
 	}
 
 	return &ssov1.CurrentUserResponse{
-		UserId: user.ID,
-		Email:  user.Email,
-		Name:   user.Name,
+		UserId:        user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		EmailVerified: user.EmailVerified,
 	}, nil
 }
 
-func validateLogin(req *ssov1.LoginRequest) error {
-	if req.GetEmail() == "" {
-		return status.Error(codes.InvalidArgument, "empty email")
+func (s *serverAPI) JWKS(ctx context.Context, req *ssov1.JWKSRequest) (*ssov1.JWKSResponse, error) {
+	if err := validateJWKS(req); err != nil {
+		return nil, err
 	}
 
-	if req.GetPassword() == "" {
-		return status.Error(codes.InvalidArgument, "empty password")
+	keys, err := s.auth.JWKS(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
 	}
 
-	if req.GetAppId() == emptyValue {
-		return status.Error(codes.InvalidArgument, "empty app id")
+	resp := &ssov1.JWKSResponse{
+		Keys: make([]*ssov1.JWK, 0, len(keys)),
+	}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, &ssov1.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		})
 	}
 
-	return nil
+	return resp, nil
 }
 
-func validateRegister(req *ssov1.RegisterRequest) error {
-	if req.GetEmail() == "" {
-		return status.Error(codes.InvalidArgument, "empty email")
+func (s *serverAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
+	if err := validateLogout(req); err != nil {
+		return nil, err
 	}
 
-	if req.GetPassword() == "" {
-		return status.Error(codes.InvalidArgument, "empty password")
+	if err := s.auth.Logout(ctx, req.GetToken(), int(req.GetAppId())); err != nil {
+		return nil, ResponseError(err)
 	}
 
-	if req.GetName() == "" {
-		return status.Error(codes.InvalidArgument, "empty name")
+	return &ssov1.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) LogoutAll(ctx context.Context, req *ssov1.LogoutAllRequest) (*ssov1.LogoutAllResponse, error) {
+	if err := validateLogoutAll(req); err != nil {
+		return nil, err
 	}
 
-	return nil
+	sessions, err := s.auth.LogoutAll(ctx, req.GetToken(), int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.LogoutAllResponse{
+		Sessions: sessions,
+	}, nil
 }
 
-func validateIsAdmin(req *ssov1.IsAdminRequest) error {
-	if req.GetUserId() == emptyValue {
-		return status.Error(codes.InvalidArgument, "empty user id")
+func (s *serverAPI) Introspect(ctx context.Context, req *ssov1.IntrospectRequest) (*ssov1.IntrospectResponse, error) {
+	if err := validateIntrospect(req); err != nil {
+		return nil, err
 	}
 
-	if req.GetAppId() == emptyValue {
-		return status.Error(codes.InvalidArgument, "empty app id")
+	info, err := s.auth.Introspect(ctx, req.GetToken(), int(req.GetAppId()), req.GetTokenTypeHint())
+	if err != nil {
+		return nil, ResponseError(err)
 	}
 
-	return nil
+	if !info.Active {
+		return &ssov1.IntrospectResponse{}, nil
+	}
+
+	resp := &ssov1.IntrospectResponse{
+		Active:    true,
+		TokenType: info.TokenType,
+		Sub:       info.Subject,
+		UserId:    info.UserID,
+		AppId:     int32(info.AppID),
+		Scope:     info.Scope,
+		Sid:       info.SessionID,
+		Jti:       info.TokenID,
+		ClientId:  info.ClientID,
+		Act:       toActor(info.Actor),
+	}
+	if !info.IssuedAt.IsZero() {
+		resp.Iat = info.IssuedAt.Unix()
+	}
+	if !info.ExpiresAt.IsZero() {
+		resp.Exp = info.ExpiresAt.Unix()
+	}
+
+	return resp, nil
 }
 
-func validateRefreshToken(req *ssov1.RefreshTokenRequest) error {
-	if req.GetToken() == "" {
-		return status.Error(codes.InvalidArgument, "empty token")
+func toActor(actor *models.Actor) *ssov1.Actor {
+	if actor == nil {
+		return nil
 	}
 
-	if req.GetAppId() == emptyValue {
-		return status.Error(codes.InvalidArgument, "empty app id")
+	return &ssov1.Actor{
+		Sub:    actor.Subject,
+		UserId: actor.UserID,
+		Act:    toActor(actor.Actor),
 	}
+}
 
-	return nil
+func (s *serverAPI) RevokeToken(ctx context.Context, req *ssov1.RevokeTokenRequest) (*ssov1.RevokeTokenResponse, error) {
+	if err := validateRevokeToken(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeToken(ctx, req.GetToken(), int(req.GetAppId()), req.GetRevokeToken()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.RevokeTokenResponse{}, nil
 }
 
-func validateCurrentUser(req *ssov1.CurrentUserRequest) error {
-	if req.GetToken() == "" {
-		return status.Error(codes.InvalidArgument, "empty token")
+func (s *serverAPI) CheckPermission(ctx context.Context, req *ssov1.CheckPermissionRequest) (*ssov1.CheckPermissionResponse, error) {
+	if err := validateCheckPermission(req); err != nil {
+		return nil, err
 	}
 
-	if req.GetAppId() == emptyValue {
-		return status.Error(codes.InvalidArgument, "empty app id")
+	allowed, err := s.auth.CheckPermission(ctx, req.GetToken(), req.GetUserId(), int(req.GetAppId()), req.GetPermission())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.CheckPermissionResponse{
+		Allowed: allowed,
+	}, nil
+}
+
+func (s *serverAPI) ListUserRoles(ctx context.Context, req *ssov1.ListUserRolesRequest) (*ssov1.ListUserRolesResponse, error) {
+	if err := validateListUserRoles(req); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.ListUserRoles(ctx, req.GetToken(), req.GetUserId(), int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	resp := &ssov1.ListUserRolesResponse{
+		Roles: make([]*ssov1.Role, 0, len(roles)),
+	}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, &ssov1.Role{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) AssignRole(ctx context.Context, req *ssov1.AssignRoleRequest) (*ssov1.AssignRoleResponse, error) {
+	if err := validateAssignRole(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.AssignRole(ctx, req.GetToken(), int(req.GetAppId()), req.GetUserId(), req.GetRole()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.AssignRoleResponse{}, nil
+}
+
+func (s *serverAPI) UnassignRole(ctx context.Context, req *ssov1.UnassignRoleRequest) (*ssov1.UnassignRoleResponse, error) {
+	if err := validateUnassignRole(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnassignRole(ctx, req.GetToken(), int(req.GetAppId()), req.GetUserId(), req.GetRole()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.UnassignRoleResponse{}, nil
+}
+
+func (s *serverAPI) ClientCredentials(ctx context.Context, req *ssov1.ClientCredentialsRequest) (*ssov1.ClientCredentialsResponse, error) {
+	if err := validateClientCredentials(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.ClientCredentials(ctx, req.GetClientId(), req.GetClientSecret(), req.GetScope())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.ClientCredentialsResponse{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+		Scope:       tokens.Scope,
+	}, nil
+}
+
+func (s *serverAPI) DeviceAuthorization(ctx context.Context, req *ssov1.DeviceAuthorizationRequest) (*ssov1.DeviceAuthorizationResponse, error) {
+	if err := validateDeviceAuthorization(req); err != nil {
+		return nil, err
+	}
+
+	device, err := s.auth.DeviceAuthorization(ctx, int(req.GetAppId()), req.GetScope())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.DeviceAuthorizationResponse{
+		DeviceCode:              device.DeviceCode,
+		UserCode:                device.UserCode,
+		VerificationUri:         device.VerificationURI,
+		VerificationUriComplete: device.VerificationURIComplete,
+		ExpiresIn:               int64(device.ExpiresIn.Seconds()),
+		Interval:                int64(device.Interval.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) ApproveDevice(ctx context.Context, req *ssov1.ApproveDeviceRequest) (*ssov1.ApproveDeviceResponse, error) {
+	if err := validateApproveDevice(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.ApproveDevice(ctx, req.GetToken(), req.GetUserCode(), !req.GetDeny()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.ApproveDeviceResponse{}, nil
+}
+
+func (s *serverAPI) DeviceToken(ctx context.Context, req *ssov1.DeviceTokenRequest) (*ssov1.DeviceTokenResponse, error) {
+	if err := validateDeviceToken(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.DeviceToken(ctx, int(req.GetAppId()), req.GetDeviceCode())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.DeviceTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		Scope:        tokens.Scope,
+	}, nil
+}
+
+func (s *serverAPI) TokenExchange(ctx context.Context, req *ssov1.TokenExchangeRequest) (*ssov1.TokenExchangeResponse, error) {
+	if err := validateTokenExchange(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.TokenExchange(ctx, req.GetClientId(), req.GetClientSecret(), req.GetSubjectToken(), int(req.GetAudience()), req.GetScope())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.TokenExchangeResponse{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+		Scope:       tokens.Scope,
+	}, nil
+}
+
+func (s *serverAPI) Impersonate(ctx context.Context, req *ssov1.ImpersonateRequest) (*ssov1.ImpersonateResponse, error) {
+	if err := validateImpersonate(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.Impersonate(ctx, req.GetToken(), int(req.GetAppId()), req.GetUserId(), req.GetReason())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.ImpersonateResponse{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *ssov1.EnrollTOTPRequest) (*ssov1.EnrollTOTPResponse, error) {
+	if err := validateEnrollTOTP(req); err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.auth.EnrollTOTP(ctx, req.GetToken(), int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.EnrollTOTPResponse{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.URI,
+	}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *ssov1.ConfirmTOTPRequest) (*ssov1.ConfirmTOTPResponse, error) {
+	if err := validateConfirmTOTP(req); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.auth.ConfirmTOTP(ctx, req.GetToken(), int(req.GetAppId()), req.GetCode())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.ConfirmTOTPResponse{
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *ssov1.VerifyMFARequest) (*ssov1.VerifyMFAResponse, error) {
+	if err := validateVerifyMFA(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.VerifyMFA(ctx, req.GetChallengeId(), req.GetCode(), int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.VerifyMFAResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+func (s *serverAPI) BeginPasskeyRegistration(ctx context.Context, req *ssov1.BeginPasskeyRegistrationRequest) (*ssov1.BeginPasskeyRegistrationResponse, error) {
+	if err := validateBeginPasskeyRegistration(req); err != nil {
+		return nil, err
+	}
+
+	options, err := s.auth.BeginPasskeyRegistration(ctx, req.GetToken(), int(req.GetAppId()))
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.BeginPasskeyRegistrationResponse{
+		Options: string(data),
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyRegistration(ctx context.Context, req *ssov1.FinishPasskeyRegistrationRequest) (*ssov1.FinishPasskeyRegistrationResponse, error) {
+	if err := validateFinishPasskeyRegistration(req); err != nil {
+		return nil, err
+	}
+
+	credentialID, err := s.auth.FinishPasskeyRegistration(
+		ctx,
+		req.GetToken(),
+		int(req.GetAppId()),
+		req.GetClientDataJson(),
+		req.GetAttestationObject(),
+		req.GetTransports(),
+		req.GetName(),
+	)
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.FinishPasskeyRegistrationResponse{
+		CredentialId: credentialID,
+	}, nil
+}
+
+func (s *serverAPI) BeginPasskeyLogin(ctx context.Context, req *ssov1.BeginPasskeyLoginRequest) (*ssov1.BeginPasskeyLoginResponse, error) {
+	if err := validateBeginPasskeyLogin(req); err != nil {
+		return nil, err
+	}
+
+	options, err := s.auth.BeginPasskeyLogin(ctx, int(req.GetAppId()), req.GetScope())
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.BeginPasskeyLoginResponse{
+		Options: string(data),
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyLogin(ctx context.Context, req *ssov1.FinishPasskeyLoginRequest) (*ssov1.FinishPasskeyLoginResponse, error) {
+	if err := validateFinishPasskeyLogin(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.FinishPasskeyLogin(
+		ctx,
+		int(req.GetAppId()),
+		req.GetCredentialId(),
+		req.GetClientDataJson(),
+		req.GetAuthenticatorData(),
+		req.GetSignature(),
+		req.GetUserHandle(),
+	)
+	if err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.FinishPasskeyLoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+func (s *serverAPI) SendVerificationEmail(ctx context.Context, req *ssov1.SendVerificationEmailRequest) (*ssov1.SendVerificationEmailResponse, error) {
+	if err := validateSendVerificationEmail(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.SendVerificationEmail(ctx, req.GetEmail(), int(req.GetAppId()), req.GetLocale()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.SendVerificationEmailResponse{}, nil
+}
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *ssov1.VerifyEmailRequest) (*ssov1.VerifyEmailResponse, error) {
+	if err := validateVerifyEmail(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *ssov1.RequestPasswordResetRequest) (*ssov1.RequestPasswordResetResponse, error) {
+	if err := validateRequestPasswordReset(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail(), int(req.GetAppId()), req.GetLocale()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(ctx context.Context, req *ssov1.ResetPasswordRequest) (*ssov1.ResetPasswordResponse, error) {
+	if err := validateResetPassword(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.ResetPassword(ctx, req.GetToken(), req.GetPassword()); err != nil {
+		return nil, ResponseError(err)
+	}
+
+	return &ssov1.ResetPasswordResponse{}, nil
+}
+
+func validateLogin(req *ssov1.LoginRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "empty email")
+	}
+
+	if req.GetPassword() == "" {
+		return status.Error(codes.InvalidArgument, "empty password")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateRegister(req *ssov1.RegisterRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "empty email")
+	}
+
+	if req.GetPassword() == "" {
+		return status.Error(codes.InvalidArgument, "empty password")
+	}
+
+	if req.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "empty name")
+	}
+
+	return nil
+}
+
+func validateIsAdmin(req *ssov1.IsAdminRequest) error {
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateRefreshToken(req *ssov1.RefreshTokenRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateCurrentUser(req *ssov1.CurrentUserRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateJWKS(req *ssov1.JWKSRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateLogout(req *ssov1.LogoutRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateLogoutAll(req *ssov1.LogoutAllRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateIntrospect(req *ssov1.IntrospectRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateRevokeToken(req *ssov1.RevokeTokenRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetRevokeToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty revoke token")
+	}
+
+	return nil
+}
+
+func validateCheckPermission(req *ssov1.CheckPermissionRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetPermission() == "" {
+		return status.Error(codes.InvalidArgument, "empty permission")
+	}
+
+	return nil
+}
+
+func validateListUserRoles(req *ssov1.ListUserRolesRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateAssignRole(req *ssov1.AssignRoleRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetRole() == "" {
+		return status.Error(codes.InvalidArgument, "empty role")
+	}
+
+	return nil
+}
+
+func validateUnassignRole(req *ssov1.UnassignRoleRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetRole() == "" {
+		return status.Error(codes.InvalidArgument, "empty role")
+	}
+
+	return nil
+}
+
+func validateClientCredentials(req *ssov1.ClientCredentialsRequest) error {
+	if req.GetClientId() == "" {
+		return status.Error(codes.InvalidArgument, "empty client id")
+	}
+
+	if req.GetClientSecret() == "" {
+		return status.Error(codes.InvalidArgument, "empty client secret")
+	}
+
+	return nil
+}
+
+func validateDeviceAuthorization(req *ssov1.DeviceAuthorizationRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateApproveDevice(req *ssov1.ApproveDeviceRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetUserCode() == "" {
+		return status.Error(codes.InvalidArgument, "empty user code")
+	}
+
+	return nil
+}
+
+func validateDeviceToken(req *ssov1.DeviceTokenRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetDeviceCode() == "" {
+		return status.Error(codes.InvalidArgument, "empty device code")
+	}
+
+	return nil
+}
+
+func validateTokenExchange(req *ssov1.TokenExchangeRequest) error {
+	if req.GetClientId() == "" {
+		return status.Error(codes.InvalidArgument, "empty client id")
+	}
+
+	if req.GetClientSecret() == "" {
+		return status.Error(codes.InvalidArgument, "empty client secret")
+	}
+
+	if req.GetSubjectToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty subject token")
+	}
+
+	if req.GetAudience() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty audience")
+	}
+
+	if req.GetScope() == "" {
+		return status.Error(codes.InvalidArgument, "empty scope")
+	}
+
+	return nil
+}
+
+func validateImpersonate(req *ssov1.ImpersonateRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty user id")
+	}
+
+	if req.GetReason() == "" {
+		return status.Error(codes.InvalidArgument, "empty reason")
+	}
+
+	return nil
+}
+
+func validateEnrollTOTP(req *ssov1.EnrollTOTPRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateConfirmTOTP(req *ssov1.ConfirmTOTPRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if req.GetCode() == "" {
+		return status.Error(codes.InvalidArgument, "empty code")
+	}
+
+	return nil
+}
+
+func validateVerifyMFA(req *ssov1.VerifyMFARequest) error {
+	if req.GetChallengeId() == "" {
+		return status.Error(codes.InvalidArgument, "empty challenge id")
+	}
+
+	if req.GetCode() == "" {
+		return status.Error(codes.InvalidArgument, "empty code")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateBeginPasskeyRegistration(req *ssov1.BeginPasskeyRegistrationRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateFinishPasskeyRegistration(req *ssov1.FinishPasskeyRegistrationRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if len(req.GetClientDataJson()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty client data")
+	}
+
+	if len(req.GetAttestationObject()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty attestation object")
+	}
+
+	return nil
+}
+
+func validateBeginPasskeyLogin(req *ssov1.BeginPasskeyLoginRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	return nil
+}
+
+func validateFinishPasskeyLogin(req *ssov1.FinishPasskeyLoginRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "empty app id")
+	}
+
+	if len(req.GetCredentialId()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty credential id")
+	}
+
+	if len(req.GetClientDataJson()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty client data")
+	}
+
+	if len(req.GetAuthenticatorData()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty authenticator data")
+	}
+
+	if len(req.GetSignature()) == 0 {
+		return status.Error(codes.InvalidArgument, "empty signature")
+	}
+
+	return nil
+}
+
+func validateSendVerificationEmail(req *ssov1.SendVerificationEmailRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "empty email")
+	}
+
+	return nil
+}
+
+func validateVerifyEmail(req *ssov1.VerifyEmailRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	return nil
+}
+
+func validateRequestPasswordReset(req *ssov1.RequestPasswordResetRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "empty email")
+	}
+
+	return nil
+}
+
+func validateResetPassword(req *ssov1.ResetPasswordRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "empty token")
+	}
+	if req.GetPassword() == "" {
+		return status.Error(codes.InvalidArgument, "empty password")
 	}
 
 	return nil
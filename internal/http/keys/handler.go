@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"context"
+	"encoding/json"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	service "grpc/internal/services/auth"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type Keys interface {
+	JWKS(ctx context.Context, appID int) ([]jwt.JWK, error)
+}
+
+type handler struct {
+	log  *slog.Logger
+	keys Keys
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, keys Keys) {
+	h := &handler{log: log, keys: keys}
+
+	mux.HandleFunc("GET /apps/{app_id}/.well-known/jwks.json", h.JWKS)
+}
+
+func (h *handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	const op = "http.keys.JWKS"
+
+	appID, err := strconv.Atoi(r.PathValue("app_id"))
+	if err != nil || appID == 0 {
+		http.Error(w, "invalid app id", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.keys.JWKS(r.Context(), appID)
+	if err != nil {
+		if err == service.ErrInvalidData {
+			http.Error(w, "app not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(jwt.JWKS{Keys: keys}); err != nil {
+		h.log.Error("failed to write response", sl.OpErr(op, err))
+	}
+}
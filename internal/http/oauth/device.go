@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"errors"
+	"grpc/internal/domain/models"
+	service "grpc/internal/services/auth"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// devicePage is the verification page. Without a request it asks for the
+// user code; with one it shows the app and scope and asks the user to sign
+// in and decide.
+type devicePage struct {
+	UserCode    string
+	Request     models.DeviceRequest
+	Email       string
+	ChallengeID string
+	Error       string
+	Done        bool
+	Approved    bool
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceAuthorization starts the device authorization grant for a device
+// that cannot show the login page itself (RFC 8628, section 3.1).
+func (h *handler) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "malformed request body")
+		return
+	}
+
+	appID, err := strconv.Atoi(r.PostForm.Get("client_id"))
+	if err != nil || appID == 0 {
+		h.writeTokenError(w, http.StatusUnauthorized, errInvalidClient, "invalid client id")
+		return
+	}
+
+	auth, err := h.oauth.DeviceAuthorization(r.Context(), appID, r.PostForm.Get("scope"))
+	if err != nil {
+		h.tokenError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         auth.VerificationURI,
+		VerificationURIComplete: auth.VerificationURIComplete,
+		ExpiresIn:               int64(auth.ExpiresIn.Seconds()),
+		Interval:                int64(auth.Interval.Seconds()),
+	})
+}
+
+// DevicePage shows the verification page. With a user code, typed by the
+// user or from the complete verification URI, it shows the request.
+func (h *handler) DevicePage(w http.ResponseWriter, r *http.Request) {
+	page := devicePage{UserCode: r.URL.Query().Get("user_code")}
+	if page.UserCode == "" {
+		h.render(w, http.StatusOK, "device.html", page)
+		return
+	}
+
+	request, err := h.oauth.DeviceRequest(r.Context(), page.UserCode)
+	if err != nil {
+		h.deviceError(w, page, err)
+		return
+	}
+
+	page.Request = request
+	h.render(w, http.StatusOK, "device.html", page)
+}
+
+// Device checks the credentials sent from the verification page and records
+// whether the user allowed the device. Users with a second factor get the
+// page again, asking for a code.
+func (h *handler) Device(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oauth.Device"
+
+	if err := r.ParseForm(); err != nil {
+		h.render(w, http.StatusBadRequest, "device.html", devicePage{Error: "invalid request"})
+		return
+	}
+
+	page := devicePage{
+		UserCode: r.PostForm.Get("user_code"),
+		Email:    r.PostForm.Get("email"),
+	}
+	approve := r.PostForm.Get("action") != "deny"
+
+	request, err := h.oauth.DeviceRequest(r.Context(), page.UserCode)
+	if err != nil {
+		h.deviceError(w, page, err)
+		return
+	}
+	page.Request = request
+
+	if challengeID := r.PostForm.Get("challenge_id"); challengeID != "" {
+		err = h.oauth.ApproveDeviceWithMFA(r.Context(), page.UserCode, challengeID, r.PostForm.Get("mfa_code"), approve)
+		if errors.Is(err, service.ErrInvalidMFACode) {
+			page.ChallengeID = challengeID
+		}
+	} else {
+		page.ChallengeID, err = h.oauth.ApproveDeviceWithPassword(r.Context(), page.UserCode, page.Email, r.PostForm.Get("password"), approve)
+		if err == nil && page.ChallengeID != "" {
+			h.render(w, http.StatusOK, "device.html", page)
+			return
+		}
+	}
+	if err != nil {
+		h.deviceError(w, page, err)
+		return
+	}
+
+	h.log.Info("device authorization decided on verification page", slog.String("op", op), slog.Bool("approved", approve))
+	h.render(w, http.StatusOK, "device.html", devicePage{Done: true, Approved: approve})
+}
+
+// deviceError shows the verification page again with the error. Without a
+// valid user code the page asks for the code again.
+func (h *handler) deviceError(w http.ResponseWriter, page devicePage, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvPassOrEmail):
+		page.Error = service.ErrInvPassOrEmail.Error()
+		h.render(w, http.StatusUnauthorized, "device.html", page)
+	case errors.Is(err, service.ErrEmailNotVerified):
+		page.Error = "verify your email address to sign in"
+		h.render(w, http.StatusForbidden, "device.html", page)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		page.Error = "invalid authentication code"
+		h.render(w, http.StatusUnauthorized, "device.html", page)
+	case errors.Is(err, service.ErrUnauthorized):
+		page.Error = "sign in again"
+		h.render(w, http.StatusUnauthorized, "device.html", page)
+	case errors.Is(err, service.ErrInvalidData):
+		page.Error = "invalid or expired code"
+		page.Request = models.DeviceRequest{}
+		h.render(w, http.StatusBadRequest, "device.html", page)
+	case errors.Is(err, service.ErrTooManyAttempts):
+		page.Error = "too many invalid codes, try again later"
+		page.Request = models.DeviceRequest{}
+		h.render(w, http.StatusTooManyRequests, "device.html", page)
+	default:
+		page.Error = "internal error"
+		h.render(w, http.StatusInternalServerError, "device.html", page)
+	}
+}
@@ -0,0 +1,494 @@
+package oauth
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	service "grpc/internal/services/auth"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken       = "urn:ietf:params:oauth:token-type:access_token"
+	responseTypeCode           = "code"
+	tokenTypeBearer            = "Bearer"
+)
+
+// Error codes from RFC 6749, sections 4.1.2.1 and 5.2.
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errInvalidScope            = "invalid_scope"
+	errInvalidTarget           = "invalid_target"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errServerError             = "server_error"
+)
+
+// Error codes of the device authorization grant from RFC 8628, section 3.5.
+const (
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errAccessDenied         = "access_denied"
+	errExpiredToken         = "expired_token"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var pages = template.Must(template.ParseFS(templates, "templates/*.html"))
+
+type OAuth interface {
+	ValidateAuthorization(ctx context.Context, req models.AuthorizationRequest) (models.App, error)
+	AuthorizeUser(ctx context.Context, req models.AuthorizationRequest, email string, password string) (code string, challengeID string, err error)
+	AuthorizeUserMFA(ctx context.Context, req models.AuthorizationRequest, challengeID string, mfaCode string) (code string, err error)
+	ExchangeCode(ctx context.Context, appID int, code string, redirectURI string, codeVerifier string) (models.TokensPair, error)
+	RefreshToken(ctx context.Context, token string, appID int, scope string) (models.TokensPair, error)
+	ClientCredentials(ctx context.Context, clientID string, clientSecret string, scope string) (models.TokensPair, error)
+	DeviceAuthorization(ctx context.Context, appID int, scope string) (models.DeviceAuthorization, error)
+	DeviceRequest(ctx context.Context, userCode string) (models.DeviceRequest, error)
+	ApproveDeviceWithPassword(ctx context.Context, userCode string, email string, password string, approve bool) (challengeID string, err error)
+	ApproveDeviceWithMFA(ctx context.Context, userCode string, challengeID string, mfaCode string, approve bool) error
+	DeviceToken(ctx context.Context, appID int, deviceCode string) (models.TokensPair, error)
+	TokenExchange(ctx context.Context, clientID string, clientSecret string, subjectToken string, audience int, scope string) (models.TokensPair, error)
+}
+
+type handler struct {
+	log   *slog.Logger
+	oauth OAuth
+}
+
+type loginPage struct {
+	AppName     string
+	Request     models.AuthorizationRequest
+	Email       string
+	ChallengeID string
+	Error       string
+	Fatal       bool
+}
+
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, oauth OAuth) {
+	h := &handler{log: log, oauth: oauth}
+
+	mux.HandleFunc("GET /authorize", h.AuthorizePage)
+	mux.HandleFunc("POST /authorize", h.Authorize)
+	mux.HandleFunc("POST /token", h.Token)
+	mux.HandleFunc("POST /device_authorization", h.DeviceAuthorization)
+	mux.HandleFunc("GET /device", h.DevicePage)
+	mux.HandleFunc("POST /device", h.Device)
+}
+
+// AuthorizePage shows the login page for an authorization request.
+func (h *handler) AuthorizePage(w http.ResponseWriter, r *http.Request) {
+	req, err := authorizationRequest(r.URL.Query())
+	if err != nil {
+		h.renderLogin(w, http.StatusBadRequest, loginPage{Error: "invalid client", Fatal: true})
+		return
+	}
+
+	app, err := h.oauth.ValidateAuthorization(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	if r.URL.Query().Get("response_type") != responseTypeCode {
+		redirectError(w, r, req, errUnsupportedResponseType)
+		return
+	}
+
+	h.renderLogin(w, http.StatusOK, loginPage{AppName: app.Name, Request: req})
+}
+
+// Authorize checks the credentials sent from the login page and redirects
+// the user back to the client with an authorization code. Users with a
+// second factor get the page again, asking for a code.
+func (h *handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oauth.Authorize"
+
+	if err := r.ParseForm(); err != nil {
+		h.renderLogin(w, http.StatusBadRequest, loginPage{Error: "invalid request", Fatal: true})
+		return
+	}
+
+	req, err := authorizationRequest(r.PostForm)
+	if err != nil {
+		h.renderLogin(w, http.StatusBadRequest, loginPage{Error: "invalid client", Fatal: true})
+		return
+	}
+
+	app, err := h.oauth.ValidateAuthorization(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	if r.PostForm.Get("response_type") != responseTypeCode {
+		redirectError(w, r, req, errUnsupportedResponseType)
+		return
+	}
+
+	var code string
+	if challengeID := r.PostForm.Get("challenge_id"); challengeID != "" {
+		code, err = h.oauth.AuthorizeUserMFA(r.Context(), req, challengeID, r.PostForm.Get("mfa_code"))
+		switch {
+		case errors.Is(err, service.ErrInvalidMFACode):
+			page := loginPage{
+				AppName:     app.Name,
+				Request:     req,
+				ChallengeID: challengeID,
+				Error:       "invalid authentication code",
+			}
+			h.renderLogin(w, http.StatusUnauthorized, page)
+			return
+		case errors.Is(err, service.ErrUnauthorized):
+			page := loginPage{
+				AppName: app.Name,
+				Request: req,
+				Error:   "sign in again",
+			}
+			h.renderLogin(w, http.StatusUnauthorized, page)
+			return
+		case err != nil:
+			h.authorizeError(w, r, req, err)
+			return
+		}
+	} else {
+		email := r.PostForm.Get("email")
+		code, challengeID, err = h.oauth.AuthorizeUser(r.Context(), req, email, r.PostForm.Get("password"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvPassOrEmail) {
+				page := loginPage{
+					AppName: app.Name,
+					Request: req,
+					Email:   email,
+					Error:   service.ErrInvPassOrEmail.Error(),
+				}
+				h.renderLogin(w, http.StatusUnauthorized, page)
+				return
+			}
+			if errors.Is(err, service.ErrEmailNotVerified) {
+				page := loginPage{
+					AppName: app.Name,
+					Request: req,
+					Email:   email,
+					Error:   "verify your email address to sign in",
+				}
+				h.renderLogin(w, http.StatusForbidden, page)
+				return
+			}
+			h.authorizeError(w, r, req, err)
+			return
+		}
+		if challengeID != "" {
+			h.renderLogin(w, http.StatusOK, loginPage{AppName: app.Name, Request: req, ChallengeID: challengeID})
+			return
+		}
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	h.log.Info("user redirected with authorization code", slog.String("op", op), slog.Int("app_id", req.AppID))
+	redirect(w, r, req.RedirectURI, params)
+}
+
+// Token issues tokens for the authorization_code, refresh_token,
+// client_credentials, device_code and token-exchange grants.
+func (h *handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "malformed request body")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case grantTypeClientCredentials:
+		h.clientCredentials(w, r)
+		return
+	case grantTypeTokenExchange:
+		h.tokenExchange(w, r)
+		return
+	}
+
+	appID, err := strconv.Atoi(r.PostForm.Get("client_id"))
+	if err != nil || appID == 0 {
+		h.writeTokenError(w, http.StatusUnauthorized, errInvalidClient, "invalid client id")
+		return
+	}
+
+	var tokens models.TokensPair
+	switch r.PostForm.Get("grant_type") {
+	case grantTypeAuthorizationCode:
+		code := r.PostForm.Get("code")
+		verifier := r.PostForm.Get("code_verifier")
+		if code == "" || verifier == "" {
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "empty code or code verifier")
+			return
+		}
+		tokens, err = h.oauth.ExchangeCode(r.Context(), appID, code, r.PostForm.Get("redirect_uri"), verifier)
+	case grantTypeRefreshToken:
+		token := r.PostForm.Get("refresh_token")
+		if token == "" {
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "empty refresh token")
+			return
+		}
+		tokens, err = h.oauth.RefreshToken(r.Context(), token, appID, r.PostForm.Get("scope"))
+	case grantTypeDeviceCode:
+		deviceCode := r.PostForm.Get("device_code")
+		if deviceCode == "" {
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "empty device code")
+			return
+		}
+		tokens, err = h.oauth.DeviceToken(r.Context(), appID, deviceCode)
+	default:
+		h.writeTokenError(w, http.StatusBadRequest, errUnsupportedGrantType, "")
+		return
+	}
+	if err != nil {
+		h.tokenError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+	})
+}
+
+// clientCredentials issues a token to a service client for its own app.
+func (h *handler) clientCredentials(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := h.clientAuth(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.oauth.ClientCredentials(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		if err == service.ErrInvalidData {
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidScope, "")
+			return
+		}
+		h.tokenError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+		Scope:       tokens.Scope,
+	})
+}
+
+// tokenExchange issues a token for another app to a service client acting
+// on behalf of the owner of the subject token (RFC 8693). The audience is
+// the id of that app.
+func (h *handler) tokenExchange(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := h.clientAuth(w, r)
+	if !ok {
+		return
+	}
+
+	subjectToken := r.PostForm.Get("subject_token")
+	if subjectToken == "" || r.PostForm.Get("subject_token_type") != tokenTypeAccessToken {
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "subject token must be an access token")
+		return
+	}
+
+	audience, err := strconv.Atoi(r.PostForm.Get("audience"))
+	if err != nil || audience == 0 {
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidTarget, "invalid audience")
+		return
+	}
+
+	tokens, err := h.oauth.TokenExchange(r.Context(), clientID, clientSecret, subjectToken, audience, r.PostForm.Get("scope"))
+	if err != nil {
+		switch err {
+		case service.ErrInvalidData:
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidScope, "")
+		case service.ErrInvalidTarget:
+			h.writeTokenError(w, http.StatusBadRequest, errInvalidTarget, "")
+		default:
+			h.tokenError(w, err)
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:     tokens.AccessToken,
+		IssuedTokenType: tokenTypeAccessToken,
+		TokenType:       tokenTypeBearer,
+		ExpiresIn:       int64(tokens.ExpiresIn.Seconds()),
+		Scope:           tokens.Scope,
+	})
+}
+
+// clientAuth returns the credentials of a service client sent with HTTP
+// Basic authentication or as client_id and client_secret in the form. It
+// writes the error itself when there are none.
+func (h *handler) clientAuth(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		h.writeTokenError(w, http.StatusUnauthorized, errInvalidClient, "missing client credentials")
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
+
+// authorizeError reports an error of an authorization request. Invalid
+// requests are sent back to the client; every other error is shown to the
+// user, since the redirect URI may not have been checked yet.
+func (h *handler) authorizeError(w http.ResponseWriter, r *http.Request, req models.AuthorizationRequest, err error) {
+	switch err {
+	case service.ErrInvalidClient:
+		h.renderLogin(w, http.StatusBadRequest, loginPage{Error: "invalid client", Fatal: true})
+	case service.ErrInvalidRedirectURI:
+		h.renderLogin(w, http.StatusBadRequest, loginPage{Error: "invalid redirect uri", Fatal: true})
+	case service.ErrInvalidData:
+		redirectError(w, r, req, errInvalidRequest)
+	default:
+		h.renderLogin(w, http.StatusInternalServerError, loginPage{Error: "internal error", Fatal: true})
+	}
+}
+
+func (h *handler) tokenError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrInvalidClient:
+		h.writeTokenError(w, http.StatusUnauthorized, errInvalidClient, "")
+	case service.ErrInvalidGrant, service.ErrUnauthorized:
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidGrant, "")
+	case service.ErrEmailNotVerified:
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidGrant, service.ErrEmailNotVerified.Error())
+	case service.ErrInvalidData:
+		h.writeTokenError(w, http.StatusBadRequest, errInvalidRequest, "")
+	case service.ErrAuthorizationPending:
+		h.writeTokenError(w, http.StatusBadRequest, errAuthorizationPending, "")
+	case service.ErrSlowDown:
+		h.writeTokenError(w, http.StatusBadRequest, errSlowDown, "")
+	case service.ErrAccessDenied:
+		h.writeTokenError(w, http.StatusBadRequest, errAccessDenied, "")
+	case service.ErrExpiredToken:
+		h.writeTokenError(w, http.StatusBadRequest, errExpiredToken, "")
+	default:
+		h.writeTokenError(w, http.StatusInternalServerError, errServerError, "")
+	}
+}
+
+func (h *handler) renderLogin(w http.ResponseWriter, status int, page loginPage) {
+	h.render(w, status, "login.html", page)
+}
+
+func (h *handler) render(w http.ResponseWriter, status int, name string, page any) {
+	const op = "http.oauth.render"
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := pages.ExecuteTemplate(w, name, page); err != nil {
+		h.log.Error("failed to render page", sl.OpErr(op, err), slog.String("page", name))
+	}
+}
+
+func (h *handler) writeTokenError(w http.ResponseWriter, status int, code string, description string) {
+	h.writeJSON(w, status, errorResponse{Error: code, ErrorDescription: description})
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, body any) {
+	const op = "http.oauth.writeJSON"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.log.Error("failed to write response", sl.OpErr(op, err))
+	}
+}
+
+func authorizationRequest(params url.Values) (models.AuthorizationRequest, error) {
+	appID, err := strconv.Atoi(params.Get("client_id"))
+	if err != nil || appID == 0 {
+		return models.AuthorizationRequest{}, service.ErrInvalidClient
+	}
+
+	return models.AuthorizationRequest{
+		AppID:               appID,
+		RedirectURI:         params.Get("redirect_uri"),
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+	}, nil
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req models.AuthorizationRequest, code string) {
+	params := url.Values{"error": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	redirect(w, r, req.RedirectURI, params)
+}
+
+// redirect sends the user to a registered redirect URI with params added to
+// its query.
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	service "grpc/internal/services/auth"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type OIDC interface {
+	ProviderJWKS(ctx context.Context) ([]jwt.JWK, error)
+	UserInfo(ctx context.Context, token string) (models.UserInfo, error)
+}
+
+type handler struct {
+	log    *slog.Logger
+	issuer string
+	oidc   OIDC
+}
+
+// configuration is the provider metadata from OpenID Connect Discovery 1.0,
+// section 3.
+type configuration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Register serves the discovery document, the keys of all apps and the
+// userinfo endpoint. The issuer must be the URL the HTTP server is reachable
+// at, since clients compare it with the iss claim of ID tokens.
+func Register(mux *http.ServeMux, log *slog.Logger, issuer string, oidc OIDC) {
+	h := &handler{log: log, issuer: strings.TrimSuffix(issuer, "/"), oidc: oidc}
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.Configuration)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.JWKS)
+	mux.HandleFunc("GET /userinfo", h.UserInfo)
+	mux.HandleFunc("POST /userinfo", h.UserInfo)
+}
+
+func (h *handler) Configuration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	h.writeJSON(w, http.StatusOK, configuration{
+		Issuer:                            h.issuer,
+		AuthorizationEndpoint:             h.issuer + "/authorize",
+		TokenEndpoint:                     h.issuer + "/token",
+		DeviceAuthorizationEndpoint:       h.issuer + "/device_authorization",
+		UserInfoEndpoint:                  h.issuer + "/userinfo",
+		JWKSURI:                           h.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA, jwt.AlgHS512},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{models.CodeChallengeS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "name", "email", "email_verified"},
+	})
+}
+
+// JWKS returns the public keys of every app. Apps signing with a shared
+// secret verify their ID tokens with the secret instead.
+func (h *handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.oidc.ProviderJWKS(r.Context())
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, jwt.JWKS{Keys: keys})
+}
+
+// UserInfo returns the claims about the owner of the bearer token, as
+// described in OpenID Connect Core 1.0, section 5.3.
+func (h *handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	info, err := h.oidc.UserInfo(r.Context(), token)
+	if err != nil {
+		if err == service.ErrUnauthorized || err == service.ErrInvalidData {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusOK, info)
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, body any) {
+	const op = "http.oidc.writeJSON"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.log.Error("failed to write response", sl.OpErr(op, err))
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
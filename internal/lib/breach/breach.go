@@ -0,0 +1,206 @@
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	hashHexSize   = sha1.Size * 2
+	prefixHexSize = 5
+)
+
+var ErrEmpty = errors.New("no breached password hashes found")
+
+// Filter is a bloom filter of the SHA-1 hashes of breached passwords. It
+// never misses a listed password, and reports an unlisted one with about
+// the false positive rate it was built with.
+type Filter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+	count  int
+}
+
+// Load builds a filter from the Have I Been Pwned password list in the
+// downloadable format: either a file with one HASH:COUNT line per hash, or
+// a directory of range files named after the first five hex digits of the
+// hashes, with SUFFIX:COUNT lines. Hashes seen fewer than minCount times
+// are left out.
+func Load(path string, falsePositiveRate float64, minCount int) (*Filter, error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, fmt.Errorf("invalid false positive rate %v", falsePositiveRate)
+	}
+
+	files, err := corpusFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The list is read twice, first to size the filter and then to fill
+	// it, so that it never has to be held in memory.
+	count := 0
+	for _, file := range files {
+		if err := readHashes(file, minCount, func([]byte) { count++ }); err != nil {
+			return nil, err
+		}
+	}
+	if count == 0 {
+		return nil, ErrEmpty
+	}
+
+	filter := newFilter(count, falsePositiveRate)
+	for _, file := range files {
+		if err := readHashes(file, minCount, filter.add); err != nil {
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
+
+// Contains reports whether the password is probably in the list.
+func (f *Filter) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+
+	h1, h2 := f.positions(sum[:])
+	for i := range f.hashes {
+		bit := (h1 + i*h2) % f.size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Len returns the number of hashes in the filter.
+func (f *Filter) Len() int {
+	return f.count
+}
+
+// SizeBytes returns the memory taken by the filter bits.
+func (f *Filter) SizeBytes() int {
+	return len(f.bits) * 8
+}
+
+// newFilter sizes a filter for n hashes: m = -n ln p / (ln 2)^2 bits and
+// k = m/n ln 2 hash functions.
+func newFilter(n int, falsePositiveRate float64) *Filter {
+	size := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(max(1, math.Round(float64(size)/float64(n)*math.Ln2)))
+
+	return &Filter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+func (f *Filter) add(hash []byte) {
+	h1, h2 := f.positions(hash)
+	for i := range f.hashes {
+		bit := (h1 + i*h2) % f.size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// positions derives the bit positions by double hashing. SHA-1 output is
+// uniform already, so its bytes are used directly.
+func (f *Filter) positions(hash []byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(hash[0:8]), binary.BigEndian.Uint64(hash[8:16]) | 1
+}
+
+// corpusFiles returns the file at path, or the range files in the
+// directory at path.
+func corpusFiles(path string) ([]corpusFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []corpusFile{{path: path}}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []corpusFile
+	for _, entry := range entries {
+		prefix := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if entry.IsDir() || len(prefix) != prefixHexSize || !isHex(prefix) {
+			continue
+		}
+		files = append(files, corpusFile{path: filepath.Join(path, entry.Name()), prefix: strings.ToUpper(prefix)})
+	}
+
+	return files, nil
+}
+
+type corpusFile struct {
+	path   string
+	prefix string
+}
+
+func readHashes(file corpusFile, minCount int, fn func(hash []byte)) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return scanHashes(f, file.prefix, minCount, fn)
+}
+
+func scanHashes(r io.Reader, prefix string, minCount int, fn func(hash []byte)) error {
+	hash := make([]byte, sha1.Size)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hexHash, countText, hasCount := strings.Cut(text, ":")
+		hexHash = prefix + hexHash
+		if len(hexHash) != hashHexSize {
+			return fmt.Errorf("line %d: invalid hash length", line)
+		}
+		if _, err := hex.Decode(hash, []byte(hexHash)); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if hasCount && minCount > 1 {
+			count, err := strconv.Atoi(countText)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid count: %w", line, err)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+
+		fn(hash)
+	}
+
+	return scanner.Err()
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// TTL is a set of keys that each expire at their own time. It is safe for
+// concurrent use.
+type TTL[K comparable] struct {
+	mu      sync.Mutex
+	entries map[K]time.Time
+	sweepAt time.Time
+}
+
+// sweepInterval is how often Set drops expired keys. Has ignores expired
+// keys in between.
+const sweepInterval = time.Minute
+
+func NewTTL[K comparable]() *TTL[K] {
+	return &TTL[K]{
+		entries: make(map[K]time.Time),
+	}
+}
+
+// Set adds the key until expiresAt. Keys that have already expired are not
+// added.
+func (c *TTL[K]) Set(key K, expiresAt time.Time) {
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.sweepAt) {
+		for k, exp := range c.entries {
+			if !exp.After(now) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = now.Add(sweepInterval)
+	}
+
+	c.entries[key] = expiresAt
+}
+
+// Has reports whether the key was added and has not expired.
+func (c *TTL[K]) Has(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exp, ok := c.entries[key]
+	return ok && exp.After(time.Now())
+}
@@ -0,0 +1,20 @@
+package clientinfo
+
+import "context"
+
+// Info describes the client a request came from.
+type Info struct {
+	IP        string
+	UserAgent string
+}
+
+type ctxKey struct{}
+
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(ctxKey{}).(Info)
+	return info
+}
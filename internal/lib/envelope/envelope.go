@@ -0,0 +1,206 @@
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values. Values without it are plaintext written
+// before encryption was enabled.
+const prefix = "enc:v1:"
+
+const dataKeySize = 32
+
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// KeyProvider wraps and unwraps data keys with master keys it holds, e.g.
+// in a local key file or a KMS.
+type KeyProvider interface {
+	// KeyID returns the id of the master key new data keys are wrapped with.
+	KeyID() string
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Cipher encrypts values with envelope encryption: every value gets its own
+// data key, which is stored next to the value wrapped by a master key of
+// the provider. An encrypted value has the form
+//
+//	enc:v1:<master key id>:<wrapped data key>:<nonce and ciphertext>
+//
+// with both binary parts base64 encoded. A Cipher without a provider leaves
+// values in plaintext.
+type Cipher struct {
+	provider KeyProvider
+
+	mu       sync.Mutex
+	dataKeys map[string][]byte
+}
+
+func New(provider KeyProvider) *Cipher {
+	return &Cipher{
+		provider: provider,
+		dataKeys: make(map[string][]byte),
+	}
+}
+
+func (c *Cipher) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	if c.provider == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := c.provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + strings.Join([]string{
+		c.provider.KeyID(),
+		base64.RawStdEncoding.EncodeToString(wrapped),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+// Decrypt returns the plaintext of an encrypted value. Plaintext values are
+// returned as they are.
+func (c *Cipher) Decrypt(ctx context.Context, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyID, wrapped, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := c.dataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsReencrypt reports whether the value is plaintext or was encrypted
+// under a master key other than the current one.
+func (c *Cipher) NeedsReencrypt(value string) bool {
+	if c.provider == nil {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+
+	keyID, _, _, err := parse(value)
+	return err != nil || keyID != c.provider.KeyID()
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// dataKey unwraps the data key, caching the result so that values read over
+// and over, like signing keys, do not call the provider every time.
+func (c *Cipher) dataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	cacheKey := keyID + ":" + string(wrapped)
+
+	c.mu.Lock()
+	dataKey, ok := c.dataKeys[cacheKey]
+	c.mu.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	if c.provider == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	dataKey, err := c.provider.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	c.mu.Lock()
+	c.dataKeys[cacheKey] = dataKey
+	c.mu.Unlock()
+
+	return dataKey, nil
+}
+
+func parse(value string) (keyID string, wrapped []byte, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+
+	wrapped, err = base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	sealed, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+
+	return parts[0], wrapped, sealed, nil
+}
+
+// seal encrypts with AES-256-GCM and prepends the nonce.
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
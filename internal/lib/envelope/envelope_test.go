@@ -0,0 +1,159 @@
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func masterKey(t *testing.T, id string) string {
+	t.Helper()
+
+	key := make([]byte, dataKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+func newCipher(t *testing.T, entries ...string) *Cipher {
+	t.Helper()
+
+	provider, err := NewLocalProvider(strings.Join(entries, ","))
+	require.NoError(t, err)
+
+	return New(provider)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := newCipher(t, masterKey(t, "current"))
+
+	encrypted, err := c.Encrypt(ctx, "secret")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.True(t, strings.HasPrefix(encrypted, "enc:v1:current:"))
+	assert.NotContains(t, encrypted, "secret")
+	assert.False(t, c.NeedsReencrypt(encrypted))
+
+	decrypted, err := c.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+
+	// Every value gets its own data key.
+	again, err := c.Encrypt(ctx, "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+}
+
+func TestPlaintext(t *testing.T) {
+	ctx := context.Background()
+
+	// Values written before encryption was enabled are read as they are.
+	c := newCipher(t, masterKey(t, "current"))
+	decrypted, err := c.Decrypt(ctx, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+	assert.True(t, c.NeedsReencrypt("secret"))
+
+	// Without a provider values stay in plaintext.
+	plain := New(nil)
+	encrypted, err := plain.Encrypt(ctx, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", encrypted)
+	assert.False(t, plain.NeedsReencrypt("secret"))
+
+	_, err = plain.Decrypt(ctx, mustEncrypt(t, c, "secret"))
+	require.ErrorIs(t, err, ErrNoMasterKey)
+}
+
+func TestWrongKey(t *testing.T) {
+	ctx := context.Background()
+
+	encrypted := mustEncrypt(t, newCipher(t, masterKey(t, "current")), "secret")
+
+	// Another key under the same id cannot unwrap the data key.
+	_, err := newCipher(t, masterKey(t, "current")).Decrypt(ctx, encrypted)
+	require.Error(t, err)
+
+	_, err = newCipher(t, masterKey(t, "other")).Decrypt(ctx, encrypted)
+	require.ErrorIs(t, err, ErrUnknownMasterKey)
+
+	// A tampered ciphertext does not open.
+	c := newCipher(t, masterKey(t, "current"))
+	encrypted = mustEncrypt(t, c, "secret")
+	keyID, wrapped, sealed, err := parse(encrypted)
+	require.NoError(t, err)
+	sealed[len(sealed)-1] ^= 1
+	tampered := prefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+	_, err = c.Decrypt(ctx, tampered)
+	require.Error(t, err)
+
+	for _, value := range []string{"enc:v1:", "enc:v1:current:!:!", "enc:v1::a:b", "enc:v1:current:a"} {
+		_, err := c.Decrypt(ctx, value)
+		require.ErrorIs(t, err, ErrMalformed, value)
+	}
+}
+
+func TestReencryptOnRotation(t *testing.T) {
+	ctx := context.Background()
+
+	oldKey := masterKey(t, "old")
+	encrypted := mustEncrypt(t, newCipher(t, oldKey), "secret")
+
+	// A new master key goes in front of the old one, which then only
+	// unwraps the data keys wrapped before.
+	rotated := newCipher(t, masterKey(t, "new"), oldKey)
+	assert.True(t, rotated.NeedsReencrypt(encrypted))
+
+	decrypted, err := rotated.Decrypt(ctx, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+
+	reencrypted := mustEncrypt(t, rotated, decrypted)
+	assert.True(t, strings.HasPrefix(reencrypted, "enc:v1:new:"))
+	assert.False(t, rotated.NeedsReencrypt(reencrypted))
+
+	decrypted, err = rotated.Decrypt(ctx, reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+}
+
+func TestNewLocalProvider(t *testing.T) {
+	first, second := masterKey(t, "first"), masterKey(t, "second")
+
+	provider, err := NewLocalProvider("# comment\n" + first + "\n" + second + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, "first", provider.KeyID())
+
+	tests := []struct {
+		name    string
+		entries string
+	}{
+		{name: "empty", entries: ""},
+		{name: "no id", entries: ":" + strings.TrimPrefix(first, "first:")},
+		{name: "not base64", entries: "key:not base64"},
+		{name: "short key", entries: "key:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "duplicate id", entries: first + "," + first},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLocalProvider(tt.entries)
+			require.Error(t, err)
+		})
+	}
+}
+
+func mustEncrypt(t *testing.T, c *Cipher, plaintext string) string {
+	t.Helper()
+
+	encrypted, err := c.Encrypt(context.Background(), plaintext)
+	require.NoError(t, err)
+
+	return encrypted
+}
@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNoMasterKey      = errors.New("no master key")
+	ErrUnknownMasterKey = errors.New("unknown master key")
+)
+
+// LocalProvider wraps data keys with AES-256 master keys held in memory.
+// The first key is the current one; the others only unwrap data keys
+// wrapped before the master key was rotated.
+type LocalProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalProvider parses master keys given as "<id>:<base64 key>" entries,
+// separated by commas or new lines, current key first. Lines starting with
+// # are ignored.
+func NewLocalProvider(entries string) (*LocalProvider, error) {
+	provider := &LocalProvider{
+		keys: make(map[string][]byte),
+	}
+
+	fields := strings.FieldsFunc(entries, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(field, ":")
+		if !ok || id == "" {
+			return nil, errors.New("master key entry must have the form <id>:<base64 key>")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("master key %q must be %d base64 encoded bytes", id, dataKeySize)
+		}
+		if _, ok := provider.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key %q", id)
+		}
+
+		if provider.current == "" {
+			provider.current = id
+		}
+		provider.keys[id] = key
+	}
+
+	if provider.current == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	return provider, nil
+}
+
+// LoadLocalProvider returns the provider of the master keys given inline,
+// or else of those in the key file. It returns ErrNoMasterKey if neither is
+// set.
+func LoadLocalProvider(keyFile string, keys string) (*LocalProvider, error) {
+	if keys != "" {
+		return NewLocalProvider(keys)
+	}
+	if keyFile == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLocalProvider(string(data))
+}
+
+func (p *LocalProvider) KeyID() string {
+	return p.current
+}
+
+func (p *LocalProvider) WrapKey(_ context.Context, dataKey []byte) ([]byte, error) {
+	return seal(p.keys[p.current], dataKey)
+}
+
+func (p *LocalProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+
+	return open(key, wrapped)
+}
@@ -0,0 +1,104 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public part of a signing key as described in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the public key of an asymmetric signing key. Keys
+// without an ID are named by their RFC 7638 thumbprint.
+func PublicJWK(key Key) (JWK, error) {
+	if !IsAsymmetric(key.Algorithm) {
+		return JWK{}, fmt.Errorf("%w: %s has no public key", ErrUnsupportedAlgorithm, key.Algorithm)
+	}
+
+	verifyKey, err := key.verifyKey()
+	if err != nil {
+		return JWK{}, err
+	}
+
+	jwk := JWK{
+		Use: "sig",
+		Alg: key.Algorithm,
+	}
+
+	switch public := verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encode(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = encode(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(public)
+	}
+
+	jwk.Kid = key.ID
+	if jwk.Kid == "" {
+		jwk.Kid, err = thumbprint(jwk)
+		if err != nil {
+			return JWK{}, err
+		}
+	}
+
+	return jwk, nil
+}
+
+func thumbprint(jwk JWK) (string, error) {
+	// encoding/json sorts map keys, which gives the lexicographic member
+	// order required by RFC 7638.
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "RSA":
+		members["n"] = jwk.N
+		members["e"] = jwk.E
+	case "EC":
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+		members["y"] = jwk.Y
+	case "OKP":
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -3,22 +3,105 @@ package jwt
 import (
 	"fmt"
 	"grpc/internal/domain/models"
+	"grpc/internal/lib/secret"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func CreateToken(userID int64, appID int, secret string, expires time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS512)
+// Options are the issuer and audience tokens are created for and checked
+// against. ClockSkew is the leeway allowed when checking the time claims.
+type Options struct {
+	Issuer    string
+	Audience  string
+	ClockSkew time.Duration
+}
+
+// Audience returns the audience of the tokens issued for the app.
+func Audience(appID int) string {
+	return strconv.Itoa(appID)
+}
 
-	fmt.Println(userID, appID, secret, expires)
+// CreateToken signs the claims of the token with the key. The registered
+// claims are filled in here: the subject is the user id, or the client id
+// for tokens of service clients, the audience and issuer come from opts,
+// and the token is valid from now until expires has passed.
+func CreateToken(claims models.Token, opts Options, key Key, expires time.Duration) (string, error) {
+	subject := strconv.FormatInt(claims.UserID, 10)
+	if claims.ClientID != "" {
+		subject = claims.ClientID
+	}
+
+	registered, err := registeredClaims(subject, opts, expires)
+	if err != nil {
+		return "", err
+	}
+	claims.RegisteredClaims = registered
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = userID
-	claims["app_id"] = appID
-	claims["exp"] = time.Now().Add(expires).Unix()
+	return sign(claims, key)
+}
 
-	tokenString, err := token.SignedString([]byte(secret))
+// CreateIDToken signs an OpenID Connect ID token with the key. The
+// registered claims are filled in the same way as by CreateToken, authTime
+// is when the user signed in.
+func CreateIDToken(claims models.IDToken, userID int64, authTime time.Time, opts Options, key Key, expires time.Duration) (string, error) {
+	registered, err := registeredClaims(strconv.FormatInt(userID, 10), opts, expires)
+	if err != nil {
+		return "", err
+	}
+	claims.RegisteredClaims = registered
+	claims.AuthTime = jwt.NewNumericDate(authTime)
+
+	return sign(claims, key)
+}
+
+// UnverifiedClaims returns the claims of the token without verifying it.
+// They may only be used to find the keys the token is verified with.
+func UnverifiedClaims(token string) (models.Token, error) {
+	var claims models.Token
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return models.Token{}, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	return claims, nil
+}
+
+func registeredClaims(subject string, opts Options, expires time.Duration) (jwt.RegisteredClaims, error) {
+	jti, err := secret.ID()
+	if err != nil {
+		return jwt.RegisteredClaims{}, err
+	}
+
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    opts.Issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{opts.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expires)),
+	}, nil
+}
+
+func sign(claims jwt.Claims, key Key) (string, error) {
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	signKey, err := key.signKey()
+	if err != nil {
+		return "", err
+	}
+
+	tokenString, err := token.SignedString(signKey)
 	if err != nil {
 		return "", err
 	}
@@ -26,16 +109,82 @@ func CreateToken(userID int64, appID int, secret string, expires time.Duration)
 	return tokenString, nil
 }
 
-func DecodeToken(token string, secret string) (models.Token, error) {
-	var model models.Token
+// DecodeToken verifies the token with the key named by its kid header. Keys
+// without an ID are tried when the kid matches none of the keys, and tokens
+// without a kid are tried against every key. The token must not be expired
+// and, when set in opts, must carry the issuer and audience.
+func DecodeToken(token string, opts Options, keys ...Key) (models.Token, error) {
+	var (
+		model models.Token
+		err   error
+	)
+
+	for _, key := range candidateKeys(token, keys) {
+		model = models.Token{}
+
+		var verifyKey any
+		verifyKey, err = key.verifyKey()
+		if err != nil {
+			continue
+		}
+
+		var jwtToken *jwt.Token
+		jwtToken, err = jwt.ParseWithClaims(token, &model, func(t *jwt.Token) (interface{}, error) {
+			return verifyKey, nil
+		}, parserOptions(key, opts)...)
+
+		if err == nil && jwtToken.Valid {
+			return model, nil
+		}
+	}
+
+	if err == nil {
+		err = ErrUnknownKey
+	}
+
+	return models.Token{}, fmt.Errorf("failed to decode token: %w", err)
+}
+
+func parserOptions(key Key, opts Options) []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{key.Algorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(opts.ClockSkew),
+	}
+	if opts.Issuer != "" {
+		options = append(options, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		options = append(options, jwt.WithAudience(opts.Audience))
+	}
 
-	jwtToken, err := jwt.ParseWithClaims(token, &model, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	return options
+}
+
+func candidateKeys(token string, keys []Key) []Key {
+	var kid string
+	if unverified, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{}); err == nil {
+		kid, _ = unverified.Header["kid"].(string)
+	}
 
-	if err != nil || !jwtToken.Valid {
-		return models.Token{}, fmt.Errorf("failed to decode token: %w", err)
+	// Tokens issued before key rotation carry no kid.
+	if kid == "" {
+		return keys
 	}
 
-	return model, nil
+	var matched, anonymous []Key
+	for _, key := range keys {
+		switch key.ID {
+		case kid:
+			matched = append(matched, key)
+		case "":
+			anonymous = append(anonymous, key)
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+	return anonymous
 }
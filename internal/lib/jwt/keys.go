@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits   = 2048
+	hmacKeyBytes = 64
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("no key matches the token")
+)
+
+// Key is the material used to sign and verify tokens. For HMAC algorithms
+// Secret holds the shared secret, for asymmetric ones a PEM encoded PKCS #8
+// private key. ID is written to the kid header of signed tokens.
+type Key struct {
+	ID        string
+	Algorithm string
+	Secret    string
+}
+
+func IsAsymmetric(alg string) bool {
+	switch alg {
+	case AlgRS256, AlgES256, AlgEdDSA:
+		return true
+	default:
+		return false
+	}
+}
+
+func ValidAlgorithm(alg string) bool {
+	return alg == AlgHS512 || IsAsymmetric(alg)
+}
+
+// GenerateKey creates new key material for alg: a random secret for HMAC
+// and a PEM encoded private key for asymmetric algorithms.
+func GenerateKey(alg string) (string, error) {
+	var (
+		private any
+		err     error
+	)
+
+	switch alg {
+	case AlgHS512:
+		secret := make([]byte, hmacKeyBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(secret), nil
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgHS512:
+		return jwt.SigningMethodHS512, nil
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+}
+
+func (k Key) signKey() (any, error) {
+	if !IsAsymmetric(k.Algorithm) {
+		if _, err := signingMethod(k.Algorithm); err != nil {
+			return nil, err
+		}
+		return []byte(k.Secret), nil
+	}
+
+	return k.privateKey()
+}
+
+func (k Key) verifyKey() (any, error) {
+	if !IsAsymmetric(k.Algorithm) {
+		return k.signKey()
+	}
+
+	private, err := k.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return private.Public(), nil
+}
+
+func (k Key) privateKey() (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(k.Secret))
+	if block == nil {
+		return nil, errors.New("failed to decode private key pem")
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	switch k.Algorithm {
+	case AlgRS256:
+		_, ok = private.(*rsa.PrivateKey)
+	case AlgES256:
+		_, ok = private.(*ecdsa.PrivateKey)
+	case AlgEdDSA:
+		_, ok = private.(ed25519.PrivateKey)
+	}
+	if !ok {
+		return nil, fmt.Errorf("private key does not match algorithm %s", k.Algorithm)
+	}
+
+	return private.(crypto.Signer), nil
+}
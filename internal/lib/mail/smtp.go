@@ -0,0 +1,184 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"grpc/internal/domain/models"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Connection security of an SMTP server.
+const (
+	SecurityNone     = "none"
+	SecuritySTARTTLS = "starttls"
+	SecurityTLS      = "tls"
+)
+
+// SMTPServer describes the SMTP server mail is sent through. Security is
+// one of SecurityNone, SecuritySTARTTLS and SecurityTLS. Without a
+// username no authentication is done.
+type SMTPServer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string
+	Timeout  time.Duration
+}
+
+// SMTP sends mail through an SMTP server, opening a connection for every
+// message.
+type SMTP struct {
+	server SMTPServer
+	from   *mail.Address
+	// rootCAs replaces the system roots the certificate of the server is
+	// verified with, for tests.
+	rootCAs *x509.CertPool
+}
+
+// NewSMTP returns a sender using the server, with the From address from.
+func NewSMTP(server SMTPServer, from string) (*SMTP, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	if server.Host == "" {
+		return nil, errors.New("empty smtp host")
+	}
+	switch server.Security {
+	case SecurityNone, SecuritySTARTTLS, SecurityTLS:
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q", server.Security)
+	}
+
+	return &SMTP{server: server, from: address}, nil
+}
+
+// Send delivers the message to the server. The whole exchange must finish
+// within the timeout of the server and is aborted when ctx is canceled.
+func (s *SMTP) Send(ctx context.Context, msg models.Mail) error {
+	data, err := compose(s.from.String(), msg, time.Now())
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	if s.server.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.server.Timeout)
+		defer cancel()
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	// Canceling ctx, e.g. when the outbox stops, aborts the exchange at once
+	// instead of at the deadline.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := s.exchange(conn, to.Address, data); err != nil {
+		// The deadline of the connection is that of ctx, whose timer may
+		// not have fired yet.
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w: %w", ctxErr, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// exchange sends the message over the connection and closes it.
+func (s *SMTP) exchange(conn net.Conn, to string, data []byte) error {
+	client, err := smtp.NewClient(conn, s.server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.server.Security == SecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if s.server.Username != "" {
+		auth := smtp.PlainAuth("", s.server.Username, s.server.Password, s.server.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.server.Host, strconv.Itoa(s.server.Port))
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.server.Security == SecurityTLS {
+		dialer := &tls.Dialer{Config: s.tlsConfig()}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = new(net.Dialer).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The client has no context of its own; the deadline bounds every
+	// command sent on the connection.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (s *SMTP) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: s.server.Host, RootCAs: s.rootCAs}
+}
@@ -0,0 +1,348 @@
+package mail
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"grpc/internal/domain/models"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a message accepted by the test server.
+type received struct {
+	from string
+	to   string
+	data string
+	tls  bool
+}
+
+// smtpServer is an SMTP server for tests that understands just enough of
+// the protocol for the client of net/smtp.
+type smtpServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	startTLS    bool
+	username    string
+	password    string
+	greet       bool
+	messages    chan received
+}
+
+func newSMTPServer(t *testing.T, cert tls.Certificate) *smtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	return &smtpServer{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		greet:     true,
+		messages:  make(chan received, 1),
+	}
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve() {
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	secure := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		secure = true
+	}
+	if !s.greet {
+		// Hold the connection open until the client gives up.
+		_, _ = conn.Read(make([]byte, 1))
+		return
+	}
+
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...any) bool {
+		return text.PrintfLine(format, args...) == nil
+	}
+
+	var (
+		authed bool
+		msg    received
+	)
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			if s.startTLS && !secure {
+				reply("250-STARTTLS")
+			}
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "STARTTLS":
+			if !s.startTLS || secure {
+				reply("502 not supported")
+				continue
+			}
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			mechanism, response, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(response)
+			if mechanism != "PLAIN" || err != nil || string(decoded) != "\x00"+s.username+"\x00"+s.password {
+				reply("535 authentication failed")
+				continue
+			}
+			authed = true
+			reply("235 authenticated")
+		case "MAIL":
+			if s.username != "" && !authed {
+				reply("530 authentication required")
+				continue
+			}
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			msg = received{from: from, tls: secure}
+			reply("250 ok")
+		case "RCPT":
+			msg.to = strings.TrimPrefix(arg, "TO:")
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			reply("250 queued")
+			s.messages <- msg
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+// testCertificate returns a self-signed certificate for localhost and a
+// pool trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+var testMail = models.Mail{
+	To:      "Jane <jane@example.com>",
+	Subject: "Hello",
+	Text:    "Hi Jane",
+}
+
+func TestSMTPSend(t *testing.T) {
+	cert, pool := testCertificate(t)
+
+	tests := []struct {
+		security string
+		username string
+		wantTLS  bool
+	}{
+		{security: SecurityNone},
+		{security: SecurityNone, username: "sso"},
+		{security: SecuritySTARTTLS, username: "sso", wantTLS: true},
+		{security: SecurityTLS, username: "sso", wantTLS: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.security+" "+tt.username, func(t *testing.T) {
+			server := newSMTPServer(t, cert)
+			server.startTLS = tt.security == SecuritySTARTTLS
+			server.implicitTLS = tt.security == SecurityTLS
+			server.username, server.password = tt.username, "secret"
+			server.serve()
+
+			sender, err := NewSMTP(SMTPServer{
+				Host:     "localhost",
+				Port:     server.port(),
+				Username: tt.username,
+				Password: "secret",
+				Security: tt.security,
+				Timeout:  5 * time.Second,
+			}, "SSO <no-reply@example.com>")
+			require.NoError(t, err)
+			sender.rootCAs = pool
+
+			require.NoError(t, sender.Send(context.Background(), testMail))
+
+			msg := <-server.messages
+			assert.Equal(t, "<no-reply@example.com>", msg.from)
+			assert.Equal(t, "<jane@example.com>", msg.to)
+			assert.Equal(t, tt.wantTLS, msg.tls)
+			assert.Contains(t, msg.data, "Subject: Hello")
+			assert.Contains(t, msg.data, "Hi Jane")
+		})
+	}
+}
+
+func TestSMTPSendErrors(t *testing.T) {
+	cert, pool := testCertificate(t)
+
+	tests := []struct {
+		name     string
+		setup    func(server *smtpServer)
+		security string
+		password string
+		rootCAs  *x509.CertPool
+		err      string
+	}{
+		{
+			name:     "wrong password",
+			setup:    func(server *smtpServer) { server.startTLS = true },
+			security: SecuritySTARTTLS,
+			password: "wrong",
+			rootCAs:  pool,
+			err:      "authentication failed",
+		},
+		{
+			name:     "no STARTTLS",
+			setup:    func(server *smtpServer) {},
+			security: SecuritySTARTTLS,
+			password: "secret",
+			rootCAs:  pool,
+			err:      "does not support STARTTLS",
+		},
+		{
+			name:     "untrusted certificate",
+			setup:    func(server *smtpServer) { server.implicitTLS = true },
+			security: SecurityTLS,
+			password: "secret",
+			err:      "certificate",
+		},
+		{
+			name:     "no greeting",
+			setup:    func(server *smtpServer) { server.greet = false },
+			security: SecurityNone,
+			password: "secret",
+			err:      "deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t, cert)
+			server.username, server.password = "sso", "secret"
+			tt.setup(server)
+			server.serve()
+
+			sender, err := NewSMTP(SMTPServer{
+				Host:     "localhost",
+				Port:     server.port(),
+				Username: "sso",
+				Password: tt.password,
+				Security: tt.security,
+				Timeout:  500 * time.Millisecond,
+			}, "SSO <no-reply@example.com>")
+			require.NoError(t, err)
+			sender.rootCAs = tt.rootCAs
+
+			start := time.Now()
+			require.ErrorContains(t, sender.Send(context.Background(), testMail), tt.err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Empty(t, server.messages)
+		})
+	}
+}
+
+func TestSMTPSendCanceled(t *testing.T) {
+	cert, _ := testCertificate(t)
+	server := newSMTPServer(t, cert)
+	server.greet = false
+	server.serve()
+
+	sender, err := NewSMTP(SMTPServer{
+		Host:     "localhost",
+		Port:     server.port(),
+		Security: SecurityNone,
+		Timeout:  time.Minute,
+	}, "SSO <no-reply@example.com>")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// Canceling does not wait for the timeout of the stalled exchange.
+	start := time.Now()
+	require.ErrorIs(t, sender.Send(ctx, testMail), context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestNewSMTP(t *testing.T) {
+	_, err := NewSMTP(SMTPServer{Host: "localhost", Security: SecurityNone}, "not an address")
+	require.Error(t, err)
+
+	_, err = NewSMTP(SMTPServer{Security: SecurityNone}, "no-reply@example.com")
+	require.Error(t, err)
+
+	_, err = NewSMTP(SMTPServer{Host: "localhost", Security: "ssl"}, "no-reply@example.com")
+	require.Error(t, err)
+}
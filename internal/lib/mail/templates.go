@@ -0,0 +1,183 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"grpc/internal/domain/models"
+	"html"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fallbackLocale is the locale of the built-in templates.
+const fallbackLocale = "en"
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// Templates renders mail from html/template files. Every file defines the
+// "subject" and "text" templates and optionally "html", and is found at
+//
+//	<locale>/<name>.html                for all apps
+//	apps/<app_id>/<locale>/<name>.html  for one app
+//
+// Files in the template directory replace the built-in ones with the same
+// path. A mail is rendered in the requested locale, its language without
+// the region, the default locale or English, whichever is found first, and
+// in each the template of the app wins over the one for all apps.
+//
+// The text and subject are escaped for HTML like the rest of the file;
+// they are unescaped again after rendering.
+type Templates struct {
+	defaultLocale string
+	templates     map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates and those in dir, if it is
+// not empty.
+func LoadTemplates(dir string, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     make(map[string]*template.Template),
+	}
+
+	builtin, err := fs.Sub(builtinTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.load(builtin); err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		if err := t.load(os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("load mail templates from %s: %w", dir, err)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *Templates) load(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(file) != ".html" {
+			return nil
+		}
+
+		key, err := templateKey(strings.TrimSuffix(file, ".html"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		tmpl, err := template.ParseFS(fsys, file)
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"subject", "text"} {
+			if tmpl.Lookup(name) == nil {
+				return fmt.Errorf("%s: no %q template", file, name)
+			}
+		}
+
+		t.templates[key] = tmpl
+		return nil
+	})
+}
+
+// Render renders the mail template with the name for the app, zero for
+// none, and the locale. The recipient is left to the caller.
+func (t *Templates) Render(name string, appID int, locale string, data any) (models.Mail, error) {
+	tmpl := t.lookup(name, appID, locale)
+	if tmpl == nil {
+		return models.Mail{}, fmt.Errorf("no mail template %q", name)
+	}
+
+	subject, err := execute(tmpl, "subject", data)
+	if err != nil {
+		return models.Mail{}, err
+	}
+	text, err := execute(tmpl, "text", data)
+	if err != nil {
+		return models.Mail{}, err
+	}
+
+	mail := models.Mail{
+		Subject: strings.Join(strings.Fields(html.UnescapeString(subject)), " "),
+		Text:    strings.TrimSpace(html.UnescapeString(text)) + "\n",
+	}
+
+	if tmpl.Lookup("html") != nil {
+		body, err := execute(tmpl, "html", data)
+		if err != nil {
+			return models.Mail{}, err
+		}
+		mail.HTML = strings.TrimSpace(body) + "\n"
+	}
+
+	return mail, nil
+}
+
+func (t *Templates) lookup(name string, appID int, locale string) *template.Template {
+	locale = normalizeLocale(locale)
+	language, _, _ := strings.Cut(locale, "-")
+
+	var tried []string
+	for _, candidate := range []string{locale, language, t.defaultLocale, fallbackLocale} {
+		if candidate == "" || slices.Contains(tried, candidate) {
+			continue
+		}
+		tried = append(tried, candidate)
+
+		if appID != 0 {
+			if tmpl, ok := t.templates[path.Join("apps", strconv.Itoa(appID), candidate, name)]; ok {
+				return tmpl
+			}
+		}
+		if tmpl, ok := t.templates[path.Join(candidate, name)]; ok {
+			return tmpl
+		}
+	}
+
+	return nil
+}
+
+// templateKey checks the path of a template file, without the extension,
+// and returns it with the locale normalized.
+func templateKey(file string) (string, error) {
+	parts := strings.Split(file, "/")
+	switch {
+	case len(parts) == 2:
+		return path.Join(normalizeLocale(parts[0]), parts[1]), nil
+	case len(parts) == 4 && parts[0] == "apps":
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return "", fmt.Errorf("invalid app id %q", parts[1])
+		}
+		return path.Join(parts[0], parts[1], normalizeLocale(parts[2]), parts[3]), nil
+	default:
+		return "", errors.New("not <locale>/<name>.html or apps/<app_id>/<locale>/<name>.html")
+	}
+}
+
+// normalizeLocale turns locales such as "pt_BR" and "PT-br" into "pt-br".
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func execute(tmpl *template.Template, name string, data any) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2KeySize = 32
+
+// Argon2id hashes passwords with argon2id, the variant recommended by
+// RFC 9106. Memory is in KiB.
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (a Argon2id) ID() string {
+	return AlgArgon2id
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeySize)
+
+	return phc{
+		id:      AlgArgon2id,
+		version: argon2.Version,
+		params:  map[string]int{"m": int(a.Memory), "t": int(a.Iterations), "p": int(a.Parallelism)},
+		salt:    salt,
+		hash:    hash,
+	}.String(), nil
+}
+
+func (a Argon2id) Verify(hash string, password string) error {
+	p, err := parsePHC(AlgArgon2id, hash)
+	if err != nil {
+		return err
+	}
+	if p.version != argon2.Version || p.params["p"] > 255 {
+		return ErrMalformed
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, uint32(p.params["t"]), uint32(p.params["m"]), uint8(p.params["p"]), uint32(len(p.hash)))
+	if subtle.ConstantTimeCompare(key, p.hash) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func (a Argon2id) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$"+AlgArgon2id+"$")
+}
+
+func (a Argon2id) Outdated(hash string) bool {
+	p, err := parsePHC(AlgArgon2id, hash)
+	if err != nil {
+		return true
+	}
+
+	return p.version != argon2.Version ||
+		p.params["m"] != int(a.Memory) ||
+		p.params["t"] != int(a.Iterations) ||
+		p.params["p"] != int(a.Parallelism) ||
+		len(p.hash) != argon2KeySize
+}
+
+// Validate rejects parameters argon2 panics on or silently raises, which
+// would make every hash look outdated.
+func (a Argon2id) Validate() error {
+	switch {
+	case a.Iterations < 1:
+		return errors.New("argon2id iterations must be at least 1")
+	case a.Parallelism < 1:
+		return errors.New("argon2id parallelism must be at least 1")
+	case a.Memory < 8*uint32(a.Parallelism):
+		return fmt.Errorf("argon2id memory must be at least %d KiB, 8 times the parallelism", 8*uint32(a.Parallelism))
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package password
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+	AlgScrypt   = "scrypt"
+)
+
+const saltSize = 16
+
+var (
+	ErrMismatch    = errors.New("password does not match")
+	ErrUnknownHash = errors.New("unknown password hash")
+	ErrMalformed   = errors.New("malformed password hash")
+)
+
+// Hasher hashes passwords with one algorithm and parameters. Hashes are
+// strings in the PHC format, $<id>$<params>$<salt>$<hash>, except for
+// bcrypt, which keeps its own $2a$ format.
+type Hasher interface {
+	// ID is the algorithm identifier in the PHC format.
+	ID() string
+	Hash(password string) (string, error)
+	// Verify returns ErrMismatch if the password does not match the hash.
+	Verify(hash string, password string) error
+	// Owns reports whether the hash was created by the algorithm.
+	Owns(hash string) bool
+	// Outdated reports whether a hash of the algorithm was created with
+	// other parameters than the hasher's.
+	Outdated(hash string) bool
+	// Validate returns an error if the hasher's parameters are out of the
+	// range of the algorithm.
+	Validate() error
+}
+
+// Hashers hashes new passwords with the current hasher and verifies
+// hashes of every known hasher, so that the algorithm can be changed
+// without invalidating stored passwords.
+type Hashers struct {
+	current Hasher
+	known   []Hasher
+}
+
+// New returns Hashers hashing with current. Hashes of the other hashers can
+// still be verified.
+func New(current Hasher, others ...Hasher) *Hashers {
+	return &Hashers{
+		current: current,
+		known:   append([]Hasher{current}, others...),
+	}
+}
+
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify checks the password against the hash. rehash is set when the
+// password matches but the hash was created with another algorithm or
+// other parameters than the current ones, so it should be replaced with a
+// new hash of the password.
+func (h *Hashers) Verify(hash string, password string) (rehash bool, err error) {
+	for _, hasher := range h.known {
+		if !hasher.Owns(hash) {
+			continue
+		}
+		if err := hasher.Verify(hash, password); err != nil {
+			return false, err
+		}
+
+		return hasher.ID() != h.current.ID() || hasher.Outdated(hash), nil
+	}
+
+	return false, ErrUnknownHash
+}
+
+// phc is a hash in the PHC format. Version is left out of the string when
+// it is zero.
+type phc struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func (p phc) String() string {
+	params := make([]string, 0, len(p.params))
+	for _, key := range phcParamOrder[p.id] {
+		params = append(params, key+"="+strconv.Itoa(p.params[key]))
+	}
+
+	var b strings.Builder
+	b.WriteString("$" + p.id)
+	if p.version != 0 {
+		b.WriteString("$v=" + strconv.Itoa(p.version))
+	}
+	b.WriteString("$" + strings.Join(params, ","))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.salt))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.hash))
+
+	return b.String()
+}
+
+// phcParamOrder is the order parameters are written in, which the PHC
+// format requires to be fixed for every algorithm.
+var phcParamOrder = map[string][]string{
+	AlgArgon2id: {"m", "t", "p"},
+	AlgScrypt:   {"ln", "r", "p"},
+}
+
+// parsePHC parses a PHC string of the algorithm.
+func parsePHC(id string, hash string) (phc, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 5 || len(parts) > 6 || parts[0] != "" || parts[1] != id {
+		return phc{}, ErrMalformed
+	}
+
+	result := phc{id: id, params: make(map[string]int)}
+	if len(parts) == 6 {
+		version, ok := strings.CutPrefix(parts[2], "v=")
+		if !ok {
+			return phc{}, ErrMalformed
+		}
+		n, err := strconv.Atoi(version)
+		if err != nil {
+			return phc{}, ErrMalformed
+		}
+		result.version = n
+	}
+
+	for _, param := range strings.Split(parts[len(parts)-3], ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return phc{}, ErrMalformed
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return phc{}, ErrMalformed
+		}
+		result.params[key] = n
+	}
+	for _, key := range phcParamOrder[id] {
+		if _, ok := result.params[key]; !ok {
+			return phc{}, ErrMalformed
+		}
+	}
+
+	var err error
+	if result.salt, err = base64.RawStdEncoding.DecodeString(parts[len(parts)-2]); err != nil {
+		return phc{}, ErrMalformed
+	}
+	if result.hash, err = base64.RawStdEncoding.DecodeString(parts[len(parts)-1]); err != nil || len(result.hash) == 0 {
+		return phc{}, ErrMalformed
+	}
+
+	return result, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
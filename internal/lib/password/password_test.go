@@ -0,0 +1,198 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parameters far below the configured ones keep the tests fast.
+var (
+	testArgon2id = Argon2id{Memory: 64, Iterations: 1, Parallelism: 2}
+	testScrypt   = Scrypt{LogN: 4, BlockSize: 8, Parallelism: 1}
+	testBcrypt   = Bcrypt{Cost: bcrypt.MinCost}
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, hasher := range []Hasher{testArgon2id, testScrypt, testBcrypt} {
+		t.Run(hasher.ID(), func(t *testing.T) {
+			hash, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+			require.NoError(t, hasher.Validate())
+
+			assert.True(t, hasher.Owns(hash))
+			assert.False(t, hasher.Outdated(hash))
+			require.NoError(t, hasher.Verify(hash, "correct horse"))
+			require.ErrorIs(t, hasher.Verify(hash, "battery staple"), ErrMismatch)
+
+			// Every hash gets its own salt.
+			again, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, again)
+		})
+	}
+}
+
+func TestPHCFormat(t *testing.T) {
+	hash, err := testArgon2id.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=2$"), hash)
+
+	hash, err = testScrypt.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$scrypt$ln=4,r=8,p=1$"), hash)
+}
+
+func TestParsePHC(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		version int
+		params  map[string]int
+	}{
+		{
+			name:    "argon2id",
+			hash:    "$argon2id$v=19$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA",
+			version: 19,
+			params:  map[string]int{"m": 64, "t": 1, "p": 2},
+		},
+		{
+			name:   "without version",
+			hash:   "$argon2id$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA",
+			params: map[string]int{"m": 64, "t": 1, "p": 2},
+		},
+		{
+			name:    "params in another order",
+			hash:    "$argon2id$v=19$p=2,t=1,m=64$c2FsdHNhbHQ$aGFzaA",
+			version: 19,
+			params:  map[string]int{"m": 64, "t": 1, "p": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePHC(AlgArgon2id, tt.hash)
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, p.version)
+			assert.Equal(t, tt.params, p.params)
+			assert.Equal(t, []byte("saltsalt"), p.salt)
+			assert.Equal(t, []byte("hash"), p.hash)
+		})
+	}
+}
+
+func TestParsePHCMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "other algorithm", hash: "$scrypt$ln=4,r=8,p=1$c2FsdHNhbHQ$aGFzaA"},
+		{name: "no leading separator", hash: "argon2id$v=19$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "too few parts", hash: "$argon2id$m=64,t=1,p=2$aGFzaA"},
+		{name: "too many parts", hash: "$argon2id$v=19$x$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "bad version", hash: "$argon2id$19$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "version not a number", hash: "$argon2id$v=x$m=64,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "param without value", hash: "$argon2id$v=19$m,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "param not a number", hash: "$argon2id$v=19$m=x,t=1,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "zero param", hash: "$argon2id$v=19$m=64,t=0,p=2$c2FsdHNhbHQ$aGFzaA"},
+		{name: "missing param", hash: "$argon2id$v=19$m=64,t=1$c2FsdHNhbHQ$aGFzaA"},
+		{name: "bad salt", hash: "$argon2id$v=19$m=64,t=1,p=2$!!!$aGFzaA"},
+		{name: "bad hash", hash: "$argon2id$v=19$m=64,t=1,p=2$c2FsdHNhbHQ$!!!"},
+		{name: "empty hash", hash: "$argon2id$v=19$m=64,t=1,p=2$c2FsdHNhbHQ$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePHC(AlgArgon2id, tt.hash)
+			require.ErrorIs(t, err, ErrMalformed)
+		})
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	argon2Hash, err := testArgon2id.Hash("correct horse")
+	require.NoError(t, err)
+	scryptHash, err := testScrypt.Hash("correct horse")
+	require.NoError(t, err)
+	bcryptHash, err := testBcrypt.Hash("correct horse")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		hasher Hasher
+		hash   string
+	}{
+		{name: "argon2id memory", hasher: Argon2id{Memory: 128, Iterations: 1, Parallelism: 2}, hash: argon2Hash},
+		{name: "argon2id iterations", hasher: Argon2id{Memory: 64, Iterations: 2, Parallelism: 2}, hash: argon2Hash},
+		{name: "argon2id parallelism", hasher: Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}, hash: argon2Hash},
+		{name: "argon2id malformed", hasher: testArgon2id, hash: "$argon2id$v=19$m=64$c2FsdA$aGFzaA"},
+		{name: "scrypt ln", hasher: Scrypt{LogN: 5, BlockSize: 8, Parallelism: 1}, hash: scryptHash},
+		{name: "scrypt r", hasher: Scrypt{LogN: 4, BlockSize: 4, Parallelism: 1}, hash: scryptHash},
+		{name: "scrypt p", hasher: Scrypt{LogN: 4, BlockSize: 8, Parallelism: 2}, hash: scryptHash},
+		{name: "bcrypt cost", hasher: Bcrypt{Cost: bcrypt.MinCost + 1}, hash: bcryptHash},
+		{name: "bcrypt malformed", hasher: testBcrypt, hash: "$2a$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.hasher.Outdated(tt.hash))
+		})
+	}
+}
+
+func TestHashersVerify(t *testing.T) {
+	hashers := New(testArgon2id, testScrypt, testBcrypt)
+
+	hash, err := hashers.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, testArgon2id.Owns(hash))
+
+	rehash, err := hashers.Verify(hash, "correct horse")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+
+	_, err = hashers.Verify(hash, "battery staple")
+	require.ErrorIs(t, err, ErrMismatch)
+
+	// Hashes of the other algorithms and of older parameters are accepted
+	// and replaced.
+	for _, hasher := range []Hasher{testScrypt, testBcrypt, Argon2id{Memory: 32, Iterations: 1, Parallelism: 1}} {
+		hash, err := hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		rehash, err := hashers.Verify(hash, "correct horse")
+		require.NoError(t, err)
+		assert.True(t, rehash, hash)
+	}
+
+	_, err = hashers.Verify("$pbkdf2$i=1000$c2FsdA$aGFzaA", "correct horse")
+	require.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+	}{
+		{name: "argon2id zero parallelism", hasher: Argon2id{Memory: 64, Iterations: 1, Parallelism: 0}},
+		{name: "argon2id zero iterations", hasher: Argon2id{Memory: 64, Iterations: 0, Parallelism: 1}},
+		{name: "argon2id too little memory", hasher: Argon2id{Memory: 15, Iterations: 1, Parallelism: 2}},
+		{name: "bcrypt cost too low", hasher: Bcrypt{Cost: bcrypt.MinCost - 1}},
+		{name: "bcrypt cost too high", hasher: Bcrypt{Cost: bcrypt.MaxCost + 1}},
+		{name: "scrypt zero ln", hasher: Scrypt{LogN: 0, BlockSize: 8, Parallelism: 1}},
+		{name: "scrypt ln too high", hasher: Scrypt{LogN: 63, BlockSize: 8, Parallelism: 1}},
+		{name: "scrypt zero r", hasher: Scrypt{LogN: 4, BlockSize: 0, Parallelism: 1}},
+		{name: "scrypt zero p", hasher: Scrypt{LogN: 4, BlockSize: 8, Parallelism: 0}},
+		{name: "scrypt r * p too high", hasher: Scrypt{LogN: 4, BlockSize: 1 << 15, Parallelism: 1 << 15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, tt.hasher.Validate())
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules of the password policy, reported in violations.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleLower     = "lower"
+	RuleUpper     = "upper"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleUserInfo  = "user_info"
+	RuleStrength  = "strength"
+
+	// RuleBreached is reported for passwords found in a list of breached
+	// passwords, which is checked apart from the policy.
+	RuleBreached = "breached"
+)
+
+// minUserInfoLength is the length from which a part of the email or name
+// is looked for in the password; shorter parts match too many passwords.
+const minUserInfoLength = 3
+
+// Policy is the set of rules passwords must follow. Lengths count
+// characters, not bytes. MinStrength is the lowest Strength score accepted,
+// 0 accepts every password.
+type Policy struct {
+	MinLength        int
+	MaxLength        int
+	RequireLower     bool
+	RequireUpper     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool
+	MinStrength      int
+}
+
+// Violation is a rule the password breaks.
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Check returns the rules the password breaks, or nil if it follows the
+// policy. The email and name of the user are not allowed in the password
+// when DisallowUserInfo is set, and make it weaker either way.
+func (p Policy) Check(password string, email string, name string) []Violation {
+	var violations []Violation
+	add := func(rule string, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Description: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(RuleMinLength, "password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "password must be at most %d characters long", p.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		add(RuleLower, "password must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		add(RuleUpper, "password must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add(RuleDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(RuleSymbol, "password must contain a symbol")
+	}
+
+	userInfo := userInputs(email, name)
+	if p.DisallowUserInfo {
+		normalized := strings.ToLower(password)
+		for _, input := range userInfo {
+			if strings.Contains(normalized, input) {
+				add(RuleUserInfo, "password must not contain your email or name")
+				break
+			}
+		}
+	}
+
+	if p.MinStrength > 0 {
+		if score := Strength(password, userInfo...); score < p.MinStrength {
+			add(RuleStrength, "password is too easy to guess: strength %d of %d required", score, p.MinStrength)
+		}
+	}
+
+	return violations
+}
+
+// userInputs returns the lowercase parts of the email and name a password
+// should not be built from: the email, its local part and domain labels,
+// and the name and its words.
+func userInputs(email string, name string) []string {
+	var inputs []string
+	add := func(value string) {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if utf8.RuneCountInString(value) >= minUserInfoLength {
+			inputs = append(inputs, value)
+		}
+	}
+
+	add(email)
+	local, domain, _ := strings.Cut(email, "@")
+	add(local)
+	for _, part := range strings.FieldsFunc(local, isSeparator) {
+		add(part)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		add(label)
+	}
+
+	add(name)
+	for _, word := range strings.FieldsFunc(name, isSeparator) {
+		add(word)
+	}
+
+	return inputs
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == '_' || r == '-' || r == '+' || unicode.IsSpace(r)
+}
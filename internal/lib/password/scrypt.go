@@ -0,0 +1,93 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const scryptKeySize = 32
+
+// Scrypt hashes passwords with scrypt. The CPU and memory cost N is 2^LogN.
+type Scrypt struct {
+	LogN        int
+	BlockSize   int
+	Parallelism int
+}
+
+func (s Scrypt) ID() string {
+	return AlgScrypt
+}
+
+func (s Scrypt) Hash(password string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := scrypt.Key([]byte(password), salt, 1<<s.LogN, s.BlockSize, s.Parallelism, scryptKeySize)
+	if err != nil {
+		return "", err
+	}
+
+	return phc{
+		id:     AlgScrypt,
+		params: map[string]int{"ln": s.LogN, "r": s.BlockSize, "p": s.Parallelism},
+		salt:   salt,
+		hash:   hash,
+	}.String(), nil
+}
+
+func (s Scrypt) Verify(hash string, password string) error {
+	p, err := parsePHC(AlgScrypt, hash)
+	if err != nil {
+		return err
+	}
+	if p.params["ln"] >= 64 {
+		return ErrMalformed
+	}
+
+	key, err := scrypt.Key([]byte(password), p.salt, 1<<p.params["ln"], p.params["r"], p.params["p"], len(p.hash))
+	if err != nil {
+		return ErrMalformed
+	}
+	if subtle.ConstantTimeCompare(key, p.hash) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func (s Scrypt) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$"+AlgScrypt+"$")
+}
+
+func (s Scrypt) Outdated(hash string) bool {
+	p, err := parsePHC(AlgScrypt, hash)
+	if err != nil {
+		return true
+	}
+
+	return p.params["ln"] != s.LogN ||
+		p.params["r"] != s.BlockSize ||
+		p.params["p"] != s.Parallelism ||
+		len(p.hash) != scryptKeySize
+}
+
+// Validate rejects parameters scrypt cannot hash with.
+func (s Scrypt) Validate() error {
+	switch {
+	case s.LogN < 1 || s.LogN > 62:
+		return errors.New("scrypt ln must be between 1 and 62")
+	case s.BlockSize < 1:
+		return errors.New("scrypt r must be at least 1")
+	case s.Parallelism < 1:
+		return errors.New("scrypt p must be at least 1")
+	case s.BlockSize*s.Parallelism >= 1<<30:
+		return errors.New("scrypt r * p must be less than 2^30")
+	}
+
+	return nil
+}
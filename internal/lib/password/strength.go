@@ -0,0 +1,220 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Bits of entropy at which the Strength score goes up. They follow the
+// guess counts zxcvbn uses: 10^3, 10^6, 10^8 and 10^10.
+var strengthThresholds = [...]float64{10, 20, 26.6, 33.2}
+
+// commonWords are the most used passwords and their building blocks. They
+// are matched case-insensitively and after undoing common substitutions
+// such as 0 for o and @ for a.
+var commonWords = []string{
+	"password", "passwort", "qwerty", "letmein", "welcome", "admin", "login",
+	"dragon", "monkey", "football", "baseball", "soccer", "hockey", "master",
+	"shadow", "sunshine", "princess", "iloveyou", "superman", "batman",
+	"trustno1", "starwars", "whatever", "freedom", "secret", "hello",
+	"charlie", "michael", "jordan", "hunter", "ranger", "buster", "thomas",
+	"tigger", "summer", "winter", "spring", "autumn", "flower", "cookie",
+	"killer", "pepper", "ginger", "cheese", "banana", "orange", "purple",
+	"silver", "golden", "lovely", "angel", "family", "google", "matrix",
+	"access", "default", "changeme", "test", "guest", "user", "root",
+	"love", "god", "pass", "abc", "qwe", "asd", "zxc",
+}
+
+// yearRange is the number of years a guesser tries, from 1900 to 2099.
+const yearRange = 200
+
+// keyboardRows are matched as sequences when typed along a row.
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var substitutions = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+// Strength estimates how hard the password is to guess, in the spirit of
+// zxcvbn: 0 is too guessable, 1 very guessable, 2 somewhat guessable, 3
+// safely unguessable and 4 very unguessable. Parts of the password that
+// are common words, user inputs, years, repeats or sequences count for
+// much less than random characters.
+func Strength(password string, userInputs ...string) int {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	lower := []rune(strings.ToLower(password))
+	unleet := []rune(substitutions.Replace(strings.ToLower(password)))
+	if len(unleet) != len(lower) {
+		unleet = lower
+	}
+
+	words := make([]string, 0, len(commonWords)+len(userInputs))
+	words = append(words, commonWords...)
+	words = append(words, userInputs...)
+
+	perChar := math.Log2(float64(charsetSize(runes)))
+	bits := 0.0
+	for i := 0; i < len(runes); {
+		if n := matchWord(lower, unleet, i, words); n > 0 {
+			// A guesser tries every listed word, in a few capitalizations.
+			bits += math.Log2(float64(len(words))) + 1
+			i += n
+			continue
+		}
+		if matchYear(lower, i) {
+			bits += math.Log2(yearRange)
+			i += 4
+			continue
+		}
+		if n := matchRepeat(lower, i); n > 0 {
+			bits += perChar + math.Log2(float64(n))
+			i += n
+			continue
+		}
+		if n := matchSequence(lower, i); n > 0 {
+			bits += perChar + math.Log2(float64(n)) + 1
+			i += n
+			continue
+		}
+
+		bits += perChar
+		i++
+	}
+
+	score := 0
+	for _, threshold := range strengthThresholds {
+		if bits >= threshold {
+			score++
+		}
+	}
+
+	return score
+}
+
+// charsetSize is the number of characters a guesser has to try for every
+// position, given the classes of characters in the password.
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	size := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			size += class.size
+		}
+	}
+
+	return size
+}
+
+// matchWord returns the length of the longest word starting at i.
+func matchWord(lower []rune, unleet []rune, i int, words []string) int {
+	longest := 0
+	for _, word := range words {
+		w := []rune(word)
+		if len(w) <= longest || i+len(w) > len(lower) {
+			continue
+		}
+		if string(lower[i:i+len(w)]) == word || string(unleet[i:i+len(w)]) == word {
+			longest = len(w)
+		}
+	}
+
+	return longest
+}
+
+// matchYear reports whether a year from 1900 to 2099 starts at i.
+func matchYear(lower []rune, i int) bool {
+	if i+4 > len(lower) {
+		return false
+	}
+	for _, r := range lower[i : i+4] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	century := string(lower[i : i+2])
+	return century == "19" || century == "20"
+}
+
+// matchRepeat returns the length of a run of at least three equal
+// characters starting at i.
+func matchRepeat(lower []rune, i int) int {
+	n := 1
+	for i+n < len(lower) && lower[i+n] == lower[i] {
+		n++
+	}
+	if n < 3 {
+		return 0
+	}
+
+	return n
+}
+
+// matchSequence returns the length of a sequence of at least three
+// characters starting at i, such as abc, 987 or qwer.
+func matchSequence(lower []rune, i int) int {
+	if i+2 >= len(lower) {
+		return 0
+	}
+
+	n := 0
+	if delta := lower[i+1] - lower[i]; delta == 1 || delta == -1 {
+		n = 2
+		for i+n < len(lower) && lower[i+n]-lower[i+n-1] == delta {
+			n++
+		}
+	}
+
+	for _, row := range keyboardRows {
+		for _, r := range []string{row, reverse(row)} {
+			m := 0
+			for i+m < len(lower) && strings.Contains(r, string(lower[i:i+m+1])) {
+				m++
+			}
+			n = max(n, m)
+		}
+	}
+
+	if n < 3 {
+		return 0
+	}
+
+	return n
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
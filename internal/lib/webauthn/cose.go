@@ -0,0 +1,143 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithms of the supported credential keys (RFC 9053).
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9052, section 7.1 and RFC 9053, section 7).
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+
+	coseN = -1
+	coseE = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+
+	minRSABits = 2048
+)
+
+var ErrUnsupportedKey = errors.New("unsupported credential key")
+
+// SupportedAlgorithms are the credential key algorithms offered to
+// authenticators, most preferred first.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// publicKey is a credential public key decoded from its COSE form.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func parsePublicKey(cose []byte) (publicKey, error) {
+	value, rest, err := decodeCBOR(cose)
+	if err != nil || len(rest) > 0 {
+		return publicKey{}, errCBOR
+	}
+	params, ok := value.(map[any]any)
+	if !ok {
+		return publicKey{}, errCBOR
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		// crypto/ecdh checks that the point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := params[int64(coseN)].([]byte)
+		e, _ := params[int64(coseE)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.N.BitLen() < minRSABits || key.E < 3 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: key}, nil
+	}
+
+	return publicKey{}, ErrUnsupportedKey
+}
+
+// verify checks a signature over data made with the key's algorithm.
+func (p publicKey) verify(data []byte, sig []byte) bool {
+	switch key := p.key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, sum[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil
+	}
+
+	return false
+}
+
+// x509Algorithm returns the certificate signature algorithm of a COSE
+// algorithm, used for attestation certificates.
+func x509Algorithm(alg int64) (x509.SignatureAlgorithm, bool) {
+	switch alg {
+	case AlgES256:
+		return x509.ECDSAWithSHA256, true
+	case AlgEdDSA:
+		return x509.PureEd25519, true
+	case AlgRS256:
+		return x509.SHA256WithRSA, true
+	}
+
+	return x509.UnknownSignatureAlgorithm, false
+}
@@ -0,0 +1,106 @@
+package webauthn
+
+import "time"
+
+const (
+	credentialType = "public-key"
+
+	residentKeyRequired      = "required"
+	userVerificationRequired = "required"
+	attestationNone          = "none"
+)
+
+// CreationOptions are the options of a registration ceremony in the JSON
+// form of WebAuthn Level 3, which browsers read with
+// PublicKeyCredential.parseCreationOptionsFromJSON. Binary values are
+// unpadded base64url.
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of a login ceremony, read with
+// PublicKeyCredential.parseRequestOptionsFromJSON.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is the account a credential is created for. ID is the user
+// handle the authenticator returns on login.
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions returns the options to register a passkey for the
+// user: a discoverable credential, so that the user can log in without
+// typing a name, created with user verification. Credentials the user
+// already has are excluded.
+func (rp RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor, timeout time.Duration) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: credentialType, Alg: alg})
+	}
+
+	return CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      residentKeyRequired,
+			UserVerification: userVerificationRequired,
+		},
+		Attestation: attestationNone,
+	}
+}
+
+// RequestOptions returns the options to log in with any passkey of the
+// relying party, with user verification.
+func (rp RelyingParty) RequestOptions(challenge string, timeout time.Duration) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.ID,
+		UserVerification: userVerificationRequired,
+	}
+}
+
+// Descriptor returns the descriptor of a stored credential.
+func Descriptor(id []byte, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{Type: credentialType, ID: EncodeID(id), Transports: transports}
+}
@@ -0,0 +1,332 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// Ceremony types in the client data (WebAuthn Level 2, section 5.8.1).
+const (
+	TypeCreate = "webauthn.create"
+	TypeGet    = "webauthn.get"
+)
+
+// Authenticator data flags (WebAuthn Level 2, section 6.1).
+const (
+	flagUserPresent   = 0x01
+	flagUserVerified  = 0x04
+	flagBackupElig    = 0x08
+	flagBackedUp      = 0x10
+	flagAttestedData  = 0x40
+	flagExtensionData = 0x80
+
+	rpIDHashSize   = sha256.Size
+	aaguidSize     = 16
+	authDataMinLen = rpIDHashSize + 1 + 4
+
+	maxCredentialIDLen = 1023
+)
+
+// Attestation statement formats that are verified. Packed attestation
+// certificates are not checked against a list of trusted roots.
+const (
+	formatNone   = "none"
+	formatPacked = "packed"
+)
+
+var (
+	ErrInvalidClientData   = errors.New("invalid client data")
+	ErrInvalidAuthData     = errors.New("invalid authenticator data")
+	ErrInvalidAttestation  = errors.New("invalid attestation")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrUserNotVerified     = errors.New("user not verified")
+	ErrUnsupportedFormat   = errors.New("unsupported attestation format")
+	ErrSignCounterRollback = errors.New("sign counter did not increase")
+)
+
+var encoding = base64.RawURLEncoding
+
+// RelyingParty is the site credentials are scoped to. ID is its domain,
+// Origins the origins of the pages allowed to run the ceremonies.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// ClientData is the data the browser collected and the authenticator
+// signed a hash of.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+// Credential is a public key credential created by an authenticator.
+// PublicKey keeps the COSE encoding the authenticator sent.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is the result of a verified login with a credential.
+type Assertion struct {
+	SignCount uint32
+	BackedUp  bool
+}
+
+type authenticatorData struct {
+	rpIDHash   []byte
+	flags      byte
+	signCount  uint32
+	credential *Credential
+}
+
+// ParseClientData decodes the client data JSON, so that the challenge can
+// be looked up before the ceremony is verified.
+func ParseClientData(raw []byte) (ClientData, error) {
+	var data ClientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return ClientData{}, ErrInvalidClientData
+	}
+	if data.Challenge == "" {
+		return ClientData{}, ErrInvalidClientData
+	}
+
+	return data, nil
+}
+
+// VerifyRegistration verifies the response of an authenticator to a
+// registration ceremony, as described in WebAuthn Level 2, section 7.1,
+// and returns the new credential. The caller checks the challenge in the
+// client data against the one it issued. User verification is required.
+func (rp RelyingParty) VerifyRegistration(clientDataJSON []byte, attestationObject []byte) (Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, TypeCreate); err != nil {
+		return Credential{}, err
+	}
+
+	value, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) > 0 {
+		return Credential{}, ErrInvalidAttestation
+	}
+	object, ok := value.(map[any]any)
+	if !ok {
+		return Credential{}, ErrInvalidAttestation
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[any]any)
+	rawAuthData, _ := object["authData"].([]byte)
+	if statement == nil {
+		return Credential{}, ErrInvalidAttestation
+	}
+
+	authData, err := rp.checkAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.credential == nil {
+		return Credential{}, ErrInvalidAuthData
+	}
+
+	key, err := parsePublicKey(authData.credential.PublicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(rawAuthData), clientDataHash[:]...)
+
+	switch format {
+	case formatNone:
+		if len(statement) > 0 {
+			return Credential{}, ErrInvalidAttestation
+		}
+	case formatPacked:
+		if err := verifyPacked(statement, key, signed); err != nil {
+			return Credential{}, err
+		}
+	default:
+		return Credential{}, ErrUnsupportedFormat
+	}
+
+	credential := *authData.credential
+	credential.Algorithm = key.alg
+	return credential, nil
+}
+
+// VerifyAssertion verifies the response of an authenticator to a login
+// with the credential, as described in WebAuthn Level 2, section 7.2. The
+// caller checks the challenge in the client data against the one it
+// issued. A sign counter that did not increase since storedSignCount
+// means the credential may have been cloned; authenticators that do not
+// count always send 0.
+func (rp RelyingParty) VerifyAssertion(credentialPublicKey []byte, storedSignCount uint32, clientDataJSON []byte, rawAuthData []byte, signature []byte) (Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, TypeGet); err != nil {
+		return Assertion{}, err
+	}
+
+	authData, err := rp.checkAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	key, err := parsePublicKey(credentialPublicKey)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(rawAuthData), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return Assertion{}, ErrInvalidSignature
+	}
+
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return Assertion{}, ErrSignCounterRollback
+	}
+
+	return Assertion{
+		SignCount: authData.signCount,
+		BackedUp:  authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// EncodeID encodes a credential id or user handle the way it appears in
+// the JSON options, as unpadded base64url.
+func EncodeID(id []byte) string {
+	return encoding.EncodeToString(id)
+}
+
+// DecodeID decodes an id encoded with EncodeID.
+func DecodeID(id string) ([]byte, error) {
+	return encoding.DecodeString(id)
+}
+
+func (rp RelyingParty) checkClientData(raw []byte, ceremony string) error {
+	data, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony || data.CrossOrigin || !slices.Contains(rp.Origins, data.Origin) {
+		return ErrInvalidClientData
+	}
+
+	return nil
+}
+
+// checkAuthenticatorData parses the authenticator data and checks that it
+// is scoped to the relying party and that the user was present and
+// verified.
+func (rp RelyingParty) checkAuthenticatorData(raw []byte) (authenticatorData, error) {
+	if len(raw) < authDataMinLen {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+
+	data := authenticatorData{
+		rpIDHash:  raw[:rpIDHashSize],
+		flags:     raw[rpIDHashSize],
+		signCount: binary.BigEndian.Uint32(raw[rpIDHashSize+1:]),
+	}
+	rest := raw[authDataMinLen:]
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.rpIDHash, rpIDHash[:]) != 1 {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+	if data.flags&flagUserPresent == 0 {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+	if data.flags&flagUserVerified == 0 {
+		return authenticatorData{}, ErrUserNotVerified
+	}
+
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < aaguidSize+2 {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		aaguid := rest[:aaguidSize]
+		idLen := int(binary.BigEndian.Uint16(rest[aaguidSize:]))
+		rest = rest[aaguidSize+2:]
+		if idLen == 0 || idLen > maxCredentialIDLen || idLen > len(rest) {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		id := rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		key := rest[:len(rest)-len(after)]
+		rest = after
+
+		data.credential = &Credential{
+			ID:             bytes.Clone(id),
+			PublicKey:      bytes.Clone(key),
+			SignCount:      data.signCount,
+			AAGUID:         bytes.Clone(aaguid),
+			BackupEligible: data.flags&flagBackupElig != 0,
+			BackedUp:       data.flags&flagBackedUp != 0,
+		}
+	}
+
+	if data.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		rest = after
+	}
+	if len(rest) > 0 {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+
+	return data, nil
+}
+
+// verifyPacked verifies a packed attestation statement (WebAuthn Level 2,
+// section 8.2): signed with the attestation certificate if there is one,
+// and with the credential key itself otherwise.
+func verifyPacked(statement map[any]any, key publicKey, signed []byte) error {
+	alg, _ := statement["alg"].(int64)
+	sig, _ := statement["sig"].([]byte)
+	if len(sig) == 0 {
+		return ErrInvalidAttestation
+	}
+
+	chain, ok := statement["x5c"].([]any)
+	if !ok {
+		if alg != key.alg || !key.verify(signed, sig) {
+			return ErrInvalidAttestation
+		}
+		return nil
+	}
+
+	if len(chain) == 0 {
+		return ErrInvalidAttestation
+	}
+	der, _ := chain[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return ErrInvalidAttestation
+	}
+	sigAlg, ok := x509Algorithm(alg)
+	if !ok || cert.CheckSignature(sigAlg, signed, sig) != nil {
+		return ErrInvalidAttestation
+	}
+
+	return nil
+}
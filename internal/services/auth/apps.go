@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+// PermissionManageApps allows creating, changing and deleting apps. It is
+// checked in the admin app, not in the app being managed.
+const PermissionManageApps = "apps:manage"
+
+// CreateApp creates an app with server generated keys. For apps signing
+// with a shared secret the secret is returned; this is the only time it is
+// handed out. Apps signing with a private key publish their public keys as
+// JWKS instead and get an empty secret. Apps requiring a verified email
+// only sign in users who verified their email address.
+func (a *AuthService) CreateApp(ctx context.Context, token string, name string, signingAlg string, requireVerifiedEmail bool) (models.App, string, error) {
+	const op = "services.auth.CreateApp"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return models.App{}, "", err
+	}
+
+	if signingAlg == "" {
+		signingAlg = jwt.AlgHS512
+	}
+	if !jwt.ValidAlgorithm(signingAlg) {
+		a.log.Error("unsupported signing algorithm", slog.String("op", op), slog.String("alg", signingAlg))
+		return models.App{}, "", ErrInvalidData
+	}
+
+	app := models.App{
+		Name:                 name,
+		SigningAlg:           signingAlg,
+		RequireVerifiedEmail: requireVerifiedEmail,
+	}
+
+	keys, err := a.newKeys(app)
+	if err != nil {
+		a.log.Error("failed to generate app keys", sl.OpErr(op, err))
+		return models.App{}, "", err
+	}
+
+	app.ID, err = a.db.AppDB.CreateApp(ctx, app, keys)
+	if err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return models.App{}, "", ErrAppAlreadyExist
+		}
+		a.log.Error("failed to create app", sl.OpErr(op, err))
+		return models.App{}, "", err
+	}
+	ring := keyRing{app: app, keys: keys}
+
+	a.log.Info("app created",
+		slog.String("op", op),
+		slog.Int("app_id", app.ID),
+		slog.String("name", app.Name),
+		slog.Int64("created_by", caller.UserID),
+	)
+	return app, sharedSecret(ring.signingKey(models.KeyKindAccess)), nil
+}
+
+// UpdateApp renames the app. A nil requireVerifiedEmail leaves the setting
+// unchanged.
+func (a *AuthService) UpdateApp(ctx context.Context, token string, appID int, name string, requireVerifiedEmail *bool) (models.App, error) {
+	const op = "services.auth.UpdateApp"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return models.App{}, err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.App{}, ErrInvalidData
+	}
+
+	app.Name = name
+	if requireVerifiedEmail != nil {
+		app.RequireVerifiedEmail = *requireVerifiedEmail
+	}
+	if err := a.db.AppDB.UpdateApp(ctx, app); err != nil {
+		switch {
+		case errors.Is(err, database.ErrConflict):
+			return models.App{}, ErrAppAlreadyExist
+		case errors.Is(err, database.ErrNotFound):
+			return models.App{}, ErrInvalidData
+		}
+		a.log.Error("failed to update app", sl.OpErr(op, err))
+		return models.App{}, err
+	}
+
+	a.log.Info("app updated", slog.String("op", op), slog.Int("app_id", app.ID), slog.Int64("updated_by", caller.UserID))
+	return app, nil
+}
+
+// ListApps returns the apps that are not deleted.
+func (a *AuthService) ListApps(ctx context.Context, token string) ([]models.App, error) {
+	const op = "services.auth.ListApps"
+
+	if _, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps); err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	apps, err := a.db.AppDB.GetApps(ctx)
+	if err != nil {
+		a.log.Error("failed to get apps", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("list apps complete", slog.String("op", op), slog.Int("count", len(apps)))
+	return apps, nil
+}
+
+// RotateAppSecret replaces the access token key of the app with a new key
+// that signs tokens right away and returns its secret, for apps signing
+// with a shared secret. The previous keys keep verifying tokens until they
+// expire, unless retirePrevious is set, which invalidates every access
+// token issued so far.
+func (a *AuthService) RotateAppSecret(ctx context.Context, token string, appID int, retirePrevious bool) (string, error) {
+	const op = "services.auth.RotateAppSecret"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return "", err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return "", ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return "", err
+	}
+
+	key, err := a.createKey(ctx, app, models.KeyKindAccess, time.Now())
+	if err != nil {
+		a.log.Error("failed to create app key", sl.OpErr(op, err))
+		return "", err
+	}
+
+	if retirePrevious {
+		for _, previous := range ring.keys {
+			if previous.Kind != models.KeyKindAccess {
+				continue
+			}
+			if err := a.db.AppDB.UpdateAppKeyStatus(ctx, previous.ID, models.KeyStatusRetired); err != nil {
+				a.log.Error("failed to retire app key", sl.OpErr(op, err), slog.String("kid", previous.ID))
+				return "", err
+			}
+		}
+	}
+
+	a.log.Info("app secret rotated",
+		slog.String("op", op),
+		slog.Int("app_id", app.ID),
+		slog.String("kid", key.ID),
+		slog.Bool("retire_previous", retirePrevious),
+		slog.Int64("rotated_by", caller.UserID),
+	)
+	return sharedSecret(toJWTKey(key)), nil
+}
+
+// DeleteApp soft deletes the app: it can no longer be used and its sessions
+// end, but its data is kept. The admin app cannot be deleted.
+func (a *AuthService) DeleteApp(ctx context.Context, token string, appID int) error {
+	const op = "services.auth.DeleteApp"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return err
+	}
+
+	if appID == a.apps.AdminAppID {
+		a.log.Error("admin app cannot be deleted", slog.String("op", op), slog.Int("app_id", appID))
+		return ErrInvalidData
+	}
+
+	if err := a.db.AppDB.DeleteApp(ctx, appID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to delete app", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("app deleted", slog.String("op", op), slog.Int("app_id", appID), slog.Int64("deleted_by", caller.UserID))
+	return nil
+}
+
+// sharedSecret returns the secret of a key that clients need to verify
+// tokens, which only keys of symmetric algorithms have.
+func sharedSecret(key jwt.Key) string {
+	if jwt.IsAsymmetric(key.Algorithm) {
+		return ""
+	}
+
+	return key.Secret
+}
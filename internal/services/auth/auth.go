@@ -3,30 +3,130 @@ package auth
 import (
 	"context"
 	"errors"
+	"grpc/internal/config"
+	"grpc/internal/database"
 	"grpc/internal/domain/models"
+	"grpc/internal/lib/cache"
 	"grpc/internal/lib/jwt"
 	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/password"
+	"grpc/internal/lib/secret"
 	"log/slog"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthDB interface {
 	CreateUser(ctx context.Context, user models.User) (int64, error)
 	GetUserByEmail(ctx context.Context, email string) (models.User, error)
 	GetUserByID(ctx context.Context, userID int64) (models.User, error)
-	IsAdmin(ctx context.Context, userID int64, appID int) (bool, error)
 	CheckUser(ctx context.Context, email string) (bool, error)
+	UpdatePasswordHash(ctx context.Context, userID int64, oldHash string, passHash string) error
+	CreateEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken, resendInterval time.Duration, mail models.Mail) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int64, error)
+	CreatePasswordResetToken(ctx context.Context, token models.PasswordResetToken, resendInterval time.Duration, mail models.Mail) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error)
+	ResetPassword(ctx context.Context, tokenHash string, passHash string, impersonationExpires time.Duration, notice models.Mail) (int64, error)
 }
 
 type AppDB interface {
 	GetAppByID(ctx context.Context, appID int) (models.App, error)
+	GetApps(ctx context.Context) ([]models.App, error)
+	CreateApp(ctx context.Context, app models.App, keys []models.AppKey) (int, error)
+	UpdateApp(ctx context.Context, app models.App) error
+	DeleteApp(ctx context.Context, appID int) error
+	GetAppKeys(ctx context.Context, appID int) ([]models.AppKey, error)
+	CreateAppKey(ctx context.Context, key models.AppKey) error
+	UpdateAppKeyStatus(ctx context.Context, keyID string, status string) error
+	GetAppRedirectURIs(ctx context.Context, appID int) ([]string, error)
+	SetAppRedirectURIs(ctx context.Context, appID int, uris []string) error
+}
+
+type TokenDB interface {
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, tokenHash string, next models.RefreshToken) error
+	RevokeAccessToken(ctx context.Context, token models.RevokedToken) error
+	GetRevokedToken(ctx context.Context, tokenID string) (models.RevokedToken, error)
+	CreateAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error)
+	SetAuthorizationCodeSession(ctx context.Context, codeHash string, sessionID string) error
+	CreateDeviceCode(ctx context.Context, code models.DeviceCode) error
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error
+	PollDeviceCode(ctx context.Context, deviceCodeHash string, appID int) (models.DeviceCode, error)
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) error
+	SlowDownDeviceCode(ctx context.Context, deviceCodeHash string, step time.Duration) error
+	CountUserCodeFailures(ctx context.Context, clientIP string, since time.Time) (int, error)
+	CreateUserCodeFailure(ctx context.Context, clientIP string) error
+}
+
+type SessionDB interface {
+	CreateSession(ctx context.Context, session models.Session) error
+	GetSession(ctx context.Context, sessionID string) (models.Session, error)
+	TouchSession(ctx context.Context, sessionID string) error
+	EndSession(ctx context.Context, sessionID string) error
+	EndUserSessions(ctx context.Context, userID int64) (int64, error)
+}
+
+type RoleDB interface {
+	GetRole(ctx context.Context, appID int, name string) (models.Role, error)
+	GetUserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+	AssignRole(ctx context.Context, userID int64, roleID int) error
+	UnassignRole(ctx context.Context, userID int64, roleID int) error
+}
+
+type ClientDB interface {
+	CreateServiceClient(ctx context.Context, client models.ServiceClient) error
+	GetServiceClient(ctx context.Context, clientID string) (models.ServiceClient, error)
+	UpdateServiceClientSecretHash(ctx context.Context, clientID string, oldHash string, secretHash string) error
+	DeleteServiceClient(ctx context.Context, clientID string) error
+}
+
+type AuditDB interface {
+	CreateImpersonationEvent(ctx context.Context, event models.ImpersonationEvent) error
+}
+
+type MFADB interface {
+	SaveTOTP(ctx context.Context, userID int64, secret string) error
+	GetTOTP(ctx context.Context, userID int64) (models.TOTPFactor, error)
+	ConfirmTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	CreateMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error
+	AttemptMFAChallenge(ctx context.Context, challengeHash string, maxAttempts int) (models.MFAChallenge, error)
+	ConsumeMFAChallenge(ctx context.Context, challengeHash string) error
+}
+
+type PasskeyDB interface {
+	CreatePasskeyChallenge(ctx context.Context, challenge models.PasskeyChallenge) error
+	ConsumePasskeyChallenge(ctx context.Context, challengeHash string, kind string) (models.PasskeyChallenge, error)
+	CreatePasskey(ctx context.Context, passkey models.Passkey) error
+	GetPasskey(ctx context.Context, credentialID []byte) (models.Passkey, error)
+	GetUserPasskeys(ctx context.Context, userID int64) ([]models.Passkey, error)
+	UpdatePasskeyUse(ctx context.Context, credentialID []byte, signCount uint32, backedUp bool) error
+}
+
+// MailTemplates renders the mail sent to users, in the templates of the
+// app, zero for none, and the locale.
+type MailTemplates interface {
+	Render(name string, appID int, locale string, data any) (models.Mail, error)
+}
+
+// BreachedPasswords tells whether a password is known from a data breach.
+type BreachedPasswords interface {
+	Contains(password string) bool
 }
 
 type DB struct {
-	AuthDB AuthDB
-	AppDB  AppDB
+	AuthDB    AuthDB
+	AppDB     AppDB
+	TokenDB   TokenDB
+	SessionDB SessionDB
+	RoleDB    RoleDB
+	ClientDB  ClientDB
+	AuditDB   AuditDB
+	MFADB     MFADB
+	PasskeyDB PasskeyDB
 }
 
 type AuthService struct {
@@ -34,6 +134,19 @@ type AuthService struct {
 	db                  DB
 	tokenExpires        time.Duration
 	refreshTokenExpires time.Duration
+	keyRotation         config.KeyRotationConfig
+	jwtConfig           config.JWTConfig
+	apps                config.AppsConfig
+	oauth               config.OAuthConfig
+	mfa                 config.MFAConfig
+	webAuthn            config.WebAuthnConfig
+	emailVerification   config.EmailVerificationConfig
+	passwordReset       config.PasswordResetConfig
+	passwords           *password.Hashers
+	passwordPolicy      password.Policy
+	breachedPasswords   BreachedPasswords
+	mailTemplates       MailTemplates
+	revokedTokens       *cache.TTL[string]
 }
 
 var (
@@ -41,20 +154,69 @@ var (
 	ErrUserAlreadyExist = errors.New("user already registered")
 	ErrInvalidData      = errors.New("invalid data")
 	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("permission denied")
+	ErrAppAlreadyExist  = errors.New("app already exists")
 )
 
-func NewAuthService(log *slog.Logger, db DB, tokenExpires time.Duration, refreshTokenExpires time.Duration) *AuthService {
+// PasswordPolicyError lists the rules of the password policy a new
+// password breaks.
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy"
+}
+
+func NewAuthService(
+	log *slog.Logger,
+	db DB,
+	tokenExpires time.Duration,
+	refreshTokenExpires time.Duration,
+	keyRotation config.KeyRotationConfig,
+	jwtConfig config.JWTConfig,
+	apps config.AppsConfig,
+	oauth config.OAuthConfig,
+	mfa config.MFAConfig,
+	webAuthn config.WebAuthnConfig,
+	emailVerification config.EmailVerificationConfig,
+	passwordReset config.PasswordResetConfig,
+	passwords *password.Hashers,
+	passwordPolicy password.Policy,
+	breachedPasswords BreachedPasswords,
+	mailTemplates MailTemplates,
+) *AuthService {
 	return &AuthService{
 		log:                 log,
 		db:                  db,
 		tokenExpires:        tokenExpires,
 		refreshTokenExpires: refreshTokenExpires,
+		keyRotation:         keyRotation,
+		jwtConfig:           jwtConfig,
+		apps:                apps,
+		oauth:               oauth,
+		mfa:                 mfa,
+		webAuthn:            webAuthn,
+		emailVerification:   emailVerification,
+		passwordReset:       passwordReset,
+		passwords:           passwords,
+		passwordPolicy:      passwordPolicy,
+		breachedPasswords:   breachedPasswords,
+		mailTemplates:       mailTemplates,
+		revokedTokens:       cache.NewTTL[string](),
 	}
 }
 
-func (a *AuthService) Register(ctx context.Context, email string, password string, name string) (int64, error) {
+// Register creates the user and mails a link to verify the email, in the
+// templates of the app, zero for none, and the locale.
+func (a *AuthService) Register(ctx context.Context, email string, password string, name string, appID int, locale string) (int64, error) {
 	const op = "services.auth.Register"
 
+	if err := a.checkMailApp(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return 0, err
+	}
+
 	checkUser, err := a.db.AuthDB.CheckUser(ctx, email)
 	if err != nil {
 		a.log.Error("failed to check user", sl.OpErr(op, err))
@@ -65,7 +227,12 @@ func (a *AuthService) Register(ctx context.Context, email string, password strin
 		return 0, ErrUserAlreadyExist
 	}
 
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := a.checkNewPassword(password, email, name); err != nil {
+		a.log.Info("password rejected", slog.String("op", op), slog.String("email", email))
+		return 0, err
+	}
+
+	hashPassword, err := a.passwords.Hash(password)
 	if err != nil {
 		a.log.Error("failed generate hash password", sl.OpErr(op, err))
 		return 0, err
@@ -73,7 +240,7 @@ func (a *AuthService) Register(ctx context.Context, email string, password strin
 
 	user := models.User{
 		Email:    email,
-		PassHash: string(hashPassword),
+		PassHash: hashPassword,
 		Name:     name,
 	}
 
@@ -83,22 +250,30 @@ func (a *AuthService) Register(ctx context.Context, email string, password strin
 		return 0, err
 	}
 
+	// The user can ask for another mail, so a failure does not fail the
+	// registration.
+	user.ID = userID
+	if err := a.sendVerificationEmail(ctx, user, appID, locale); err != nil {
+		a.log.Error("failed to send verification mail", sl.OpErr(op, err))
+	}
+
 	a.log.Info("new user created", slog.String("op", op), slog.Int64("id", userID))
 	return userID, nil
 }
 
-func (a *AuthService) Login(ctx context.Context, email string, password string, appID int) (models.TokensPair, error) {
+// Login starts a session and issues a token pair. A non-empty scope, a
+// space separated list of permissions, narrows the permissions embedded in
+// the access token. If the user enrolled a second factor, no tokens are
+// issued; the login is finished with VerifyMFA and the returned challenge.
+// Apps requiring a verified email refuse users without one with
+// ErrEmailNotVerified.
+func (a *AuthService) Login(ctx context.Context, email string, password string, appID int, scope string) (models.TokensPair, error) {
 	const op = "services.auth.Login"
 
-	user, err := a.db.AuthDB.GetUserByEmail(ctx, email)
+	user, err := a.checkCredentials(ctx, email, password)
 	if err != nil {
-		a.log.Error("failed to get user by email", sl.OpErr(op, err))
-		return models.TokensPair{}, ErrInvPassOrEmail
-	}
-
-	if err = bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(password)); err != nil {
-		a.log.Error("invalid password", sl.OpErr(op, err))
-		return models.TokensPair{}, ErrInvPassOrEmail
+		a.log.Error("failed to check credentials", sl.OpErr(op, err))
+		return models.TokensPair{}, err
 	}
 
 	app, err := a.db.AppDB.GetAppByID(ctx, appID)
@@ -107,51 +282,143 @@ func (a *AuthService) Login(ctx context.Context, email string, password string,
 		return models.TokensPair{}, ErrInvalidData
 	}
 
-	if app.Secret == "" || app.RefreshSecret == "" {
-		a.log.Error("app secret is empty", slog.String("op", op))
-		return models.TokensPair{}, ErrInvalidData
+	if err := checkEmailVerified(user, app); err != nil {
+		a.log.Info("user email not verified", slog.String("op", op), slog.Int64("id", user.ID), slog.Int("app_id", app.ID))
+		return models.TokensPair{}, err
 	}
 
-	token, err := jwt.CreateToken(user.ID, app.ID, app.Secret, a.tokenExpires)
+	challengeID, err := a.startMFAChallenge(ctx, user.ID, app.ID, scope)
 	if err != nil {
-		a.log.Error("failed to create token", sl.OpErr(op, err))
+		a.log.Error("failed to start mfa challenge", sl.OpErr(op, err))
 		return models.TokensPair{}, err
 	}
-	refreshToken, err := jwt.CreateToken(user.ID, app.ID, app.RefreshSecret, a.refreshTokenExpires)
-	if err != nil {
-		a.log.Error("failed to create token", sl.OpErr(op, err))
-		return models.TokensPair{}, err
+	if challengeID != "" {
+		a.log.Info("user login needs second factor", slog.String("op", op), slog.String("email", email))
+		return models.TokensPair{MFAChallengeID: challengeID}, nil
 	}
 
-	tokensPair := models.TokensPair{
-		AccessToken:  token,
-		RefreshToken: refreshToken,
+	tokensPair, _, err := a.startSessionTokens(ctx, user.ID, app, scope, "")
+	if err != nil {
+		a.log.Error("failed to issue tokens", sl.OpErr(op, err))
+		return models.TokensPair{}, err
 	}
 
 	a.log.Info("user login complete", slog.String("op", op), slog.String("email", email))
 	return tokensPair, nil
+}
+
+// checkCredentials returns the user with the email if the password
+// matches, and ErrInvPassOrEmail otherwise. A matching password stored with
+// an outdated hash is rehashed.
+func (a *AuthService) checkCredentials(ctx context.Context, email string, password string) (models.User, error) {
+	const op = "services.auth.checkCredentials"
+
+	user, err := a.db.AuthDB.GetUserByEmail(ctx, email)
+	if err != nil {
+		a.log.Error("failed to get user by email", sl.OpErr(op, err))
+		return models.User{}, ErrInvPassOrEmail
+	}
+
+	rehash, err := a.passwords.Verify(user.PassHash, password)
+	if err != nil {
+		a.log.Error("invalid password", sl.OpErr(op, err))
+		return models.User{}, ErrInvPassOrEmail
+	}
+
+	if rehash {
+		a.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// rehashPassword replaces a hash created with an outdated algorithm or
+// parameters, unless the password was changed meanwhile. A failure is only
+// logged, the old hash keeps working.
+func (a *AuthService) rehashPassword(ctx context.Context, user models.User, password string) {
+	const op = "services.auth.rehashPassword"
 
+	passHash, err := a.passwords.Hash(password)
+	if err != nil {
+		a.log.Error("failed generate hash password", sl.OpErr(op, err))
+		return
+	}
+
+	if err := a.db.AuthDB.UpdatePasswordHash(ctx, user.ID, user.PassHash, passHash); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			a.log.Info("password changed before rehash", slog.String("op", op), slog.Int64("id", user.ID))
+			return
+		}
+		a.log.Error("failed to update password hash", sl.OpErr(op, err))
+		return
+	}
+
+	a.log.Info("password rehashed", slog.String("op", op), slog.Int64("id", user.ID))
 }
 
-func (a *AuthService) IsAdmin(ctx context.Context, userID int64, appID int) (bool, error) {
-	const op = "services.auth.IsAdmin"
+// startSessionTokens starts a session of the user in the app and issues
+// the first token pair of the session, with an ID token carrying the nonce
+// if the openid scope was requested. It returns the session id along with
+// the tokens.
+func (a *AuthService) startSessionTokens(ctx context.Context, userID int64, app models.App, scope string, nonce string) (models.TokensPair, string, error) {
+	const op = "services.auth.startSessionTokens"
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+
+	sessionID, err := a.startSession(ctx, userID, app.ID)
+	if err != nil {
+		a.log.Error("failed to start session", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+
+	claims, err := a.grantClaims(ctx, userID, app.ID, sessionID, scope)
+	if err != nil {
+		a.log.Error("failed to get user permissions", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+
+	token, err := a.createToken(claims, ring.signingKey(models.KeyKindAccess), a.tokenExpires)
+	if err != nil {
+		a.log.Error("failed to create token", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+	refreshToken, err := a.createToken(sessionClaims(userID, app.ID, sessionID), ring.signingKey(models.KeyKindRefresh), a.refreshTokenExpires)
+	if err != nil {
+		a.log.Error("failed to create token", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+
+	if err := a.db.TokenDB.CreateRefreshToken(ctx, a.refreshTokenRecord(refreshToken, sessionID, userID, app.ID, scope)); err != nil {
+		a.log.Error("failed to save refresh token", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
 
-	isAdmin, err := a.db.AuthDB.IsAdmin(ctx, userID, appID)
+	idToken, err := a.idToken(ctx, ring, userID, sessionID, scope, nonce)
 	if err != nil {
-		a.log.Error("failed to check user is admin", sl.OpErr(op, err))
-		return false, err
+		a.log.Error("failed to create id token", sl.OpErr(op, err))
+		return models.TokensPair{}, "", err
+	}
+
+	tokensPair := models.TokensPair{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+		ExpiresIn:    a.tokenExpires,
+		Scope:        grantedScope(scope, claims),
 	}
 
-	a.log.Info("user is admin",
-		slog.String("op", op),
-		slog.Int64("id", userID),
-		slog.Int("app_id", appID),
-		slog.Bool("is_admin", isAdmin),
-	)
-	return isAdmin, nil
+	return tokensPair, sessionID, nil
 }
 
-func (a *AuthService) RefreshToken(ctx context.Context, token string, appID int) (tokens models.TokensPair, err error) {
+// RefreshToken exchanges the refresh token for a new token pair. The
+// permissions in the new access token are those the user has now, within
+// the scope requested at login. A non-empty scope narrows that scope
+// further; it cannot widen it.
+func (a *AuthService) RefreshToken(ctx context.Context, token string, appID int, scope string) (tokens models.TokensPair, err error) {
 	const op = "services.auth.RefreshToken"
 
 	app, err := a.db.AppDB.GetAppByID(ctx, appID)
@@ -160,31 +427,96 @@ func (a *AuthService) RefreshToken(ctx context.Context, token string, appID int)
 		return models.TokensPair{}, ErrInvalidData
 	}
 
-	if app.Secret == "" || app.RefreshSecret == "" {
-		a.log.Error("app secret is empty", slog.String("op", op))
-		return models.TokensPair{}, ErrInvalidData
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.TokensPair{}, err
 	}
 
-	decodeToken, err := jwt.DecodeToken(token, app.RefreshSecret)
+	decodeToken, err := jwt.DecodeToken(token, a.tokenOptions(app.ID), ring.verifyKeys(models.KeyKindRefresh)...)
 	if err != nil {
 		a.log.Error("failed to decode token", sl.OpErr(op, err))
 		return models.TokensPair{}, ErrUnauthorized
 	}
 
-	accessToken, err := jwt.CreateToken(decodeToken.UserID, app.ID, app.Secret, a.tokenExpires)
+	stored, err := a.db.TokenDB.GetRefreshToken(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			a.log.Error("refresh token is unknown", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+			return models.TokensPair{}, ErrUnauthorized
+		}
+		a.log.Error("failed to get refresh token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	switch {
+	case stored.RevokedAt != nil || stored.AppID != app.ID:
+		a.log.Error("refresh token is revoked", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+		return models.TokensPair{}, ErrUnauthorized
+	case stored.ConsumedAt != nil:
+		a.refreshTokenReused(ctx, stored)
+		return models.TokensPair{}, ErrUnauthorized
+	}
+
+	if err := a.checkSession(ctx, stored.FamilyID); err != nil {
+		a.log.Error("session is not active", sl.OpErr(op, err), slog.String("session_id", stored.FamilyID))
+		return models.TokensPair{}, err
+	}
+
+	if err := a.checkUserEmailVerified(ctx, stored.UserID, app); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			a.log.Error("user not found", slog.String("op", op), slog.Int64("id", stored.UserID))
+			return models.TokensPair{}, ErrUnauthorized
+		}
+		a.log.Error("failed to check email verification", sl.OpErr(op, err), slog.Int64("id", stored.UserID))
+		return models.TokensPair{}, err
+	}
+
+	scope, err = narrowScope(stored.Scope, scope)
+	if err != nil {
+		a.log.Error("requested scope exceeds the granted scope", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	claims, err := a.grantClaims(ctx, stored.UserID, app.ID, stored.FamilyID, scope)
+	if err != nil {
+		a.log.Error("failed to get user permissions", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	accessToken, err := a.createToken(claims, ring.signingKey(models.KeyKindAccess), a.tokenExpires)
 	if err != nil {
 		a.log.Error("failed to create token", sl.OpErr(op, err))
 		return models.TokensPair{}, err
 	}
-	refreshToken, err := jwt.CreateToken(decodeToken.UserID, app.ID, app.RefreshSecret, a.refreshTokenExpires)
+	refreshToken, err := a.createToken(sessionClaims(stored.UserID, app.ID, stored.FamilyID), ring.signingKey(models.KeyKindRefresh), a.refreshTokenExpires)
 	if err != nil {
 		a.log.Error("failed to create token", sl.OpErr(op, err))
 		return models.TokensPair{}, err
 	}
 
+	next := a.refreshTokenRecord(refreshToken, stored.FamilyID, stored.UserID, app.ID, scope)
+	if err := a.db.TokenDB.RotateRefreshToken(ctx, stored.TokenHash, next); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			a.refreshTokenReused(ctx, stored)
+			return models.TokensPair{}, ErrUnauthorized
+		}
+		a.log.Error("failed to rotate refresh token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	idToken, err := a.idToken(ctx, ring, stored.UserID, stored.FamilyID, scope, "")
+	if err != nil {
+		a.log.Error("failed to create id token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
 	tokensPair := models.TokensPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
+		IDToken:      idToken,
+		ExpiresIn:    a.tokenExpires,
+		Scope:        grantedScope(scope, claims),
 	}
 
 	a.log.Info("user refresh token complete", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
@@ -194,21 +526,10 @@ func (a *AuthService) RefreshToken(ctx context.Context, token string, appID int)
 func (a *AuthService) CurrentUser(ctx context.Context, token string, appID int) (models.UserRead, error) {
 	const op = "services.auth.CurrentUser"
 
-	app, err := a.db.AppDB.GetAppByID(ctx, appID)
-	if err != nil {
-		a.log.Error("failed to get app by id", sl.OpErr(op, err))
-		return models.UserRead{}, ErrInvalidData
-	}
-
-	if app.Secret == "" || app.RefreshSecret == "" {
-		a.log.Error("app secret is empty", slog.String("op", op))
-		return models.UserRead{}, ErrInvalidData
-	}
-
-	decodeToken, err := jwt.DecodeToken(token, app.Secret)
+	decodeToken, err := a.authenticateUser(ctx, token, appID)
 	if err != nil {
-		a.log.Error("failed to decode token", sl.OpErr(op, err))
-		return models.UserRead{}, ErrUnauthorized
+		a.log.Error("failed to authenticate token", sl.OpErr(op, err))
+		return models.UserRead{}, err
 	}
 
 	user, err := a.db.AuthDB.GetUserByID(ctx, decodeToken.UserID)
@@ -219,8 +540,30 @@ func (a *AuthService) CurrentUser(ctx context.Context, token string, appID int)
 
 	a.log.Info("get user complete", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
 	return models.UserRead{
-		ID:    user.ID,
-		Email: user.Email,
-		Name:  user.Name,
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		EmailVerified: user.EmailVerified,
 	}, nil
 }
+
+func (a *AuthService) createToken(claims models.Token, key jwt.Key, expires time.Duration) (string, error) {
+	return jwt.CreateToken(claims, a.tokenOptions(claims.AppID), key, expires)
+}
+
+func sessionClaims(userID int64, appID int, sessionID string) models.Token {
+	return models.Token{
+		UserID:    userID,
+		AppID:     appID,
+		SessionID: sessionID,
+	}
+}
+
+// tokenOptions returns the issuer and audience of the app's tokens.
+func (a *AuthService) tokenOptions(appID int) jwt.Options {
+	return jwt.Options{
+		Issuer:    a.jwtConfig.Issuer,
+		Audience:  jwt.Audience(appID),
+		ClockSkew: a.jwtConfig.ClockSkew,
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const clientSecretBytes = 32
+
+// legacySecretHashPrefix starts the bcrypt hashes client secrets were
+// stored as before. The secrets are random, so a plain SHA-256 hash is
+// enough and spares a bcrypt computation on every client request.
+const legacySecretHashPrefix = "$2"
+
+// CreateServiceClient creates a confidential client of the app that may get
+// tokens with the given scope, a space separated list of permissions, and
+// exchange tokens of users for tokens of the audience apps. The secret is
+// returned only here; the service keeps its hash.
+func (a *AuthService) CreateServiceClient(ctx context.Context, token string, appID int, name string, scope string, audiences []int) (models.ServiceClient, string, error) {
+	const op = "services.auth.CreateServiceClient"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return models.ServiceClient{}, "", err
+	}
+
+	if _, err := a.db.AppDB.GetAppByID(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.ServiceClient{}, "", ErrInvalidData
+	}
+	for _, audience := range audiences {
+		if _, err := a.db.AppDB.GetAppByID(ctx, audience); err != nil {
+			a.log.Error("failed to get audience app by id", sl.OpErr(op, err))
+			return models.ServiceClient{}, "", ErrInvalidData
+		}
+	}
+
+	clientID, err := secret.ID()
+	if err != nil {
+		a.log.Error("failed to generate client id", sl.OpErr(op, err))
+		return models.ServiceClient{}, "", err
+	}
+
+	clientSecret, err := secret.Generate(clientSecretBytes)
+	if err != nil {
+		a.log.Error("failed to generate client secret", sl.OpErr(op, err))
+		return models.ServiceClient{}, "", err
+	}
+
+	permissions := strings.Fields(scope)
+	slices.Sort(permissions)
+
+	client := models.ServiceClient{
+		ID:         clientID,
+		AppID:      appID,
+		Name:       name,
+		SecretHash: secret.Hash(clientSecret),
+		Scope:      strings.Join(slices.Compact(permissions), " "),
+		Audiences:  audiences,
+	}
+
+	if err := a.db.ClientDB.CreateServiceClient(ctx, client); err != nil {
+		a.log.Error("failed to create service client", sl.OpErr(op, err))
+		return models.ServiceClient{}, "", err
+	}
+
+	a.log.Info("service client created",
+		slog.String("op", op),
+		slog.String("client_id", clientID),
+		slog.Int("app_id", appID),
+		slog.Int64("created_by", caller.UserID),
+	)
+	return client, clientSecret, nil
+}
+
+func (a *AuthService) DeleteServiceClient(ctx context.Context, token string, clientID string) error {
+	const op = "services.auth.DeleteServiceClient"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := a.db.ClientDB.DeleteServiceClient(ctx, clientID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to delete service client", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("service client deleted",
+		slog.String("op", op),
+		slog.String("client_id", clientID),
+		slog.Int64("deleted_by", caller.UserID),
+	)
+	return nil
+}
+
+// ClientCredentials issues an access token to a service client, as in the
+// client credentials grant of RFC 6749, section 4.4. The token has no
+// session or refresh token and its subject is the client id. A non-empty
+// scope narrows the permissions granted to the client.
+func (a *AuthService) ClientCredentials(ctx context.Context, clientID string, clientSecret string, scope string) (models.TokensPair, error) {
+	const op = "services.auth.ClientCredentials"
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.TokensPair{}, err
+	}
+
+	granted := client.Scope
+	if scope != "" {
+		allowed := strings.Fields(client.Scope)
+		for _, permission := range strings.Fields(scope) {
+			if !slices.Contains(allowed, permission) {
+				a.log.Error("requested scope exceeds the client scope", slog.String("op", op), slog.String("client_id", clientID))
+				return models.TokensPair{}, ErrInvalidData
+			}
+		}
+		granted = scope
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, client.AppID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidClient
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	claims := models.Token{
+		AppID:    app.ID,
+		ClientID: client.ID,
+		Scope:    granted,
+	}
+
+	accessToken, err := a.createToken(claims, ring.signingKey(models.KeyKindAccess), a.oauth.ClientTokenExpires)
+	if err != nil {
+		a.log.Error("failed to create token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Info("service client token issued", slog.String("op", op), slog.String("client_id", clientID), slog.Int("app_id", app.ID))
+	return models.TokensPair{
+		AccessToken: accessToken,
+		ExpiresIn:   a.oauth.ClientTokenExpires,
+		Scope:       granted,
+	}, nil
+}
+
+// authenticateClient returns the service client if the secret matches, and
+// ErrInvalidClient otherwise.
+func (a *AuthService) authenticateClient(ctx context.Context, clientID string, clientSecret string) (models.ServiceClient, error) {
+	const op = "services.auth.authenticateClient"
+
+	client, err := a.db.ClientDB.GetServiceClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return models.ServiceClient{}, ErrInvalidClient
+		}
+		a.log.Error("failed to get service client", sl.OpErr(op, err))
+		return models.ServiceClient{}, err
+	}
+
+	if strings.HasPrefix(client.SecretHash, legacySecretHashPrefix) {
+		if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+			a.log.Error("invalid client secret", slog.String("op", op), slog.String("client_id", clientID))
+			return models.ServiceClient{}, ErrInvalidClient
+		}
+		a.rehashClientSecret(ctx, client, clientSecret)
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(secret.Hash(clientSecret))) != 1 {
+		a.log.Error("invalid client secret", slog.String("op", op), slog.String("client_id", clientID))
+		return models.ServiceClient{}, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// rehashClientSecret replaces the bcrypt hash of a client secret with its
+// SHA-256 hash, unless it was changed meanwhile. A failure is only logged,
+// the bcrypt hash keeps working.
+func (a *AuthService) rehashClientSecret(ctx context.Context, client models.ServiceClient, clientSecret string) {
+	const op = "services.auth.rehashClientSecret"
+
+	if err := a.db.ClientDB.UpdateServiceClientSecretHash(ctx, client.ID, client.SecretHash, secret.Hash(clientSecret)); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			a.log.Info("client secret changed before rehash", slog.String("op", op), slog.String("client_id", client.ID))
+			return
+		}
+		a.log.Error("failed to update client secret hash", sl.OpErr(op, err))
+		return
+	}
+
+	a.log.Info("client secret rehashed", slog.String("op", op), slog.String("client_id", client.ID))
+}
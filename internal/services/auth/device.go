@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/clientinfo"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	deviceCodeBytes = 32
+
+	// User codes are 8 characters without vowels, so that no words can be
+	// formed, shown as two groups of four (RFC 8628, section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// slowDownStep is added to the polling interval of a device that polls
+	// too often (RFC 8628, section 3.5).
+	slowDownStep = 5 * time.Second
+
+	userCodeAttempts = 3
+)
+
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("slow down")
+	ErrAccessDenied         = errors.New("access denied")
+	ErrExpiredToken         = errors.New("expired token")
+	ErrTooManyAttempts      = errors.New("too many attempts")
+)
+
+// DeviceAuthorization starts the device authorization grant of RFC 8628 for
+// the app. The device shows the user code and verification URI to the user
+// and polls DeviceToken with the device code until the user decided.
+func (a *AuthService) DeviceAuthorization(ctx context.Context, appID int, scope string) (models.DeviceAuthorization, error) {
+	const op = "services.auth.DeviceAuthorization"
+
+	if _, err := a.db.AppDB.GetAppByID(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.DeviceAuthorization{}, ErrInvalidClient
+	}
+
+	deviceCode, err := secret.Generate(deviceCodeBytes)
+	if err != nil {
+		a.log.Error("failed to generate device code", sl.OpErr(op, err))
+		return models.DeviceAuthorization{}, err
+	}
+
+	record := models.DeviceCode{
+		DeviceCodeHash: secret.Hash(deviceCode),
+		AppID:          appID,
+		Scope:          scope,
+		Interval:       a.oauth.DevicePollInterval,
+		ExpiresAt:      time.Now().Add(a.oauth.DeviceCodeExpires),
+	}
+
+	// A user code may be taken by a request that did not expire yet.
+	for attempt := 1; ; attempt++ {
+		record.UserCode, err = generateUserCode()
+		if err != nil {
+			a.log.Error("failed to generate user code", sl.OpErr(op, err))
+			return models.DeviceAuthorization{}, err
+		}
+
+		err = a.db.TokenDB.CreateDeviceCode(ctx, record)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, database.ErrConflict) || attempt == userCodeAttempts {
+			a.log.Error("failed to save device code", sl.OpErr(op, err))
+			return models.DeviceAuthorization{}, err
+		}
+	}
+
+	userCode := formatUserCode(record.UserCode)
+	verificationURI := strings.TrimSuffix(a.jwtConfig.Issuer, "/") + "/device"
+
+	a.log.Info("device authorization started", slog.String("op", op), slog.Int("app_id", appID))
+	return models.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               a.oauth.DeviceCodeExpires,
+		Interval:                a.oauth.DevicePollInterval,
+	}, nil
+}
+
+// ApproveDevice records the decision of the token owner on the device
+// authorization request with the user code. The token must be an access
+// token of the app the device asked for.
+func (a *AuthService) ApproveDevice(ctx context.Context, token string, userCode string, approve bool) error {
+	const op = "services.auth.ApproveDevice"
+
+	code, err := a.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	decodeToken, err := a.authenticateUser(ctx, token, code.AppID)
+	if err != nil {
+		a.log.Error("failed to authenticate token", sl.OpErr(op, err))
+		return err
+	}
+	if decodeToken.Actor != nil {
+		a.log.Error("delegated token cannot approve devices", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+		return ErrForbidden
+	}
+
+	return a.decideDevice(ctx, code, decodeToken.UserID, approve)
+}
+
+// ApproveDeviceWithPassword records the decision of the user signing in
+// on the verification page. If the user enrolled a second factor, it
+// returns the id of an MFA challenge instead, answered with
+// ApproveDeviceWithMFA.
+func (a *AuthService) ApproveDeviceWithPassword(ctx context.Context, userCode string, email string, password string, approve bool) (string, error) {
+	const op = "services.auth.ApproveDeviceWithPassword"
+
+	code, err := a.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := a.checkCredentials(ctx, email, password)
+	if err != nil {
+		a.log.Error("failed to check credentials", sl.OpErr(op, err))
+		return "", err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, code.AppID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return "", ErrInvalidData
+	}
+
+	if err := checkEmailVerified(user, app); err != nil {
+		a.log.Info("user email not verified", slog.String("op", op), slog.Int64("id", user.ID), slog.Int("app_id", app.ID))
+		return "", err
+	}
+
+	challengeID, err := a.startMFAChallenge(ctx, user.ID, code.AppID, code.Scope)
+	if err != nil {
+		a.log.Error("failed to start mfa challenge", sl.OpErr(op, err))
+		return "", err
+	}
+	if challengeID != "" {
+		return challengeID, nil
+	}
+
+	return "", a.decideDevice(ctx, code, user.ID, approve)
+}
+
+// ApproveDeviceWithMFA answers the MFA challenge started by
+// ApproveDeviceWithPassword and records the decision of the user.
+func (a *AuthService) ApproveDeviceWithMFA(ctx context.Context, userCode string, challengeID string, mfaCode string, approve bool) error {
+	const op = "services.auth.ApproveDeviceWithMFA"
+
+	code, err := a.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := a.passMFAChallenge(ctx, challengeID, mfaCode, code.AppID)
+	if err != nil {
+		a.log.Error("failed to pass mfa challenge", sl.OpErr(op, err))
+		return err
+	}
+
+	return a.decideDevice(ctx, code, challenge.UserID, approve)
+}
+
+// DeviceToken is polled by the device with its device code. It returns
+// ErrAuthorizationPending until the user decided, and ErrSlowDown when the
+// device polls more often than its interval allows, which also increases
+// the interval. Once the user approved, the first poll to get its tokens
+// issued uses up the code.
+func (a *AuthService) DeviceToken(ctx context.Context, appID int, deviceCode string) (models.TokensPair, error) {
+	const op = "services.auth.DeviceToken"
+
+	deviceCodeHash := secret.Hash(deviceCode)
+	code, err := a.db.TokenDB.PollDeviceCode(ctx, deviceCodeHash, appID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			return models.TokensPair{}, ErrInvalidGrant
+		case errors.Is(err, database.ErrExpired):
+			return models.TokensPair{}, ErrExpiredToken
+		}
+		a.log.Error("failed to poll device code", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	switch code.Status {
+	case models.DeviceCodeDenied:
+		return models.TokensPair{}, ErrAccessDenied
+	case models.DeviceCodeConsumed:
+		return models.TokensPair{}, ErrInvalidGrant
+	case models.DeviceCodePending:
+		if code.LastPolledAt != nil && time.Since(*code.LastPolledAt) < code.Interval {
+			if err := a.db.TokenDB.SlowDownDeviceCode(ctx, deviceCodeHash, slowDownStep); err != nil {
+				a.log.Error("failed to slow down device code", sl.OpErr(op, err))
+			}
+			return models.TokensPair{}, ErrSlowDown
+		}
+		return models.TokensPair{}, ErrAuthorizationPending
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidClient
+	}
+
+	tokensPair, sessionID, err := a.startSessionTokens(ctx, *code.UserID, app, code.Scope, "")
+	if err != nil {
+		a.log.Error("failed to issue tokens", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	// Concurrent polls may both issue tokens; only the first to use up the
+	// code keeps its session.
+	if err := a.db.TokenDB.ConsumeDeviceCode(ctx, deviceCodeHash); err != nil {
+		if err := a.db.SessionDB.EndSession(ctx, sessionID); err != nil {
+			a.log.Error("failed to end session", sl.OpErr(op, err))
+		}
+		if errors.Is(err, database.ErrConflict) {
+			return models.TokensPair{}, ErrInvalidGrant
+		}
+		a.log.Error("failed to consume device code", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Info("device authorization complete", slog.String("op", op), slog.Int64("id", *code.UserID), slog.Int("app_id", appID))
+	return tokensPair, nil
+}
+
+// DeviceRequest returns what the user is asked to allow with the user code:
+// the app and the scope it requested.
+func (a *AuthService) DeviceRequest(ctx context.Context, userCode string) (models.DeviceRequest, error) {
+	const op = "services.auth.DeviceRequest"
+
+	code, err := a.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return models.DeviceRequest{}, err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, code.AppID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.DeviceRequest{}, ErrInvalidData
+	}
+
+	return models.DeviceRequest{
+		UserCode: formatUserCode(code.UserCode),
+		AppName:  app.Name,
+		Scope:    code.Scope,
+	}, nil
+}
+
+// pendingDeviceCode returns the device code with the user code, which the
+// user may type in any case and with or without the separator. Unknown,
+// expired and decided codes are ErrInvalidData. A client that typed too
+// many of those lately gets ErrTooManyAttempts, so user codes cannot be
+// guessed.
+func (a *AuthService) pendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "services.auth.pendingDeviceCode"
+
+	clientIP := clientinfo.FromContext(ctx).IP
+	failures, err := a.db.TokenDB.CountUserCodeFailures(ctx, clientIP, time.Now().Add(-a.oauth.UserCodeAttemptWindow))
+	if err != nil {
+		a.log.Error("failed to count user code failures", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+	if failures >= a.oauth.UserCodeMaxAttempts {
+		a.log.Warn("too many user code failures", slog.String("op", op), slog.String("ip", clientIP))
+		return models.DeviceCode{}, ErrTooManyAttempts
+	}
+
+	code, err := a.db.TokenDB.GetDeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		a.log.Error("failed to get device code", sl.OpErr(op, err))
+		return models.DeviceCode{}, err
+	}
+
+	if err != nil || code.Status != models.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		a.log.Error("device code is not pending", slog.String("op", op), slog.String("status", code.Status))
+		if err := a.db.TokenDB.CreateUserCodeFailure(ctx, clientIP); err != nil {
+			a.log.Error("failed to record user code failure", sl.OpErr(op, err))
+		}
+		return models.DeviceCode{}, ErrInvalidData
+	}
+
+	return code, nil
+}
+
+func (a *AuthService) decideDevice(ctx context.Context, code models.DeviceCode, userID int64, approve bool) error {
+	const op = "services.auth.decideDevice"
+
+	status := models.DeviceCodeDenied
+	if approve {
+		status = models.DeviceCodeApproved
+	}
+
+	if err := a.db.TokenDB.DecideDeviceCode(ctx, code.UserCode, userID, status); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to decide device code", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("device authorization decided",
+		slog.String("op", op),
+		slog.Int64("id", userID),
+		slog.Int("app_id", code.AppID),
+		slog.String("status", status),
+	)
+	return nil
+}
+
+func generateUserCode() (string, error) {
+	var b strings.Builder
+	size := big.NewInt(int64(len(userCodeAlphabet)))
+	for range userCodeLength {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
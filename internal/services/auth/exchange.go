@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTarget = errors.New("invalid target")
+
+// minExchangeExpires is the lifetime of a token exchanged from a subject
+// token that expired within the clock skew, which is still accepted.
+const minExchangeExpires = time.Second
+
+// TokenExchange lets a service client call another app on behalf of a user,
+// as in RFC 8693. The subject token is an access token of the user for the
+// client's app, and the audience must be one of the client's audiences.
+// The new token is signed for the audience app, carries only the requested
+// permissions, which the user must have in that app, and names the client
+// in its act claim. It belongs to the session of the subject token and
+// expires no later than it.
+func (a *AuthService) TokenExchange(ctx context.Context, clientID string, clientSecret string, subjectToken string, audience int, scope string) (models.TokensPair, error) {
+	const op = "services.auth.TokenExchange"
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.TokensPair{}, err
+	}
+
+	subject, err := a.authenticate(ctx, subjectToken, client.AppID)
+	if err != nil {
+		a.log.Error("failed to authenticate subject token", sl.OpErr(op, err), slog.String("client_id", clientID))
+		if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrInvalidData) {
+			return models.TokensPair{}, ErrInvalidGrant
+		}
+		return models.TokensPair{}, err
+	}
+	if subject.ClientID != "" || subject.UserID == 0 {
+		a.log.Error("subject token does not belong to a user", slog.String("op", op), slog.String("client_id", clientID))
+		return models.TokensPair{}, ErrInvalidGrant
+	}
+	if impersonator(subject) != nil {
+		a.log.Error("impersonation token cannot be exchanged", slog.String("op", op), slog.String("client_id", clientID))
+		return models.TokensPair{}, ErrInvalidGrant
+	}
+
+	oidc, requested := splitScope(scope)
+	if len(oidc) > 0 || len(requested) == 0 {
+		a.log.Error("invalid exchange scope", slog.String("op", op), slog.String("scope", scope))
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	if !slices.Contains(client.Audiences, audience) {
+		a.log.Error("audience not allowed for client", slog.String("op", op), slog.String("client_id", clientID), slog.Int("audience", audience))
+		return models.TokensPair{}, ErrInvalidTarget
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, audience)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidTarget
+	}
+
+	if err := a.checkUserEmailVerified(ctx, subject.UserID, app); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			a.log.Error("user not found", slog.String("op", op), slog.Int64("id", subject.UserID))
+			return models.TokensPair{}, ErrInvalidGrant
+		}
+		a.log.Error("failed to check email verification", sl.OpErr(op, err), slog.Int64("id", subject.UserID))
+		return models.TokensPair{}, err
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	claims, err := a.grantClaims(ctx, subject.UserID, app.ID, subject.SessionID, scope)
+	if err != nil {
+		a.log.Error("failed to get user permissions", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	granted := strings.Fields(claims.Scope)
+	for _, permission := range requested {
+		if !slices.Contains(granted, permission) {
+			a.log.Error("user lacks requested permission",
+				slog.String("op", op),
+				slog.Int64("id", subject.UserID),
+				slog.Int("app_id", app.ID),
+				slog.String("permission", permission),
+			)
+			return models.TokensPair{}, ErrInvalidData
+		}
+	}
+
+	claims.Actor = &models.Actor{Subject: client.ID, Actor: subject.Actor}
+
+	expires := a.tokenExpires
+	if subject.ExpiresAt != nil {
+		expires = max(min(expires, time.Until(subject.ExpiresAt.Time)), minExchangeExpires)
+	}
+
+	token, err := a.createToken(claims, ring.signingKey(models.KeyKindAccess), expires)
+	if err != nil {
+		a.log.Error("failed to create token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Info("token exchanged",
+		slog.String("op", op),
+		slog.Int64("id", subject.UserID),
+		slog.String("client_id", clientID),
+		slog.Int("app_id", app.ID),
+	)
+	return models.TokensPair{
+		AccessToken: token,
+		ExpiresIn:   expires,
+		Scope:       claims.Scope,
+	}, nil
+}
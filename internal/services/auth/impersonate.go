@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/clientinfo"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"slices"
+	"strconv"
+)
+
+// PermissionImpersonate allows signing in to the app as another user. The
+// built-in admin role grants it.
+const PermissionImpersonate = "users:impersonate"
+
+// Impersonate issues an access token of the user for the caller, who must
+// have PermissionImpersonate in the app. Admins of the app cannot be
+// impersonated, nor users whose roles grant a permission the caller lacks.
+// The token carries the caller in its act claim, has no session or refresh
+// token and lives for jwt.impersonation_expires. Issuing it and every later
+// use of it are recorded in the impersonation audit.
+func (a *AuthService) Impersonate(ctx context.Context, token string, appID int, userID int64, reason string) (models.TokensPair, error) {
+	const op = "services.auth.Impersonate"
+
+	caller, err := a.authorize(ctx, token, appID, PermissionImpersonate)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+	if caller.UserID == userID {
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	user, err := a.db.AuthDB.GetUserByID(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to get user by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	roles, err := a.db.RoleDB.GetUserRoles(ctx, userID, appID)
+	if err != nil {
+		a.log.Error("failed to get user roles", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+	if slices.ContainsFunc(roles, func(role models.Role) bool { return role.Name == models.RoleAdmin }) {
+		a.log.Error("admin cannot be impersonated", slog.String("op", op), slog.Int64("actor_id", caller.UserID), slog.Int64("id", userID))
+		return models.TokensPair{}, ErrForbidden
+	}
+
+	callerRoles, err := a.db.RoleDB.GetUserRoles(ctx, caller.UserID, appID)
+	if err != nil {
+		a.log.Error("failed to get caller roles", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+	if !grantsAll(callerRoles, roles) {
+		a.log.Error("user has permissions the caller lacks", slog.String("op", op), slog.Int64("actor_id", caller.UserID), slog.Int64("id", userID))
+		return models.TokensPair{}, ErrForbidden
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	if err := checkEmailVerified(user, app); err != nil {
+		a.log.Info("user email not verified", slog.String("op", op), slog.Int64("id", userID), slog.Int("app_id", app.ID))
+		return models.TokensPair{}, err
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	claims, err := a.grantClaims(ctx, userID, appID, "", "")
+	if err != nil {
+		a.log.Error("failed to get user permissions", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+	claims.Actor = &models.Actor{
+		Subject: strconv.FormatInt(caller.UserID, 10),
+		UserID:  caller.UserID,
+	}
+
+	expires := a.jwtConfig.ImpersonationExpires
+	accessToken, err := a.createToken(claims, ring.signingKey(models.KeyKindAccess), expires)
+	if err != nil {
+		a.log.Error("failed to create token", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	// The token id is only known once the token is signed.
+	issued, err := jwt.UnverifiedClaims(accessToken)
+	if err != nil {
+		a.log.Error("failed to read token claims", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	if err := a.auditImpersonation(ctx, models.ImpersonationIssued, issued, caller.UserID, reason); err != nil {
+		a.log.Error("failed to audit impersonation", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Warn("user impersonated",
+		slog.String("op", op),
+		slog.Int64("actor_id", caller.UserID),
+		slog.Int64("id", userID),
+		slog.Int("app_id", appID),
+		slog.String("jti", issued.ID),
+	)
+	return models.TokensPair{
+		AccessToken: accessToken,
+		ExpiresIn:   expires,
+		Scope:       claims.Scope,
+	}, nil
+}
+
+// impersonator returns the admin who impersonated the owner of the token,
+// also when the impersonation token was exchanged since, and nil for other
+// tokens.
+func impersonator(token models.Token) *models.Actor {
+	for actor := token.Actor; actor != nil; actor = actor.Actor {
+		if actor.UserID != 0 {
+			return actor
+		}
+	}
+
+	return nil
+}
+
+func (a *AuthService) auditImpersonation(ctx context.Context, event string, token models.Token, actorID int64, reason string) error {
+	client := clientinfo.FromContext(ctx)
+
+	return a.db.AuditDB.CreateImpersonationEvent(ctx, models.ImpersonationEvent{
+		Event:     event,
+		TokenID:   token.ID,
+		ActorID:   actorID,
+		UserID:    token.UserID,
+		AppID:     token.AppID,
+		Reason:    reason,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+)
+
+// Introspect reports the state of an access or refresh token of the app
+// following RFC 7662. Tokens that fail verification, belong to an ended
+// session or were already exchanged are reported as inactive rather than
+// as an error. The hint only decides which token type is tried first.
+func (a *AuthService) Introspect(ctx context.Context, token string, appID int, tokenTypeHint string) (models.Introspection, error) {
+	const op = "services.auth.Introspect"
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.Introspection{}, ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.Introspection{}, err
+	}
+
+	kinds := []string{models.KeyKindAccess, models.KeyKindRefresh}
+	if tokenTypeHint == models.TokenTypeRefresh {
+		kinds = []string{models.KeyKindRefresh, models.KeyKindAccess}
+	}
+
+	for _, kind := range kinds {
+		decodeToken, err := jwt.DecodeToken(token, a.tokenOptions(app.ID), ring.verifyKeys(kind)...)
+		if err != nil {
+			continue
+		}
+
+		active, err := a.tokenActive(ctx, token, decodeToken, kind)
+		if err != nil {
+			a.log.Error("failed to check token state", sl.OpErr(op, err))
+			return models.Introspection{}, err
+		}
+		if !active {
+			break
+		}
+
+		a.log.Info("token introspection complete", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+		return introspection(decodeToken, kind), nil
+	}
+
+	a.log.Info("token is not active", slog.String("op", op), slog.Int("app_id", appID))
+	return models.Introspection{}, nil
+}
+
+// tokenActive checks the stored state of a verified token: the revocation
+// list, the refresh token record and the session. Unlike RefreshToken it
+// only reads that state, so introspecting a consumed refresh token does not
+// count as reuse.
+func (a *AuthService) tokenActive(ctx context.Context, token string, decodeToken models.Token, kind string) (bool, error) {
+	sessionID := decodeToken.SessionID
+
+	if kind == models.KeyKindRefresh {
+		stored, err := a.db.TokenDB.GetRefreshToken(ctx, secret.Hash(token))
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		if stored.ConsumedAt != nil || stored.RevokedAt != nil || stored.AppID != decodeToken.AppID {
+			return false, nil
+		}
+		sessionID = stored.FamilyID
+	} else {
+		revoked, err := a.tokenRevoked(ctx, decodeToken.ID)
+		if err != nil || revoked {
+			return false, err
+		}
+	}
+
+	// Tokens of service clients and access tokens issued before sessions
+	// were introduced have no session id and stay active until they expire.
+	if sessionID == "" {
+		return true, nil
+	}
+
+	if err := a.sessionActive(ctx, sessionID); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func introspection(token models.Token, kind string) models.Introspection {
+	result := models.Introspection{
+		Active:    true,
+		TokenType: models.TokenTypeAccess,
+		Subject:   token.Subject,
+		UserID:    token.UserID,
+		AppID:     token.AppID,
+		Scope:     token.Scope,
+		SessionID: token.SessionID,
+		TokenID:   token.ID,
+		ClientID:  token.ClientID,
+		Actor:     token.Actor,
+	}
+	if kind == models.KeyKindRefresh {
+		result.TokenType = models.TokenTypeRefresh
+	}
+	if token.IssuedAt != nil {
+		result.IssuedAt = token.IssuedAt.Time
+	}
+	if token.ExpiresAt != nil {
+		result.ExpiresAt = token.ExpiresAt.Time
+	}
+
+	return result
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"time"
+)
+
+// keyRing holds the keys of an app that are not retired, newest activation
+// first.
+type keyRing struct {
+	app  models.App
+	keys []models.AppKey
+}
+
+// JWKS returns the public keys that verify access tokens of the app,
+// including keys that are published ahead of their activation. Apps signing
+// with a shared secret have no public keys to publish.
+func (a *AuthService) JWKS(ctx context.Context, appID int) ([]jwt.JWK, error) {
+	const op = "services.auth.JWKS"
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return nil, ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	keys := []jwt.JWK{}
+	for _, key := range ring.verifyKeys(models.KeyKindAccess) {
+		if !jwt.IsAsymmetric(key.Algorithm) {
+			continue
+		}
+
+		jwk, err := jwt.PublicJWK(key)
+		if err != nil {
+			a.log.Error("failed to build jwk", sl.OpErr(op, err), slog.String("kid", key.ID))
+			return nil, err
+		}
+		keys = append(keys, jwk)
+	}
+
+	a.log.Info("get jwks complete", slog.String("op", op), slog.Int("app_id", appID), slog.Int("count", len(keys)))
+	return keys, nil
+}
+
+// errNoSigningKey is returned when an app has no key to sign tokens with.
+var errNoSigningKey = errors.New("app has no signing key")
+
+// keyRing loads the keys of the app. It never creates keys: requests racing
+// on an app without keys would each create one. Keys are created with the
+// app and afterwards only by the key rotator.
+func (a *AuthService) keyRing(ctx context.Context, app models.App) (keyRing, error) {
+	const op = "services.auth.keyRing"
+
+	ring, err := a.loadKeyRing(ctx, app)
+	if err != nil {
+		return keyRing{}, err
+	}
+
+	now := time.Now()
+	for _, kind := range []string{models.KeyKindAccess, models.KeyKindRefresh} {
+		if _, ok := ring.current(kind, now); !ok {
+			a.log.Error("no signing key", slog.String("op", op), slog.Int("app_id", app.ID), slog.String("kind", kind))
+			return keyRing{}, errNoSigningKey
+		}
+	}
+
+	return ring, nil
+}
+
+func (a *AuthService) loadKeyRing(ctx context.Context, app models.App) (keyRing, error) {
+	const op = "services.auth.loadKeyRing"
+
+	keys, err := a.db.AppDB.GetAppKeys(ctx, app.ID)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return keyRing{}, err
+	}
+
+	return keyRing{app: app, keys: keys}, nil
+}
+
+// newKeys generates the signing keys of a new app, which are saved
+// together with it.
+func (a *AuthService) newKeys(app models.App) ([]models.AppKey, error) {
+	var keys []models.AppKey
+	now := time.Now()
+
+	for _, kind := range []string{models.KeyKindAccess, models.KeyKindRefresh} {
+		key, err := a.newKey(app, kind, now)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (a *AuthService) newKey(app models.App, kind string, activatesAt time.Time) (models.AppKey, error) {
+	const op = "services.auth.newKey"
+
+	alg := keyAlgorithm(app, kind)
+
+	keySecret, err := jwt.GenerateKey(alg)
+	if err != nil {
+		a.log.Error("failed to generate key", sl.OpErr(op, err))
+		return models.AppKey{}, err
+	}
+
+	kid, err := secret.ID()
+	if err != nil {
+		a.log.Error("failed to generate key id", sl.OpErr(op, err))
+		return models.AppKey{}, err
+	}
+
+	return models.AppKey{
+		ID:          kid,
+		AppID:       app.ID,
+		Kind:        kind,
+		Algorithm:   alg,
+		Secret:      keySecret,
+		Status:      models.KeyStatusActive,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+func (a *AuthService) createKey(ctx context.Context, app models.App, kind string, activatesAt time.Time) (models.AppKey, error) {
+	const op = "services.auth.createKey"
+
+	key, err := a.newKey(app, kind, activatesAt)
+	if err != nil {
+		return models.AppKey{}, err
+	}
+
+	if err := a.db.AppDB.CreateAppKey(ctx, key); err != nil {
+		a.log.Error("failed to save key", sl.OpErr(op, err))
+		return models.AppKey{}, err
+	}
+
+	a.log.Info("app key created",
+		slog.String("op", op),
+		slog.Int("app_id", app.ID),
+		slog.String("kind", kind),
+		slog.String("kid", key.ID),
+		slog.Time("activates_at", activatesAt),
+	)
+	return key, nil
+}
+
+// keyAlgorithm returns the algorithm new keys of the kind are created with.
+// Refresh tokens are only ever verified by the SSO itself, so they stay on
+// HMAC.
+func keyAlgorithm(app models.App, kind string) string {
+	if kind == models.KeyKindAccess && jwt.ValidAlgorithm(app.SigningAlg) {
+		return app.SigningAlg
+	}
+
+	return jwt.AlgHS512
+}
+
+// current returns the key that signs tokens of the kind at the given time:
+// the most recently activated active key using the app's algorithm.
+func (r keyRing) current(kind string, now time.Time) (models.AppKey, bool) {
+	alg := keyAlgorithm(r.app, kind)
+
+	for _, key := range r.keys {
+		if key.Kind == kind &&
+			key.Algorithm == alg &&
+			key.Status == models.KeyStatusActive &&
+			!key.ActivatesAt.After(now) {
+			return key, true
+		}
+	}
+
+	return models.AppKey{}, false
+}
+
+func (r keyRing) signingKey(kind string) jwt.Key {
+	key, _ := r.current(kind, time.Now())
+	return toJWTKey(key)
+}
+
+func (r keyRing) verifyKeys(kind string) []jwt.Key {
+	var keys []jwt.Key
+	for _, key := range r.keys {
+		if key.Kind == kind {
+			keys = append(keys, toJWTKey(key))
+		}
+	}
+
+	return keys
+}
+
+func toJWTKey(key models.AppKey) jwt.Key {
+	return jwt.Key{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		Secret:    key.Secret,
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"grpc/internal/domain/models"
+	"net/url"
+	"time"
+)
+
+// Names of the mail templates.
+const (
+	mailVerifyEmail     = "verify_email"
+	mailResetPassword   = "reset_password"
+	mailPasswordChanged = "password_changed"
+)
+
+// mailData is passed to the mail templates. App is the name of the app the
+// mail was asked for, if any. Link and Expires are set for mail with a
+// token.
+type mailData struct {
+	Name    string
+	App     string
+	Link    string
+	Expires string
+}
+
+// renderMail renders the mail template to the user in the templates of the
+// app, zero for none, and the locale.
+func (a *AuthService) renderMail(ctx context.Context, name string, user models.User, appID int, locale string, data mailData) (models.Mail, error) {
+	if appID != 0 {
+		app, err := a.db.AppDB.GetAppByID(ctx, appID)
+		if err != nil {
+			return models.Mail{}, err
+		}
+		data.App = app.Name
+	}
+	data.Name = user.Name
+
+	mail, err := a.mailTemplates.Render(name, appID, locale, data)
+	if err != nil {
+		return models.Mail{}, err
+	}
+	mail.To = user.Email
+
+	return mail, nil
+}
+
+// checkMailApp returns ErrInvalidData if the app mail is asked for,
+// zero for none, does not exist.
+func (a *AuthService) checkMailApp(ctx context.Context, appID int) error {
+	if appID == 0 {
+		return nil
+	}
+	if _, err := a.db.AppDB.GetAppByID(ctx, appID); err != nil {
+		return ErrInvalidData
+	}
+
+	return nil
+}
+
+// tokenLink returns the URL of a page with the token added as the token
+// query parameter.
+func tokenLink(page string, token string) (string, error) {
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+// formatDuration formats a duration for mail text, in whole hours or
+// minutes where possible.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d == time.Minute:
+		return "1 minute"
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"grpc/internal/lib/totp"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	mfaChallengeBytes = 32
+
+	// Recovery codes carry 80 random bits, shown as four groups of four
+	// base32 characters. That is enough to store them as plain SHA-256
+	// hashes, like the other secrets.
+	recoveryCodeBytes = 10
+	recoveryCodeGroup = 4
+)
+
+var (
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFAAlreadyEnrolled = errors.New("mfa already enrolled")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTOTP creates a TOTP secret for the token owner, which the user adds
+// to an authenticator app. It only counts as enrolled once confirmed with
+// ConfirmTOTP; enrolling again before that replaces the secret.
+func (a *AuthService) EnrollTOTP(ctx context.Context, token string, appID int) (models.TOTPEnrollment, error) {
+	const op = "services.auth.EnrollTOTP"
+
+	user, err := a.tokenOwner(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to authenticate user", sl.OpErr(op, err))
+		return models.TOTPEnrollment{}, err
+	}
+
+	totpSecret, err := totp.GenerateSecret()
+	if err != nil {
+		a.log.Error("failed to generate totp secret", sl.OpErr(op, err))
+		return models.TOTPEnrollment{}, err
+	}
+
+	if err := a.db.MFADB.SaveTOTP(ctx, user.ID, totpSecret); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return models.TOTPEnrollment{}, ErrMFAAlreadyEnrolled
+		}
+		a.log.Error("failed to save totp", sl.OpErr(op, err))
+		return models.TOTPEnrollment{}, err
+	}
+
+	a.log.Info("totp enrollment started", slog.String("op", op), slog.Int64("id", user.ID))
+	return models.TOTPEnrollment{
+		Secret: totpSecret,
+		URI:    totp.URI(a.mfa.Issuer, user.Email, totpSecret),
+	}, nil
+}
+
+// ConfirmTOTP enrolls the TOTP authenticator of the token owner with a
+// first code from the app, and returns the recovery codes, each of which
+// can be used once instead of a code. They are shown to the user this
+// one time only.
+func (a *AuthService) ConfirmTOTP(ctx context.Context, token string, appID int, code string) ([]string, error) {
+	const op = "services.auth.ConfirmTOTP"
+
+	user, err := a.tokenOwner(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to authenticate user", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	factor, err := a.db.MFADB.GetTOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			a.log.Error("no totp enrollment", slog.String("op", op), slog.Int64("id", user.ID))
+			return nil, ErrInvalidData
+		}
+		a.log.Error("failed to get totp", sl.OpErr(op, err))
+		return nil, err
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+
+	step, ok := totp.Validate(factor.Secret, code, time.Now(), a.mfa.Skew)
+	if !ok {
+		a.log.Error("invalid totp code", slog.String("op", op), slog.Int64("id", user.ID))
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, a.mfa.RecoveryCodes)
+	hashes := make([]string, a.mfa.RecoveryCodes)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			a.log.Error("failed to generate recovery code", sl.OpErr(op, err))
+			return nil, err
+		}
+		hashes[i] = secret.Hash(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := a.db.MFADB.ConfirmTOTP(ctx, user.ID, step, hashes); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return nil, ErrMFAAlreadyEnrolled
+		}
+		a.log.Error("failed to confirm totp", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("totp enrolled", slog.String("op", op), slog.Int64("id", user.ID))
+	return codes, nil
+}
+
+// VerifyMFA finishes a login that needed a second factor with a code from
+// the authenticator app or a recovery code, and issues the token pair.
+func (a *AuthService) VerifyMFA(ctx context.Context, challengeID string, code string, appID int) (models.TokensPair, error) {
+	const op = "services.auth.VerifyMFA"
+
+	challenge, err := a.passMFAChallenge(ctx, challengeID, code, appID)
+	if err != nil {
+		a.log.Error("failed to pass mfa challenge", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, challenge.AppID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	tokensPair, _, err := a.startSessionTokens(ctx, challenge.UserID, app, challenge.Scope, "")
+	if err != nil {
+		a.log.Error("failed to issue tokens", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Info("user login complete", slog.String("op", op), slog.Int64("id", challenge.UserID))
+	return tokensPair, nil
+}
+
+// tokenOwner returns the owner of an access token for managing their own
+// second factor or passkeys. Service clients and tokens acting for someone
+// else may not.
+func (a *AuthService) tokenOwner(ctx context.Context, token string, appID int) (models.User, error) {
+	const op = "services.auth.tokenOwner"
+
+	decodeToken, err := a.authenticate(ctx, token, appID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if decodeToken.UserID == 0 || decodeToken.Actor != nil {
+		a.log.Error("token does not belong to the user", slog.String("op", op), slog.String("jti", decodeToken.ID))
+		return models.User{}, ErrForbidden
+	}
+
+	user, err := a.db.AuthDB.GetUserByID(ctx, decodeToken.UserID)
+	if err != nil {
+		a.log.Error("failed to get user by id", sl.OpErr(op, err))
+		return models.User{}, ErrUnauthorized
+	}
+
+	return user, nil
+}
+
+// startMFAChallenge returns the id of a new challenge for a login of the
+// user to the app if the user enrolled a second factor, and an empty id
+// otherwise.
+func (a *AuthService) startMFAChallenge(ctx context.Context, userID int64, appID int, scope string) (string, error) {
+	const op = "services.auth.startMFAChallenge"
+
+	factor, err := a.db.MFADB.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if factor.ConfirmedAt == nil {
+		return "", nil
+	}
+
+	challengeID, err := secret.Generate(mfaChallengeBytes)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.MFAChallenge{
+		ChallengeHash: secret.Hash(challengeID),
+		UserID:        userID,
+		AppID:         appID,
+		Scope:         scope,
+		ExpiresAt:     time.Now().Add(a.mfa.ChallengeExpires),
+	}
+	if err := a.db.MFADB.CreateMFAChallenge(ctx, challenge); err != nil {
+		return "", err
+	}
+
+	a.log.Info("mfa challenge started", slog.String("op", op), slog.Int64("id", userID), slog.Int("app_id", appID))
+	return challengeID, nil
+}
+
+// passMFAChallenge answers the challenge of a login to the app with the
+// code and returns it. Unknown, expired and answered challenges, and those
+// with no attempts left, are ErrUnauthorized: the user has to sign in again.
+func (a *AuthService) passMFAChallenge(ctx context.Context, challengeID string, code string, appID int) (models.MFAChallenge, error) {
+	const op = "services.auth.passMFAChallenge"
+
+	challengeHash := secret.Hash(challengeID)
+
+	challenge, err := a.db.MFADB.AttemptMFAChallenge(ctx, challengeHash, a.mfa.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return models.MFAChallenge{}, ErrUnauthorized
+		}
+		return models.MFAChallenge{}, err
+	}
+	if challenge.AppID != appID {
+		a.log.Error("mfa challenge belongs to another app", slog.String("op", op), slog.Int("app_id", appID))
+		return models.MFAChallenge{}, ErrUnauthorized
+	}
+
+	if err := a.verifySecondFactor(ctx, challenge.UserID, code); err != nil {
+		return models.MFAChallenge{}, err
+	}
+
+	if err := a.db.MFADB.ConsumeMFAChallenge(ctx, challengeHash); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return models.MFAChallenge{}, ErrUnauthorized
+		}
+		return models.MFAChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// verifySecondFactor accepts a code of the TOTP authenticator of the user
+// that was not used before, or an unused recovery code.
+func (a *AuthService) verifySecondFactor(ctx context.Context, userID int64, code string) error {
+	const op = "services.auth.verifySecondFactor"
+
+	factor, err := a.db.MFADB.GetTOTP(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to get totp", sl.OpErr(op, err))
+		return err
+	}
+
+	code = strings.Join(strings.Fields(code), "")
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(factor.Secret, code, time.Now(), a.mfa.Skew)
+		if !ok {
+			a.log.Error("invalid totp code", slog.String("op", op), slog.Int64("id", userID))
+			return ErrInvalidMFACode
+		}
+		if err := a.db.MFADB.UseTOTPStep(ctx, userID, step); err != nil {
+			if errors.Is(err, database.ErrConflict) {
+				a.log.Error("totp code replayed", slog.String("op", op), slog.Int64("id", userID))
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := a.db.MFADB.UseRecoveryCode(ctx, userID, secret.Hash(normalizeRecoveryCode(code))); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	a.log.Warn("recovery code used for login", slog.String("op", op), slog.Int64("id", userID))
+	return nil
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+	groups := make([]string, 0, len(code)/recoveryCodeGroup)
+	for i := 0; i < len(code); i += recoveryCodeGroup {
+		groups = append(groups, code[i:i+recoveryCodeGroup])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeRecoveryCode lets the user type a recovery code in any case and
+// with or without the separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	authorizationCodeBytes = 32
+
+	// Code verifier length limits from RFC 7636, section 4.1.
+	minCodeVerifierLen = 43
+	maxCodeVerifierLen = 128
+)
+
+var (
+	ErrInvalidClient      = errors.New("invalid client")
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	ErrInvalidGrant       = errors.New("invalid grant")
+)
+
+// ValidateAuthorization checks the client and redirect URI of an
+// authorization request and that it carries an S256 PKCE challenge. It
+// returns the app the user is asked to sign in to.
+// ErrInvalidClient and ErrInvalidRedirectURI mean the user must not be
+// redirected back to the client; ErrInvalidData means the request itself is
+// invalid and the client may be told so.
+func (a *AuthService) ValidateAuthorization(ctx context.Context, req models.AuthorizationRequest) (models.App, error) {
+	const op = "services.auth.ValidateAuthorization"
+
+	app, err := a.db.AppDB.GetAppByID(ctx, req.AppID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.App{}, ErrInvalidClient
+	}
+
+	uris, err := a.db.AppDB.GetAppRedirectURIs(ctx, req.AppID)
+	if err != nil {
+		a.log.Error("failed to get app redirect uris", sl.OpErr(op, err))
+		return models.App{}, err
+	}
+
+	// Redirect URIs are compared as strings, without any normalization.
+	if !slices.Contains(uris, req.RedirectURI) {
+		a.log.Error("redirect uri is not registered",
+			slog.String("op", op),
+			slog.Int("app_id", req.AppID),
+			slog.String("redirect_uri", req.RedirectURI),
+		)
+		return models.App{}, ErrInvalidRedirectURI
+	}
+
+	if req.CodeChallengeMethod != models.CodeChallengeS256 || req.CodeChallenge == "" {
+		a.log.Error("missing or unsupported code challenge",
+			slog.String("op", op),
+			slog.String("method", req.CodeChallengeMethod),
+		)
+		return models.App{}, ErrInvalidData
+	}
+
+	return app, nil
+}
+
+// AuthorizeUser checks the credentials of the user for an authorization
+// request and returns an authorization code the client exchanges for tokens.
+// If the user enrolled a second factor, it returns the id of an MFA
+// challenge instead, answered with AuthorizeUserMFA.
+func (a *AuthService) AuthorizeUser(ctx context.Context, req models.AuthorizationRequest, email string, password string) (string, string, error) {
+	const op = "services.auth.AuthorizeUser"
+
+	app, err := a.ValidateAuthorization(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+
+	user, err := a.checkCredentials(ctx, email, password)
+	if err != nil {
+		a.log.Error("failed to check credentials", sl.OpErr(op, err))
+		return "", "", err
+	}
+
+	if err := checkEmailVerified(user, app); err != nil {
+		a.log.Info("user email not verified", slog.String("op", op), slog.Int64("id", user.ID), slog.Int("app_id", app.ID))
+		return "", "", err
+	}
+
+	challengeID, err := a.startMFAChallenge(ctx, user.ID, req.AppID, req.Scope)
+	if err != nil {
+		a.log.Error("failed to start mfa challenge", sl.OpErr(op, err))
+		return "", "", err
+	}
+	if challengeID != "" {
+		return "", challengeID, nil
+	}
+
+	code, err := a.issueAuthorizationCode(ctx, req, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return code, "", nil
+}
+
+// AuthorizeUserMFA answers the MFA challenge started by AuthorizeUser and
+// returns the authorization code.
+func (a *AuthService) AuthorizeUserMFA(ctx context.Context, req models.AuthorizationRequest, challengeID string, mfaCode string) (string, error) {
+	const op = "services.auth.AuthorizeUserMFA"
+
+	if _, err := a.ValidateAuthorization(ctx, req); err != nil {
+		return "", err
+	}
+
+	challenge, err := a.passMFAChallenge(ctx, challengeID, mfaCode, req.AppID)
+	if err != nil {
+		a.log.Error("failed to pass mfa challenge", sl.OpErr(op, err))
+		return "", err
+	}
+
+	return a.issueAuthorizationCode(ctx, req, challenge.UserID)
+}
+
+func (a *AuthService) issueAuthorizationCode(ctx context.Context, req models.AuthorizationRequest, userID int64) (string, error) {
+	const op = "services.auth.issueAuthorizationCode"
+
+	code, err := secret.Generate(authorizationCodeBytes)
+	if err != nil {
+		a.log.Error("failed to generate authorization code", sl.OpErr(op, err))
+		return "", err
+	}
+
+	record := models.AuthorizationCode{
+		CodeHash:      secret.Hash(code),
+		AppID:         req.AppID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(a.oauth.CodeExpires),
+	}
+
+	if err := a.db.TokenDB.CreateAuthorizationCode(ctx, record); err != nil {
+		a.log.Error("failed to save authorization code", sl.OpErr(op, err))
+		return "", err
+	}
+
+	a.log.Info("user authorized app", slog.String("op", op), slog.Int64("id", userID), slog.Int("app_id", req.AppID))
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for a token pair. The code can
+// be redeemed once; presenting it again ends the session started with it.
+func (a *AuthService) ExchangeCode(ctx context.Context, appID int, code string, redirectURI string, codeVerifier string) (models.TokensPair, error) {
+	const op = "services.auth.ExchangeCode"
+
+	codeHash := secret.Hash(code)
+
+	record, err := a.db.TokenDB.ConsumeAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return models.TokensPair{}, ErrInvalidGrant
+		}
+		if errors.Is(err, database.ErrConflict) {
+			a.log.Warn("authorization code replayed", slog.String("op", op), slog.Int64("id", record.UserID))
+			if record.SessionID != nil {
+				if err := a.db.SessionDB.EndSession(ctx, *record.SessionID); err != nil {
+					a.log.Error("failed to end session", sl.OpErr(op, err))
+				}
+			}
+			return models.TokensPair{}, ErrInvalidGrant
+		}
+		a.log.Error("failed to consume authorization code", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	if record.AppID != appID || record.RedirectURI != redirectURI || time.Now().After(record.ExpiresAt) {
+		a.log.Error("authorization code does not match the request", slog.String("op", op), slog.Int("app_id", appID))
+		return models.TokensPair{}, ErrInvalidGrant
+	}
+
+	if !verifyCodeChallenge(record.CodeChallenge, codeVerifier) {
+		a.log.Error("code verifier does not match the challenge", slog.String("op", op), slog.Int("app_id", appID))
+		return models.TokensPair{}, ErrInvalidGrant
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidClient
+	}
+
+	tokensPair, sessionID, err := a.startSessionTokens(ctx, record.UserID, app, record.Scope, record.Nonce)
+	if err != nil {
+		a.log.Error("failed to issue tokens", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	if err := a.db.TokenDB.SetAuthorizationCodeSession(ctx, codeHash, sessionID); err != nil {
+		a.log.Error("failed to record authorization code session", sl.OpErr(op, err))
+	}
+
+	a.log.Info("authorization code exchanged", slog.String("op", op), slog.Int64("id", record.UserID), slog.Int("app_id", appID))
+	return tokensPair, nil
+}
+
+// SetRedirectURIs replaces the redirect URIs registered for the app.
+func (a *AuthService) SetRedirectURIs(ctx context.Context, token string, appID int, uris []string) ([]string, error) {
+	const op = "services.auth.SetRedirectURIs"
+
+	caller, err := a.authorize(ctx, token, a.apps.AdminAppID, PermissionManageApps)
+	if err != nil {
+		a.log.Error("failed to authorize user", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	if _, err := a.db.AppDB.GetAppByID(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return nil, ErrInvalidData
+	}
+
+	for _, uri := range uris {
+		if !validRedirectURI(uri, a.oauth.RedirectSchemes) {
+			a.log.Error("invalid redirect uri", slog.String("op", op), slog.String("redirect_uri", uri))
+			return nil, ErrInvalidRedirectURI
+		}
+	}
+
+	uris = slices.Clone(uris)
+	slices.Sort(uris)
+	uris = slices.Compact(uris)
+	if err := a.db.AppDB.SetAppRedirectURIs(ctx, appID, uris); err != nil {
+		a.log.Error("failed to set app redirect uris", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("app redirect uris changed",
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int("count", len(uris)),
+		slog.Int64("changed_by", caller.UserID),
+	)
+	return uris, nil
+}
+
+// verifyCodeChallenge reports whether the verifier matches an S256 code
+// challenge.
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < minCodeVerifierLen || len(verifier) > maxCodeVerifierLen {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validRedirectURI reports whether the URI can be registered as a redirect
+// URI. It must be absolute and have no fragment. Plain http is only allowed
+// for loopback addresses. Other schemes, such as the private-use schemes of
+// native apps, must be listed in schemes.
+func validRedirectURI(uri string, schemes []string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return slices.ContainsFunc(schemes, func(scheme string) bool {
+			return strings.EqualFold(scheme, u.Scheme)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRedirectURI(t *testing.T) {
+	schemes := []string{"com.example.app"}
+
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{uri: "https://example.com/callback", valid: true},
+		{uri: "https://example.com:8443/callback?app=1", valid: true},
+		{uri: "http://localhost:3000/callback", valid: true},
+		{uri: "http://127.0.0.1/callback", valid: true},
+		{uri: "http://[::1]:8080/callback", valid: true},
+		{uri: "com.example.app:/callback", valid: true},
+		{uri: "COM.EXAMPLE.APP:/callback", valid: true},
+
+		{uri: "http://example.com/callback"},
+		{uri: "https:///callback"},
+		{uri: "https://example.com/callback#fragment"},
+		{uri: "/callback"},
+		{uri: "javascript:alert(document.cookie)"},
+		{uri: "data:text/html,<script>alert(1)</script>"},
+		{uri: "file:///etc/passwd"},
+		{uri: "com.example.other:/callback"},
+		{uri: "com.example.app.evil:/callback"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, validRedirectURI(tt.uri, schemes), tt.uri)
+	}
+
+	assert.False(t, validRedirectURI("com.example.app:/callback", nil))
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UserInfo returns the claims about the owner of an access token, like
+// CurrentUser, for the OpenID Connect userinfo endpoint. The app is taken
+// from the token itself.
+func (a *AuthService) UserInfo(ctx context.Context, token string) (models.UserInfo, error) {
+	const op = "services.auth.UserInfo"
+
+	claims, err := jwt.UnverifiedClaims(token)
+	if err != nil || claims.AppID == 0 {
+		a.log.Error("failed to read token claims", sl.OpErr(op, err))
+		return models.UserInfo{}, ErrUnauthorized
+	}
+
+	user, err := a.CurrentUser(ctx, token, claims.AppID)
+	if err != nil {
+		return models.UserInfo{}, err
+	}
+
+	return models.UserInfo{
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+// ProviderJWKS returns the public keys of every app, which together verify
+// all ID tokens issued by the service.
+func (a *AuthService) ProviderJWKS(ctx context.Context) ([]jwt.JWK, error) {
+	const op = "services.auth.ProviderJWKS"
+
+	apps, err := a.db.AppDB.GetApps(ctx)
+	if err != nil {
+		a.log.Error("failed to get apps", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	keys := []jwt.JWK{}
+	for _, app := range apps {
+		appKeys, err := a.JWKS(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, appKeys...)
+	}
+
+	a.log.Info("get provider jwks complete", slog.String("op", op), slog.Int("count", len(keys)))
+	return keys, nil
+}
+
+// idToken returns an ID token for the session if the scope has the openid
+// value, and an empty string otherwise. It is signed with the app's access
+// token key, so apps signing with a shared secret verify it with their
+// secret.
+func (a *AuthService) idToken(ctx context.Context, ring keyRing, userID int64, sessionID string, scope string, nonce string) (string, error) {
+	const op = "services.auth.idToken"
+
+	oidc, _ := splitScope(scope)
+	if !slices.Contains(oidc, models.ScopeOpenID) {
+		return "", nil
+	}
+
+	session, err := a.db.SessionDB.GetSession(ctx, sessionID)
+	if err != nil {
+		a.log.Error("failed to get session", sl.OpErr(op, err))
+		return "", err
+	}
+
+	claims := models.IDToken{
+		Nonce:     nonce,
+		SessionID: sessionID,
+	}
+
+	if slices.Contains(oidc, models.ScopeProfile) || slices.Contains(oidc, models.ScopeEmail) {
+		user, err := a.db.AuthDB.GetUserByID(ctx, userID)
+		if err != nil {
+			a.log.Error("failed to get user by id", sl.OpErr(op, err))
+			return "", err
+		}
+		if slices.Contains(oidc, models.ScopeProfile) {
+			claims.Name = user.Name
+		}
+		if slices.Contains(oidc, models.ScopeEmail) {
+			claims.Email = user.Email
+			claims.EmailVerified = &user.EmailVerified
+		}
+	}
+
+	return jwt.CreateIDToken(claims, userID, session.CreatedAt, a.tokenOptions(ring.app.ID), ring.signingKey(models.KeyKindAccess), a.tokenExpires)
+}
+
+// grantedScope returns the scope reported to the client: the OpenID Connect
+// values it asked for followed by the permissions in the access token.
+func grantedScope(requested string, claims models.Token) string {
+	oidc, _ := splitScope(requested)
+	if claims.Scope != "" {
+		oidc = append(oidc, claims.Scope)
+	}
+
+	return strings.Join(oidc, " ")
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"grpc/internal/lib/webauthn"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const passkeyChallengeBytes = 32
+
+// passkeyTransports are the authenticator transports of WebAuthn Level 3
+// that are stored as hints for later logins, others are dropped.
+var passkeyTransports = []string{"usb", "nfc", "ble", "smart-card", "hybrid", "internal"}
+
+// BeginPasskeyRegistration starts registering a passkey for the token
+// owner and returns the options to pass to navigator.credentials.create.
+func (a *AuthService) BeginPasskeyRegistration(ctx context.Context, token string, appID int) (webauthn.CreationOptions, error) {
+	const op = "services.auth.BeginPasskeyRegistration"
+
+	user, err := a.tokenOwner(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to authenticate user", sl.OpErr(op, err))
+		return webauthn.CreationOptions{}, err
+	}
+
+	passkeys, err := a.db.PasskeyDB.GetUserPasskeys(ctx, user.ID)
+	if err != nil {
+		a.log.Error("failed to get user passkeys", sl.OpErr(op, err))
+		return webauthn.CreationOptions{}, err
+	}
+
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, webauthn.Descriptor(passkey.CredentialID, passkey.Transports))
+	}
+
+	challenge, err := a.startPasskeyChallenge(ctx, models.PasskeyRegistration, &user.ID, appID, "")
+	if err != nil {
+		a.log.Error("failed to start passkey challenge", sl.OpErr(op, err))
+		return webauthn.CreationOptions{}, err
+	}
+
+	userEntity := webauthn.UserEntity{
+		ID:          webauthn.EncodeID(userHandle(user.ID)),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}
+
+	a.log.Info("passkey registration started", slog.String("op", op), slog.Int64("id", user.ID))
+	return a.relyingParty().CreationOptions(challenge, userEntity, exclude, a.webAuthn.Timeout), nil
+}
+
+// FinishPasskeyRegistration verifies the response of the authenticator to
+// the registration options and stores the passkey. It returns the
+// credential id, base64url encoded.
+func (a *AuthService) FinishPasskeyRegistration(ctx context.Context, token string, appID int, clientDataJSON []byte, attestationObject []byte, transports []string, name string) (string, error) {
+	const op = "services.auth.FinishPasskeyRegistration"
+
+	user, err := a.tokenOwner(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to authenticate user", sl.OpErr(op, err))
+		return "", err
+	}
+
+	challenge, err := a.consumePasskeyChallenge(ctx, clientDataJSON, models.PasskeyRegistration)
+	if err != nil {
+		a.log.Error("failed to consume passkey challenge", sl.OpErr(op, err))
+		return "", ErrInvalidData
+	}
+	if challenge.UserID == nil || *challenge.UserID != user.ID || challenge.AppID != appID {
+		a.log.Error("passkey challenge belongs to another user or app", slog.String("op", op), slog.Int64("id", user.ID))
+		return "", ErrInvalidData
+	}
+
+	credential, err := a.relyingParty().VerifyRegistration(clientDataJSON, attestationObject)
+	if err != nil {
+		a.log.Error("failed to verify passkey registration", sl.OpErr(op, err))
+		return "", ErrInvalidData
+	}
+
+	passkey := models.Passkey{
+		CredentialID:   credential.ID,
+		UserID:         user.ID,
+		Name:           name,
+		PublicKey:      credential.PublicKey,
+		Algorithm:      credential.Algorithm,
+		SignCount:      credential.SignCount,
+		AAGUID:         credential.AAGUID,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+		Transports:     []string{},
+	}
+	for _, transport := range transports {
+		if slices.Contains(passkeyTransports, transport) && !slices.Contains(passkey.Transports, transport) {
+			passkey.Transports = append(passkey.Transports, transport)
+		}
+	}
+
+	if err := a.db.PasskeyDB.CreatePasskey(ctx, passkey); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return "", ErrInvalidData
+		}
+		a.log.Error("failed to save passkey", sl.OpErr(op, err))
+		return "", err
+	}
+
+	a.log.Info("passkey registered", slog.String("op", op), slog.Int64("id", user.ID))
+	return webauthn.EncodeID(credential.ID), nil
+}
+
+// BeginPasskeyLogin starts a login to the app with a passkey and returns
+// the options to pass to navigator.credentials.get. The scope narrows the
+// permissions of the access token, as in Login.
+func (a *AuthService) BeginPasskeyLogin(ctx context.Context, appID int, scope string) (webauthn.RequestOptions, error) {
+	const op = "services.auth.BeginPasskeyLogin"
+
+	if _, err := a.db.AppDB.GetAppByID(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return webauthn.RequestOptions{}, ErrInvalidData
+	}
+
+	challenge, err := a.startPasskeyChallenge(ctx, models.PasskeyLogin, nil, appID, scope)
+	if err != nil {
+		a.log.Error("failed to start passkey challenge", sl.OpErr(op, err))
+		return webauthn.RequestOptions{}, err
+	}
+
+	return a.relyingParty().RequestOptions(challenge, a.webAuthn.Timeout), nil
+}
+
+// FinishPasskeyLogin verifies the response of the authenticator to the
+// login options and issues a token pair. Passkeys verify the user on the
+// authenticator, so no second factor is asked for.
+func (a *AuthService) FinishPasskeyLogin(ctx context.Context, appID int, credentialID []byte, clientDataJSON []byte, authenticatorData []byte, signature []byte, handle []byte) (models.TokensPair, error) {
+	const op = "services.auth.FinishPasskeyLogin"
+
+	challenge, err := a.consumePasskeyChallenge(ctx, clientDataJSON, models.PasskeyLogin)
+	if err != nil {
+		a.log.Error("failed to consume passkey challenge", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+	if challenge.AppID != appID {
+		a.log.Error("passkey challenge belongs to another app", slog.String("op", op), slog.Int("app_id", appID))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+
+	passkey, err := a.db.PasskeyDB.GetPasskey(ctx, credentialID)
+	if err != nil {
+		a.log.Error("failed to get passkey", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+	if len(handle) > 0 && !bytes.Equal(handle, userHandle(passkey.UserID)) {
+		a.log.Error("user handle does not match passkey", slog.String("op", op), slog.Int64("id", passkey.UserID))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+
+	assertion, err := a.relyingParty().VerifyAssertion(passkey.PublicKey, passkey.SignCount, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCounterRollback) {
+			a.log.Warn("passkey sign counter went back, it may be cloned", slog.String("op", op), slog.Int64("id", passkey.UserID))
+		}
+		a.log.Error("failed to verify passkey assertion", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+
+	if err := a.db.PasskeyDB.UpdatePasskeyUse(ctx, passkey.CredentialID, assertion.SignCount, assertion.BackedUp); err != nil {
+		a.log.Error("failed to update passkey", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrInvalidData
+	}
+
+	user, err := a.db.AuthDB.GetUserByID(ctx, passkey.UserID)
+	if err != nil {
+		a.log.Error("failed to get user by id", sl.OpErr(op, err))
+		return models.TokensPair{}, ErrUnauthorized
+	}
+
+	if err := checkEmailVerified(user, app); err != nil {
+		a.log.Info("user email not verified", slog.String("op", op), slog.Int64("id", user.ID), slog.Int("app_id", app.ID))
+		return models.TokensPair{}, err
+	}
+
+	tokensPair, _, err := a.startSessionTokens(ctx, passkey.UserID, app, challenge.Scope, "")
+	if err != nil {
+		a.log.Error("failed to issue tokens", sl.OpErr(op, err))
+		return models.TokensPair{}, err
+	}
+
+	a.log.Info("user passkey login complete", slog.String("op", op), slog.Int64("id", passkey.UserID))
+	return tokensPair, nil
+}
+
+func (a *AuthService) relyingParty() webauthn.RelyingParty {
+	return webauthn.RelyingParty{
+		ID:      a.webAuthn.RPID,
+		Name:    a.webAuthn.RPName,
+		Origins: a.webAuthn.Origins,
+	}
+}
+
+// startPasskeyChallenge stores a new challenge and returns it base64url
+// encoded, as it appears in the options and the client data.
+func (a *AuthService) startPasskeyChallenge(ctx context.Context, kind string, userID *int64, appID int, scope string) (string, error) {
+	challenge, err := secret.Generate(passkeyChallengeBytes)
+	if err != nil {
+		return "", err
+	}
+
+	record := models.PasskeyChallenge{
+		ChallengeHash: secret.Hash(challenge),
+		Kind:          kind,
+		UserID:        userID,
+		AppID:         appID,
+		Scope:         scope,
+		ExpiresAt:     time.Now().Add(a.webAuthn.Timeout),
+	}
+	if err := a.db.PasskeyDB.CreatePasskeyChallenge(ctx, record); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// consumePasskeyChallenge uses up the challenge the client data was
+// signed for, so that every response is accepted once.
+func (a *AuthService) consumePasskeyChallenge(ctx context.Context, clientDataJSON []byte, kind string) (models.PasskeyChallenge, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return models.PasskeyChallenge{}, err
+	}
+
+	return a.db.PasskeyDB.ConsumePasskeyChallenge(ctx, secret.Hash(clientData.Challenge), kind)
+}
+
+// userHandle is the WebAuthn user handle of the user, the user id as eight
+// big-endian bytes.
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"grpc/internal/lib/password"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var breachedPasswordChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sso",
+	Name:      "breached_password_checks_total",
+	Help:      "New passwords checked against the breached passwords list, by result.",
+}, []string{"result"})
+
+// checkNewPassword checks a password a user chose against the password
+// policy and, when configured, the breached passwords list. The broken
+// rules are returned as a *PasswordPolicyError.
+func (a *AuthService) checkNewPassword(newPassword string, email string, name string) error {
+	violations := a.passwordPolicy.Check(newPassword, email, name)
+
+	if a.breachedPasswords != nil {
+		if a.breachedPasswords.Contains(newPassword) {
+			breachedPasswordChecks.WithLabelValues("breached").Inc()
+			violations = append(violations, password.Violation{
+				Rule:        password.RuleBreached,
+				Description: "password appears in a known data breach",
+			})
+		} else {
+			breachedPasswordChecks.WithLabelValues("clean").Inc()
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"time"
+)
+
+const passwordResetTokenBytes = 32
+
+// RequestPasswordReset mails a link to set a new password to the user with
+// the email. It succeeds for unknown addresses and when a link was sent
+// within the resend interval too, so that it does not tell which
+// addresses are registered. The mails about the reset use the templates of
+// the app, zero for none, and the locale.
+func (a *AuthService) RequestPasswordReset(ctx context.Context, email string, appID int, locale string) error {
+	const op = "services.auth.RequestPasswordReset"
+
+	if err := a.checkMailApp(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return err
+	}
+
+	user, err := a.db.AuthDB.GetUserByEmail(ctx, email)
+	if err != nil {
+		a.log.Info("password reset for unknown email", slog.String("op", op), slog.String("email", email))
+		return nil
+	}
+
+	token, err := secret.Generate(passwordResetTokenBytes)
+	if err != nil {
+		a.log.Error("failed to generate password reset token", sl.OpErr(op, err))
+		return nil
+	}
+
+	link, err := tokenLink(a.passwordReset.URL, token)
+	if err != nil {
+		a.log.Error("failed to build password reset link", sl.OpErr(op, err))
+		return nil
+	}
+
+	mail, err := a.renderMail(ctx, mailResetPassword, user, appID, locale, mailData{
+		Link:    link,
+		Expires: formatDuration(a.passwordReset.TokenExpires),
+	})
+	if err != nil {
+		a.log.Error("failed to render password reset mail", sl.OpErr(op, err))
+		return nil
+	}
+
+	record := models.PasswordResetToken{
+		TokenHash: secret.Hash(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		AppID:     appID,
+		Locale:    locale,
+		ExpiresAt: time.Now().Add(a.passwordReset.TokenExpires),
+	}
+	if err := a.db.AuthDB.CreatePasswordResetToken(ctx, record, a.passwordReset.ResendInterval, mail); err != nil {
+		if !errors.Is(err, database.ErrConflict) {
+			a.log.Error("failed to save password reset token", sl.OpErr(op, err))
+		}
+		return nil
+	}
+
+	a.log.Info("password reset mail queued", slog.String("op", op), slog.Int64("id", user.ID))
+	return nil
+}
+
+// ResetPassword sets a new password for the user the reset token was sent
+// to. The password must meet the password policy. Tokens are used once,
+// and every session and impersonation token of the user is ended together
+// with the change, so that whoever knew the old password is signed out.
+// The user is told by mail, in the templates the reset was asked for with.
+func (a *AuthService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	const op = "services.auth.ResetPassword"
+
+	tokenHash := secret.Hash(token)
+
+	record, err := a.db.AuthDB.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to get password reset token", sl.OpErr(op, err))
+		return err
+	}
+
+	user, err := a.db.AuthDB.GetUserByID(ctx, record.UserID)
+	if err != nil {
+		a.log.Error("failed to get user by id", sl.OpErr(op, err))
+		return ErrInvalidData
+	}
+
+	if err := a.checkNewPassword(newPassword, user.Email, user.Name); err != nil {
+		a.log.Info("password rejected", slog.String("op", op), slog.Int64("id", user.ID))
+		return err
+	}
+
+	passHash, err := a.passwords.Hash(newPassword)
+	if err != nil {
+		a.log.Error("failed generate hash password", sl.OpErr(op, err))
+		return err
+	}
+
+	notice, err := a.renderMail(ctx, mailPasswordChanged, user, record.AppID, record.Locale, mailData{})
+	if err != nil {
+		a.log.Error("failed to render password changed mail", sl.OpErr(op, err))
+		return err
+	}
+
+	if _, err := a.db.AuthDB.ResetPassword(ctx, tokenHash, passHash, a.jwtConfig.ImpersonationExpires, notice); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to reset password", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("password reset complete", slog.String("op", op), slog.Int64("id", user.ID))
+	return nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"time"
+)
+
+const EventRefreshTokenReuse = "refresh_token_reuse"
+
+func (a *AuthService) refreshTokenRecord(token string, familyID string, userID int64, appID int, scope string) models.RefreshToken {
+	return models.RefreshToken{
+		TokenHash: secret.Hash(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		AppID:     appID,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(a.refreshTokenExpires),
+	}
+}
+
+// refreshTokenReused handles a refresh token presented after it was already
+// exchanged. Either the client or an attacker holds a stolen copy, and
+// there is no telling which, so the session and with it the whole family is
+// revoked.
+func (a *AuthService) refreshTokenReused(ctx context.Context, stored models.RefreshToken) {
+	const op = "services.auth.refreshTokenReused"
+
+	a.securityEvent(ctx, op, EventRefreshTokenReuse,
+		slog.Int64("user_id", stored.UserID),
+		slog.Int("app_id", stored.AppID),
+		slog.String("family_id", stored.FamilyID),
+	)
+
+	if err := a.db.SessionDB.EndSession(ctx, stored.FamilyID); err != nil {
+		a.log.Error("failed to revoke refresh token family", sl.OpErr(op, err), slog.String("family_id", stored.FamilyID))
+	}
+}
+
+// securityEvent records an event that needs the attention of an operator.
+func (a *AuthService) securityEvent(ctx context.Context, op string, event string, attrs ...slog.Attr) {
+	attrs = append([]slog.Attr{slog.String("op", op), slog.String("event", event)}, attrs...)
+	a.log.LogAttrs(ctx, slog.LevelWarn, "security event", attrs...)
+}
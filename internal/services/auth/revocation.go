@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+)
+
+// RevokeToken revokes an access token of the app before it expires. The
+// caller, identified by token, must own the revoked token or have the
+// tokens:revoke permission in the app. Service clients may only revoke
+// their own tokens, and tokens with an actor may revoke none.
+func (a *AuthService) RevokeToken(ctx context.Context, token string, appID int, revokeToken string) error {
+	const op = "services.auth.RevokeToken"
+
+	caller, err := a.authenticate(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to authenticate user", sl.OpErr(op, err))
+		return err
+	}
+	if caller.Actor != nil {
+		a.log.Error("delegated token cannot revoke tokens", slog.String("op", op), slog.Int64("id", caller.UserID))
+		return ErrForbidden
+	}
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return err
+	}
+
+	revoked, err := jwt.DecodeToken(revokeToken, a.tokenOptions(app.ID), ring.verifyKeys(models.KeyKindAccess)...)
+	if err != nil {
+		a.log.Error("failed to decode revoked token", sl.OpErr(op, err))
+		return ErrInvalidData
+	}
+	if revoked.ID == "" || revoked.ExpiresAt == nil {
+		a.log.Error("revoked token has no id", slog.String("op", op), slog.Int64("id", revoked.UserID))
+		return ErrInvalidData
+	}
+
+	if !ownsToken(caller, revoked) {
+		allowed := false
+		if caller.ClientID == "" {
+			allowed, err = a.hasPermission(ctx, caller.UserID, appID, PermissionRevokeTokens)
+			if err != nil {
+				a.log.Error("failed to check permission", sl.OpErr(op, err))
+				return err
+			}
+		}
+		if !allowed {
+			a.log.Error("caller may not revoke the token",
+				slog.String("op", op),
+				slog.Int64("id", caller.UserID),
+				slog.String("client_id", caller.ClientID),
+				slog.Int64("owner_id", revoked.UserID),
+				slog.String("owner_client_id", revoked.ClientID),
+			)
+			return ErrForbidden
+		}
+	}
+
+	entry := models.RevokedToken{
+		TokenID:         revoked.ID,
+		UserID:          revoked.UserID,
+		ClientID:        revoked.ClientID,
+		AppID:           app.ID,
+		RevokedBy:       caller.UserID,
+		RevokedByClient: caller.ClientID,
+		ExpiresAt:       revoked.ExpiresAt.Time,
+	}
+	if err := a.db.TokenDB.RevokeAccessToken(ctx, entry); err != nil {
+		a.log.Error("failed to revoke access token", sl.OpErr(op, err))
+		return err
+	}
+	a.revokedTokens.Set(entry.TokenID, entry.ExpiresAt)
+
+	a.log.Info("access token revoked",
+		slog.String("op", op),
+		slog.String("jti", entry.TokenID),
+		slog.Int64("id", entry.UserID),
+		slog.String("client_id", entry.ClientID),
+		slog.Int64("revoked_by", caller.UserID),
+		slog.String("revoked_by_client", caller.ClientID),
+	)
+	return nil
+}
+
+// ownsToken reports whether the token was issued to the caller: to the same
+// service client, or to the same user if neither is a client token.
+func ownsToken(caller models.Token, token models.Token) bool {
+	if caller.ClientID != "" || token.ClientID != "" {
+		return caller.ClientID == token.ClientID
+	}
+
+	return caller.UserID == token.UserID
+}
+
+// tokenRevoked reports whether the access token with the id is on the
+// revocation list. Revoked tokens are cached until they expire, tokens that
+// are not revoked are always looked up, since another instance may have
+// revoked them.
+func (a *AuthService) tokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" || a.revokedTokens.Has(tokenID) {
+		return tokenID != "", nil
+	}
+
+	stored, err := a.db.TokenDB.GetRevokedToken(ctx, tokenID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	a.revokedTokens.Set(stored.TokenID, stored.ExpiresAt)
+	return true, nil
+}
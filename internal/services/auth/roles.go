@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"slices"
+)
+
+const (
+	// PermissionManageRoles allows assigning roles to and taking them from
+	// users of the app.
+	PermissionManageRoles = "roles:manage"
+
+	// PermissionRevokeTokens allows revoking tokens of other users.
+	PermissionRevokeTokens = "tokens:revoke"
+)
+
+// IsAdmin reports whether the user has the built-in admin role in the app.
+// It is kept for clients that predate roles.
+func (a *AuthService) IsAdmin(ctx context.Context, userID int64, appID int) (bool, error) {
+	const op = "services.auth.IsAdmin"
+
+	roles, err := a.db.RoleDB.GetUserRoles(ctx, userID, appID)
+	if err != nil {
+		a.log.Error("failed to get user roles", sl.OpErr(op, err))
+		return false, err
+	}
+
+	isAdmin := false
+	for _, role := range roles {
+		if role.Name == models.RoleAdmin {
+			isAdmin = true
+			break
+		}
+	}
+
+	a.log.Info("user is admin",
+		slog.String("op", op),
+		slog.Int64("id", userID),
+		slog.Int("app_id", appID),
+		slog.Bool("is_admin", isAdmin),
+	)
+	return isAdmin, nil
+}
+
+// CheckPermission reports whether any role of the user in the app grants
+// the permission. The caller, identified by token, may ask about themselves
+// or, with the roles:manage permission, about any user of the app.
+func (a *AuthService) CheckPermission(ctx context.Context, token string, userID int64, appID int, permission string) (bool, error) {
+	const op = "services.auth.CheckPermission"
+
+	if err := a.authorizeRoleLookup(ctx, token, userID, appID); err != nil {
+		a.log.Error("failed to authorize permission check", sl.OpErr(op, err))
+		return false, err
+	}
+
+	allowed, err := a.hasPermission(ctx, userID, appID, permission)
+	if err != nil {
+		a.log.Error("failed to check permission", sl.OpErr(op, err))
+		return false, err
+	}
+
+	a.log.Info("user permission checked",
+		slog.String("op", op),
+		slog.Int64("id", userID),
+		slog.Int("app_id", appID),
+		slog.String("permission", permission),
+		slog.Bool("allowed", allowed),
+	)
+	return allowed, nil
+}
+
+// ListUserRoles returns the roles of the user in the app. The caller,
+// identified by token, may list their own roles or, with the roles:manage
+// permission, those of any user of the app.
+func (a *AuthService) ListUserRoles(ctx context.Context, token string, userID int64, appID int) ([]models.Role, error) {
+	const op = "services.auth.ListUserRoles"
+
+	if err := a.authorizeRoleLookup(ctx, token, userID, appID); err != nil {
+		a.log.Error("failed to authorize role listing", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	roles, err := a.db.RoleDB.GetUserRoles(ctx, userID, appID)
+	if err != nil {
+		a.log.Error("failed to get user roles", sl.OpErr(op, err))
+		return nil, err
+	}
+
+	a.log.Info("user roles listed", slog.String("op", op), slog.Int64("id", userID), slog.Int("app_id", appID))
+	return roles, nil
+}
+
+// authorizeRoleLookup authenticates the caller and lets them read the roles
+// of the user if it is themselves or if they may manage roles of the app.
+func (a *AuthService) authorizeRoleLookup(ctx context.Context, token string, userID int64, appID int) error {
+	caller, err := a.authenticateUser(ctx, token, appID)
+	if err != nil {
+		return err
+	}
+	if caller.UserID == userID {
+		return nil
+	}
+
+	return a.requirePermission(ctx, caller, appID, PermissionManageRoles)
+}
+
+// AssignRole gives the user the role of the app. The caller, identified by
+// token, needs the roles:manage permission.
+func (a *AuthService) AssignRole(ctx context.Context, token string, appID int, userID int64, roleName string) error {
+	const op = "services.auth.AssignRole"
+
+	caller, role, err := a.manageRole(ctx, token, appID, userID, roleName)
+	if err != nil {
+		a.log.Error("failed to prepare role assignment", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := a.db.RoleDB.AssignRole(ctx, userID, role.ID); err != nil {
+		a.log.Error("failed to assign role", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("role assigned",
+		slog.String("op", op),
+		slog.Int64("id", userID),
+		slog.String("role", role.Name),
+		slog.Int64("assigned_by", caller.UserID),
+	)
+	return nil
+}
+
+// UnassignRole takes the role of the app from the user. The caller,
+// identified by token, needs the roles:manage permission.
+func (a *AuthService) UnassignRole(ctx context.Context, token string, appID int, userID int64, roleName string) error {
+	const op = "services.auth.UnassignRole"
+
+	caller, role, err := a.manageRole(ctx, token, appID, userID, roleName)
+	if err != nil {
+		a.log.Error("failed to prepare role unassignment", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := a.db.RoleDB.UnassignRole(ctx, userID, role.ID); err != nil {
+		a.log.Error("failed to unassign role", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("role unassigned",
+		slog.String("op", op),
+		slog.Int64("id", userID),
+		slog.String("role", role.Name),
+		slog.Int64("unassigned_by", caller.UserID),
+	)
+	return nil
+}
+
+// manageRole authorizes a change of the user's roles and looks up the user
+// and the role. The caller must hold every permission of the role, so that
+// roles:manage cannot hand out more than the caller has, admin included.
+func (a *AuthService) manageRole(ctx context.Context, token string, appID int, userID int64, roleName string) (models.Token, models.Role, error) {
+	const op = "services.auth.manageRole"
+
+	caller, err := a.authorize(ctx, token, appID, PermissionManageRoles)
+	if err != nil {
+		return models.Token{}, models.Role{}, err
+	}
+
+	if _, err := a.db.AuthDB.GetUserByID(ctx, userID); err != nil {
+		return models.Token{}, models.Role{}, ErrInvalidData
+	}
+
+	role, err := a.db.RoleDB.GetRole(ctx, appID, roleName)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return models.Token{}, models.Role{}, ErrInvalidData
+		}
+		return models.Token{}, models.Role{}, err
+	}
+
+	callerRoles, err := a.db.RoleDB.GetUserRoles(ctx, caller.UserID, appID)
+	if err != nil {
+		return models.Token{}, models.Role{}, err
+	}
+	if !grantsAll(callerRoles, []models.Role{role}) {
+		a.log.Error("role grants permissions the caller lacks",
+			slog.String("op", op),
+			slog.Int64("id", caller.UserID),
+			slog.String("role", role.Name),
+		)
+		return models.Token{}, models.Role{}, ErrForbidden
+	}
+
+	return caller, role, nil
+}
+
+// authorize authenticates the access token of a user and checks that the
+// user has the permission in the app.
+func (a *AuthService) authorize(ctx context.Context, token string, appID int, permission string) (models.Token, error) {
+	caller, err := a.authenticateUser(ctx, token, appID)
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	if err := a.requirePermission(ctx, caller, appID, permission); err != nil {
+		return models.Token{}, err
+	}
+
+	return caller, nil
+}
+
+// requirePermission checks that the caller has the permission in the app.
+// Exchanged and impersonation tokens are refused: the permission is checked
+// against the roles of the user, not against the narrower scope of the token
+// or the rights of whoever acts for the user.
+func (a *AuthService) requirePermission(ctx context.Context, caller models.Token, appID int, permission string) error {
+	const op = "services.auth.requirePermission"
+
+	if caller.Actor != nil {
+		a.log.Error("delegated token cannot be authorized", slog.String("op", op), slog.Int64("id", caller.UserID))
+		return ErrForbidden
+	}
+
+	allowed, err := a.hasPermission(ctx, caller.UserID, appID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		a.log.Error("permission denied",
+			slog.String("op", op),
+			slog.Int64("id", caller.UserID),
+			slog.String("permission", permission),
+		)
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func (a *AuthService) hasPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error) {
+	roles, err := a.db.RoleDB.GetUserRoles(ctx, userID, appID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role.Grants(permission) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// grantsAll reports whether the roles together grant every permission of
+// the other roles.
+func grantsAll(roles []models.Role, other []models.Role) bool {
+	for _, role := range other {
+		for _, permission := range role.Permissions {
+			if !slices.ContainsFunc(roles, func(held models.Role) bool { return held.Grants(permission) }) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+// RotateKeys brings the key rings of all apps up to date. Apps without a
+// current signing key get one right away. A new signing key is published
+// Prepublish ahead of its activation once the current key is Interval old,
+// superseded keys are demoted to verifying-only and keys that can no longer
+// have tokens in circulation are retired.
+func (a *AuthService) RotateKeys(ctx context.Context) error {
+	const op = "services.auth.RotateKeys"
+
+	apps, err := a.db.AppDB.GetApps(ctx)
+	if err != nil {
+		a.log.Error("failed to get apps", sl.OpErr(op, err))
+		return err
+	}
+
+	var errs []error
+	for _, app := range apps {
+		if err := a.rotateAppKeys(ctx, app, time.Now()); err != nil {
+			a.log.Error("failed to rotate app keys", sl.OpErr(op, err), slog.Int("app_id", app.ID))
+			errs = append(errs, err)
+		}
+	}
+
+	a.log.Info("key rotation complete", slog.String("op", op), slog.Int("apps", len(apps)))
+	return errors.Join(errs...)
+}
+
+func (a *AuthService) rotateAppKeys(ctx context.Context, app models.App, now time.Time) error {
+	const op = "services.auth.rotateAppKeys"
+
+	ring, err := a.loadKeyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return err
+	}
+
+	for _, kind := range []string{models.KeyKindAccess, models.KeyKindRefresh} {
+		current, ok := ring.current(kind, now)
+		if !ok {
+			if current, err = a.createKey(ctx, app, kind, now); err != nil {
+				return err
+			}
+			ring.keys = append([]models.AppKey{current}, ring.keys...)
+		}
+
+		if a.keyRotation.Interval > 0 &&
+			!ring.hasPending(kind, now) &&
+			!current.ActivatesAt.Add(a.keyRotation.Interval).After(now.Add(a.keyRotation.Prepublish)) {
+			if _, err := a.createKey(ctx, app, kind, now.Add(a.keyRotation.Prepublish)); err != nil {
+				return err
+			}
+		}
+
+		if err := a.expireKeys(ctx, ring, kind, current, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expireKeys demotes active keys superseded by current and retires
+// verifying keys whose tokens have all expired.
+func (a *AuthService) expireKeys(ctx context.Context, ring keyRing, kind string, current models.AppKey, now time.Time) error {
+	lifetime := a.tokenExpires
+	if kind == models.KeyKindRefresh {
+		lifetime = a.refreshTokenExpires
+	}
+
+	for _, key := range ring.keys {
+		if key.Kind != kind || key.ID == current.ID {
+			continue
+		}
+
+		var status string
+		switch {
+		case key.Status == models.KeyStatusActive && !key.ActivatesAt.After(now):
+			status = models.KeyStatusVerifying
+		case key.Status == models.KeyStatusVerifying &&
+			key.DeactivatedAt != nil &&
+			key.DeactivatedAt.Add(lifetime).Before(now):
+			status = models.KeyStatusRetired
+		default:
+			continue
+		}
+
+		if err := a.db.AppDB.UpdateAppKeyStatus(ctx, key.ID, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasPending reports whether a key of the kind is published but not active
+// yet.
+func (r keyRing) hasPending(kind string, now time.Time) bool {
+	alg := keyAlgorithm(r.app, kind)
+
+	for _, key := range r.keys {
+		if key.Kind == kind &&
+			key.Algorithm == alg &&
+			key.Status == models.KeyStatusActive &&
+			key.ActivatesAt.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
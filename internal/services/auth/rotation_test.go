@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"grpc/internal/config"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAppDB keeps the keys of apps in memory. Methods the key ring does not
+// use are left to the nil AppDB and panic.
+type fakeAppDB struct {
+	AppDB
+
+	mu   sync.Mutex
+	apps []models.App
+	keys []models.AppKey
+}
+
+func (f *fakeAppDB) GetApps(ctx context.Context) ([]models.App, error) {
+	return f.apps, nil
+}
+
+func (f *fakeAppDB) GetAppKeys(ctx context.Context, appID int) ([]models.AppKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []models.AppKey
+	for _, key := range f.keys {
+		if key.AppID == appID && key.Status != models.KeyStatusRetired {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortStableFunc(keys, func(a, b models.AppKey) int {
+		return b.ActivatesAt.Compare(a.ActivatesAt)
+	})
+
+	return keys, nil
+}
+
+func (f *fakeAppDB) CreateAppKey(ctx context.Context, key models.AppKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys = append(f.keys, key)
+	return nil
+}
+
+func (f *fakeAppDB) UpdateAppKeyStatus(ctx context.Context, keyID string, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, key := range f.keys {
+		if key.ID == keyID {
+			now := time.Now()
+			f.keys[i].Status = status
+			f.keys[i].DeactivatedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeAppDB) key(t *testing.T, kid string) models.AppKey {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range f.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	t.Fatalf("no key %q", kid)
+	return models.AppKey{}
+}
+
+// seedKeys adds the keys of a new app to db.
+func seedKeys(t *testing.T, a *AuthService, db *fakeAppDB) keyRing {
+	t.Helper()
+
+	keys, err := a.newKeys(testApp)
+	require.NoError(t, err)
+	db.keys = append(db.keys, keys...)
+
+	return keyRing{app: testApp, keys: keys}
+}
+
+func newKeyTestService(db *fakeAppDB) *AuthService {
+	return &AuthService{
+		log:                 slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db:                  DB{AppDB: db},
+		tokenExpires:        time.Hour,
+		refreshTokenExpires: 24 * time.Hour,
+		keyRotation: config.KeyRotationConfig{
+			Interval:   30 * 24 * time.Hour,
+			Prepublish: 24 * time.Hour,
+		},
+	}
+}
+
+var testApp = models.App{ID: 1, Name: "test", SigningAlg: jwt.AlgES256}
+
+func TestKeyRingNeverCreatesKeys(t *testing.T) {
+	db := &fakeAppDB{apps: []models.App{testApp}}
+	a := newKeyTestService(db)
+	ctx := context.Background()
+
+	_, err := a.keyRing(ctx, testApp)
+	require.ErrorIs(t, err, errNoSigningKey)
+	assert.Empty(t, db.keys)
+
+	require.NoError(t, a.RotateKeys(ctx))
+	require.Len(t, db.keys, 2)
+
+	ring, err := a.keyRing(ctx, testApp)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.AlgES256, ring.signingKey(models.KeyKindAccess).Algorithm)
+	assert.Equal(t, jwt.AlgHS512, ring.signingKey(models.KeyKindRefresh).Algorithm)
+
+	// Concurrent first requests only read the ring.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = a.keyRing(ctx, testApp)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, db.keys, 2)
+}
+
+func TestRotateKeys(t *testing.T) {
+	db := &fakeAppDB{apps: []models.App{testApp}}
+	a := newKeyTestService(db)
+	ctx := context.Background()
+
+	ring := seedKeys(t, a, db)
+	old := ring.signingKey(models.KeyKindAccess)
+
+	// A young key is left alone.
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, time.Now()))
+	require.Len(t, db.keys, 2)
+
+	// Once the key is almost Interval old, its successor is published
+	// Prepublish ahead of its activation.
+	now := time.Now().Add(a.keyRotation.Interval - a.keyRotation.Prepublish)
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, now))
+	require.Len(t, db.keys, 4)
+
+	ring, err := a.loadKeyRing(ctx, testApp)
+	require.NoError(t, err)
+	assert.True(t, ring.hasPending(models.KeyKindAccess, now))
+	current, _ := ring.current(models.KeyKindAccess, now)
+	assert.Equal(t, old.ID, current.ID)
+
+	// The next run does not publish another one.
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, now))
+	require.Len(t, db.keys, 4)
+
+	// After the activation the old key is demoted to verifying.
+	later := now.Add(a.keyRotation.Prepublish + time.Minute)
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, later))
+
+	ring, err = a.loadKeyRing(ctx, testApp)
+	require.NoError(t, err)
+	current, _ = ring.current(models.KeyKindAccess, later)
+	assert.NotEqual(t, old.ID, current.ID)
+	assert.Equal(t, models.KeyStatusVerifying, db.key(t, old.ID).Status)
+}
+
+func TestRotateKeysRetiresExpiredKeys(t *testing.T) {
+	db := &fakeAppDB{apps: []models.App{testApp}}
+	a := newKeyTestService(db)
+	ctx := context.Background()
+
+	ring := seedKeys(t, a, db)
+	old := ring.signingKey(models.KeyKindAccess)
+
+	// A newer key supersedes the old one.
+	_, err := a.createKey(ctx, testApp, models.KeyKindAccess, time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	now := time.Now().Add(2 * time.Second)
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, now))
+	assert.Equal(t, models.KeyStatusVerifying, db.key(t, old.ID).Status)
+
+	// Tokens signed with it may still be in circulation.
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, now.Add(a.tokenExpires/2)))
+	assert.Equal(t, models.KeyStatusVerifying, db.key(t, old.ID).Status)
+
+	// Once they have all expired it is retired and leaves the ring.
+	require.NoError(t, a.rotateAppKeys(ctx, testApp, now.Add(a.tokenExpires+time.Minute)))
+	assert.Equal(t, models.KeyStatusRetired, db.key(t, old.ID).Status)
+
+	ring, err = a.loadKeyRing(ctx, testApp)
+	require.NoError(t, err)
+	for _, key := range ring.verifyKeys(models.KeyKindAccess) {
+		assert.NotEqual(t, old.ID, key.ID)
+	}
+}
+
+func TestDecodeTokenByKid(t *testing.T) {
+	db := &fakeAppDB{apps: []models.App{testApp}}
+	a := newKeyTestService(db)
+	ctx := context.Background()
+
+	ring := seedKeys(t, a, db)
+
+	opts := jwt.Options{Issuer: "test", Audience: jwt.Audience(testApp.ID)}
+	oldToken, err := jwt.CreateToken(models.Token{UserID: 1}, opts, ring.signingKey(models.KeyKindAccess), time.Hour)
+	require.NoError(t, err)
+
+	_, err = a.createKey(ctx, testApp, models.KeyKindAccess, time.Now())
+	require.NoError(t, err)
+	ring, err = a.keyRing(ctx, testApp)
+	require.NoError(t, err)
+
+	newToken, err := jwt.CreateToken(models.Token{UserID: 2}, opts, ring.signingKey(models.KeyKindAccess), time.Hour)
+	require.NoError(t, err)
+
+	// Both tokens are verified with the key named by their kid.
+	claims, err := jwt.DecodeToken(oldToken, opts, ring.verifyKeys(models.KeyKindAccess)...)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, claims.UserID)
+
+	claims, err = jwt.DecodeToken(newToken, opts, ring.verifyKeys(models.KeyKindAccess)...)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, claims.UserID)
+
+	// A kid of another key is not accepted, even with the same algorithm.
+	other, err := a.createKey(ctx, models.App{ID: 2, SigningAlg: jwt.AlgES256}, models.KeyKindAccess, time.Now())
+	require.NoError(t, err)
+	_, err = jwt.DecodeToken(newToken, opts, toJWTKey(other))
+	require.ErrorIs(t, err, jwt.ErrUnknownKey)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// grantClaims returns the claims of an access token for the user's session
+// with the roles and permissions the user has in the app. An empty scope
+// grants every permission of the roles. Otherwise the token gets the
+// requested permissions the roles grant and the roles granting them. Roles
+// and permissions are left out, and RolesOmitted is set, when together they
+// exceed the configured size.
+func (a *AuthService) grantClaims(ctx context.Context, userID int64, appID int, sessionID string, scope string) (models.Token, error) {
+	const op = "services.auth.grantClaims"
+
+	roles, err := a.db.RoleDB.GetUserRoles(ctx, userID, appID)
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	var names, permissions []string
+	_, requested := splitScope(scope)
+	for _, role := range roles {
+		if len(requested) == 0 {
+			names = append(names, role.Name)
+			permissions = append(permissions, role.Permissions...)
+			continue
+		}
+
+		granted := false
+		for _, permission := range requested {
+			if role.Grants(permission) {
+				permissions = append(permissions, permission)
+				granted = true
+			}
+		}
+		if granted {
+			names = append(names, role.Name)
+		}
+	}
+
+	slices.Sort(permissions)
+	permissions = slices.Compact(permissions)
+
+	claims := sessionClaims(userID, appID, sessionID)
+	claims.Roles = names
+	claims.Scope = strings.Join(permissions, " ")
+
+	if limit := a.jwtConfig.MaxScopeSize; limit > 0 && len(strings.Join(names, " "))+len(claims.Scope) > limit {
+		a.log.Warn("roles do not fit into the token",
+			slog.String("op", op),
+			slog.Int64("id", userID),
+			slog.Int("app_id", appID),
+			slog.Int("roles", len(names)),
+			slog.Int("permissions", len(permissions)),
+		)
+		claims.Roles = nil
+		claims.Scope = ""
+		claims.RolesOmitted = true
+	}
+
+	return claims, nil
+}
+
+// narrowScope returns the scope requested on refresh. It may only narrow
+// the scope granted at login, where no permissions stand for every
+// permission. A request naming no permissions keeps those granted, so that
+// it cannot widen a scope holding permissions to all of them.
+func narrowScope(granted string, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	}
+
+	grantedOIDC, grantedPermissions := splitScope(granted)
+	requestedOIDC, requestedPermissions := splitScope(requested)
+	for _, value := range requestedOIDC {
+		if !slices.Contains(grantedOIDC, value) {
+			return "", ErrInvalidData
+		}
+	}
+
+	if len(requestedPermissions) == 0 {
+		requestedPermissions = grantedPermissions
+	}
+	if len(grantedPermissions) > 0 {
+		for _, permission := range requestedPermissions {
+			if !slices.Contains(grantedPermissions, permission) {
+				return "", ErrInvalidData
+			}
+		}
+	}
+
+	return strings.Join(append(requestedOIDC, requestedPermissions...), " "), nil
+}
+
+// splitScope splits a scope into its OpenID Connect values and the
+// permissions.
+func splitScope(scope string) (oidc []string, permissions []string) {
+	for _, value := range strings.Fields(scope) {
+		switch value {
+		case models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail:
+			oidc = append(oidc, value)
+		default:
+			permissions = append(permissions, value)
+		}
+	}
+
+	return oidc, permissions
+}
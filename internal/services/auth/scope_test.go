@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNarrowScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		granted   string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{name: "kept", granted: "openid billing:read", requested: "", want: "openid billing:read"},
+		{name: "same", granted: "openid billing:read", requested: "openid billing:read", want: "openid billing:read"},
+		{name: "oidc only keeps permissions", granted: "openid billing:read", requested: "openid", want: "openid billing:read"},
+		{name: "drops oidc", granted: "openid profile billing:read", requested: "billing:read", want: "billing:read"},
+		{name: "narrows permissions", granted: "billing:read billing:write", requested: "billing:read", want: "billing:read"},
+		{name: "narrows every permission", granted: "openid", requested: "openid billing:read", want: "openid billing:read"},
+		{name: "every permission kept", granted: "openid", requested: "openid", want: "openid"},
+		{name: "new permission", granted: "billing:read", requested: "billing:write", wantErr: true},
+		{name: "new oidc value", granted: "billing:read", requested: "openid", wantErr: true},
+		{name: "wider", granted: "billing:read", requested: "billing:read billing:write", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := narrowScope(tt.granted, tt.requested)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidData)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
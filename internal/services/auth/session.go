@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/clientinfo"
+	"grpc/internal/lib/jwt"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+)
+
+// Logout ends the session the access or refresh token belongs to. Ending a
+// session that already ended succeeds.
+func (a *AuthService) Logout(ctx context.Context, token string, appID int) error {
+	const op = "services.auth.Logout"
+
+	decodeToken, err := a.decodeSessionToken(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to decode token", sl.OpErr(op, err))
+		return err
+	}
+
+	if err := a.db.SessionDB.EndSession(ctx, decodeToken.SessionID); err != nil {
+		a.log.Error("failed to end session", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("user logout complete",
+		slog.String("op", op),
+		slog.Int64("id", decodeToken.UserID),
+		slog.String("session_id", decodeToken.SessionID),
+	)
+	return nil
+}
+
+// LogoutAll ends every session of the token owner in all apps and returns
+// how many sessions were ended. The token must belong to an active session.
+func (a *AuthService) LogoutAll(ctx context.Context, token string, appID int) (int64, error) {
+	const op = "services.auth.LogoutAll"
+
+	decodeToken, err := a.decodeSessionToken(ctx, token, appID)
+	if err != nil {
+		a.log.Error("failed to decode token", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	if err := a.checkSession(ctx, decodeToken.SessionID); err != nil {
+		a.log.Error("session is not active", sl.OpErr(op, err), slog.String("session_id", decodeToken.SessionID))
+		return 0, err
+	}
+
+	count, err := a.db.SessionDB.EndUserSessions(ctx, decodeToken.UserID)
+	if err != nil {
+		a.log.Error("failed to end user sessions", sl.OpErr(op, err))
+		return 0, err
+	}
+
+	a.log.Info("user logout from all sessions complete",
+		slog.String("op", op),
+		slog.Int64("id", decodeToken.UserID),
+		slog.Int64("sessions", count),
+	)
+	return count, nil
+}
+
+// authenticate verifies an access token of the app and checks that its
+// session is still active. Every use of an impersonation token is recorded
+// in the impersonation audit.
+func (a *AuthService) authenticate(ctx context.Context, token string, appID int) (models.Token, error) {
+	const op = "services.auth.authenticate"
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.Token{}, ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.Token{}, err
+	}
+
+	decodeToken, err := jwt.DecodeToken(token, a.tokenOptions(app.ID), ring.verifyKeys(models.KeyKindAccess)...)
+	if err != nil {
+		a.log.Error("failed to decode token", sl.OpErr(op, err))
+		return models.Token{}, ErrUnauthorized
+	}
+
+	revoked, err := a.tokenRevoked(ctx, decodeToken.ID)
+	if err != nil {
+		a.log.Error("failed to check token revocation", sl.OpErr(op, err))
+		return models.Token{}, err
+	}
+	if revoked {
+		a.log.Error("token is revoked", slog.String("op", op), slog.String("jti", decodeToken.ID))
+		return models.Token{}, ErrUnauthorized
+	}
+
+	// Tokens issued before sessions were introduced have no session id and
+	// stay valid until they expire.
+	if decodeToken.SessionID != "" {
+		if err := a.checkSession(ctx, decodeToken.SessionID); err != nil {
+			a.log.Error("session is not active", sl.OpErr(op, err), slog.String("session_id", decodeToken.SessionID))
+			return models.Token{}, err
+		}
+	}
+
+	if actor := impersonator(decodeToken); actor != nil {
+		if err := a.auditImpersonation(ctx, models.ImpersonationUsed, decodeToken, actor.UserID, ""); err != nil {
+			a.log.Error("failed to audit impersonation", sl.OpErr(op, err))
+			return models.Token{}, err
+		}
+	}
+
+	return decodeToken, nil
+}
+
+// authenticateUser authenticates an access token like authenticate and
+// checks that it belongs to a user: tokens of service clients carry no
+// user id and must not act as one.
+func (a *AuthService) authenticateUser(ctx context.Context, token string, appID int) (models.Token, error) {
+	const op = "services.auth.authenticateUser"
+
+	decodeToken, err := a.authenticate(ctx, token, appID)
+	if err != nil {
+		return models.Token{}, err
+	}
+	if decodeToken.ClientID != "" || decodeToken.UserID == 0 {
+		a.log.Error("token does not belong to a user", slog.String("op", op), slog.String("client_id", decodeToken.ClientID))
+		return models.Token{}, ErrForbidden
+	}
+
+	return decodeToken, nil
+}
+
+// decodeSessionToken verifies an access or refresh token of the app that
+// belongs to a session. Tokens with an actor, from token exchange or
+// impersonation, do not own a session and are refused.
+func (a *AuthService) decodeSessionToken(ctx context.Context, token string, appID int) (models.Token, error) {
+	const op = "services.auth.decodeSessionToken"
+
+	app, err := a.db.AppDB.GetAppByID(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return models.Token{}, ErrInvalidData
+	}
+
+	ring, err := a.keyRing(ctx, app)
+	if err != nil {
+		a.log.Error("failed to get app keys", sl.OpErr(op, err))
+		return models.Token{}, err
+	}
+
+	keys := append(ring.verifyKeys(models.KeyKindAccess), ring.verifyKeys(models.KeyKindRefresh)...)
+	decodeToken, err := jwt.DecodeToken(token, a.tokenOptions(app.ID), keys...)
+	if err != nil {
+		a.log.Error("failed to decode token", sl.OpErr(op, err))
+		return models.Token{}, ErrUnauthorized
+	}
+
+	if decodeToken.Actor != nil {
+		a.log.Error("delegated token cannot manage sessions", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+		return models.Token{}, ErrForbidden
+	}
+	if decodeToken.SessionID == "" {
+		a.log.Error("token has no session", slog.String("op", op), slog.Int64("id", decodeToken.UserID))
+		return models.Token{}, ErrInvalidData
+	}
+
+	return decodeToken, nil
+}
+
+// startSession records a new session for the client of the request and
+// returns its id.
+func (a *AuthService) startSession(ctx context.Context, userID int64, appID int) (string, error) {
+	const op = "services.auth.startSession"
+
+	sessionID, err := secret.ID()
+	if err != nil {
+		a.log.Error("failed to generate session id", sl.OpErr(op, err))
+		return "", err
+	}
+
+	client := clientinfo.FromContext(ctx)
+	session := models.Session{
+		ID:        sessionID,
+		UserID:    userID,
+		AppID:     appID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+	}
+
+	if err := a.db.SessionDB.CreateSession(ctx, session); err != nil {
+		a.log.Error("failed to create session", sl.OpErr(op, err))
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+// checkSession returns ErrUnauthorized unless the session is active, and
+// records that the session was seen otherwise.
+func (a *AuthService) checkSession(ctx context.Context, sessionID string) error {
+	const op = "services.auth.checkSession"
+
+	if err := a.sessionActive(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if err := a.db.SessionDB.TouchSession(ctx, sessionID); err != nil {
+		a.log.Error("failed to touch session", sl.OpErr(op, err))
+	}
+
+	return nil
+}
+
+// sessionActive returns ErrUnauthorized unless the session is active.
+func (a *AuthService) sessionActive(ctx context.Context, sessionID string) error {
+	const op = "services.auth.sessionActive"
+
+	session, err := a.db.SessionDB.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrUnauthorized
+		}
+		a.log.Error("failed to get session", sl.OpErr(op, err))
+		return err
+	}
+
+	if session.EndedAt != nil {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc/internal/database"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"grpc/internal/lib/secret"
+	"log/slog"
+	"time"
+)
+
+const verificationTokenBytes = 32
+
+var ErrEmailNotVerified = errors.New("email not verified")
+
+// SendVerificationEmail sends a new verification mail to the user with the
+// email, unless the email is verified already or a mail was sent within
+// the resend interval. Neither case nor unknown addresses are reported, so
+// that the call does not tell which addresses are registered. The mail
+// uses the templates of the app, zero for none, and the locale.
+func (a *AuthService) SendVerificationEmail(ctx context.Context, email string, appID int, locale string) error {
+	const op = "services.auth.SendVerificationEmail"
+
+	if err := a.checkMailApp(ctx, appID); err != nil {
+		a.log.Error("failed to get app by id", sl.OpErr(op, err))
+		return err
+	}
+
+	user, err := a.db.AuthDB.GetUserByEmail(ctx, email)
+	if err != nil {
+		a.log.Info("verification mail for unknown email", slog.String("op", op), slog.String("email", email))
+		return nil
+	}
+	if user.EmailVerified {
+		a.log.Info("email already verified", slog.String("op", op), slog.Int64("id", user.ID))
+		return nil
+	}
+
+	if err := a.sendVerificationEmail(ctx, user, appID, locale); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return nil
+		}
+		a.log.Error("failed to send verification mail", sl.OpErr(op, err))
+		return err
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email of the user the verification token was sent
+// to as verified. Tokens are used once.
+func (a *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	const op = "services.auth.VerifyEmail"
+
+	userID, err := a.db.AuthDB.VerifyEmail(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidData
+		}
+		a.log.Error("failed to verify email", sl.OpErr(op, err))
+		return err
+	}
+
+	a.log.Info("email verified", slog.String("op", op), slog.Int64("id", userID))
+	return nil
+}
+
+// sendVerificationEmail creates a verification token for the current email
+// of the user and puts the mail with the link to it into the outbox. It
+// returns database.ErrConflict if a token was created within the resend
+// interval.
+func (a *AuthService) sendVerificationEmail(ctx context.Context, user models.User, appID int, locale string) error {
+	const op = "services.auth.sendVerificationEmail"
+
+	token, err := secret.Generate(verificationTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenLink(a.emailVerification.URL, token)
+	if err != nil {
+		return err
+	}
+
+	mail, err := a.renderMail(ctx, mailVerifyEmail, user, appID, locale, mailData{
+		Link:    link,
+		Expires: formatDuration(a.emailVerification.TokenExpires),
+	})
+	if err != nil {
+		return err
+	}
+
+	record := models.EmailVerificationToken{
+		TokenHash: secret.Hash(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(a.emailVerification.TokenExpires),
+	}
+	if err := a.db.AuthDB.CreateEmailVerificationToken(ctx, record, a.emailVerification.ResendInterval, mail); err != nil {
+		return err
+	}
+
+	a.log.Info("verification mail queued", slog.String("op", op), slog.Int64("id", user.ID))
+	return nil
+}
+
+// checkEmailVerified returns ErrEmailNotVerified if the app only signs in
+// users with a verified email and the user is not one of them.
+func checkEmailVerified(user models.User, app models.App) error {
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// checkUserEmailVerified is checkEmailVerified for a user known by id. The
+// user is only loaded if the app requires a verified email.
+func (a *AuthService) checkUserEmailVerified(ctx context.Context, userID int64, app models.App) error {
+	if !app.RequireVerifiedEmail {
+		return nil
+	}
+
+	user, err := a.db.AuthDB.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return checkEmailVerified(user, app)
+}
@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"context"
+	"grpc/internal/config"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sso",
+	Name:      "mail_deliveries_total",
+	Help:      "Deliveries of mail from the outbox, by result.",
+}, []string{"result"})
+
+// markSentTimeout bounds marking a sent mail, which is not canceled with
+// the delivery.
+const markSentTimeout = 5 * time.Second
+
+// Mailer delivers a mail to its recipient.
+type Mailer interface {
+	Send(ctx context.Context, mail models.Mail) error
+}
+
+type OutboxDB interface {
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id int64) error
+	RetryMail(ctx context.Context, id int64, lastError string, delay time.Duration) error
+	FailMail(ctx context.Context, id int64, lastError string) error
+}
+
+// MailService delivers the mail in the outbox. Mail is put into the outbox
+// in the transaction that triggered it, so only mail of committed changes
+// is sent.
+type MailService struct {
+	log    *slog.Logger
+	db     OutboxDB
+	mailer Mailer
+	outbox config.OutboxConfig
+}
+
+func NewMailService(log *slog.Logger, db OutboxDB, mailer Mailer, outbox config.OutboxConfig) *MailService {
+	return &MailService{
+		log:    log,
+		db:     db,
+		mailer: mailer,
+		outbox: outbox,
+	}
+}
+
+// DeliverMail sends the mail that is due, a batch at a time, until none is
+// left or ctx is canceled. Failed mail is retried later; the error is only
+// returned if the outbox cannot be read or ctx is canceled.
+func (m *MailService) DeliverMail(ctx context.Context) error {
+	const op = "services.mail.DeliverMail"
+
+	for {
+		mails, err := m.db.ClaimMail(ctx, m.outbox.BatchSize, m.outbox.Lease)
+		if err != nil {
+			m.log.Error("failed to claim mail", sl.OpErr(op, err))
+			return err
+		}
+
+		for _, mail := range mails {
+			// Claimed mail left unsent is retried once its lease ends.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			m.deliver(ctx, mail)
+		}
+
+		if len(mails) < m.outbox.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (m *MailService) deliver(ctx context.Context, mail models.OutboxMail) {
+	const op = "services.mail.deliver"
+
+	sendErr := m.mailer.Send(ctx, mail.Mail)
+	if sendErr == nil {
+		deliveries.WithLabelValues("sent").Inc()
+		// The mail is out, so it is marked sent even if the outbox is
+		// stopping meanwhile.
+		markCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), markSentTimeout)
+		defer cancel()
+		if err := m.db.MarkMailSent(markCtx, mail.ID); err != nil {
+			// The mail is sent again once its lease ends.
+			m.log.Error("failed to mark mail sent", sl.OpErr(op, err), slog.Int64("mail_id", mail.ID))
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		m.log.Info("mail delivery canceled", slog.String("op", op), slog.Int64("mail_id", mail.ID))
+		return
+	}
+
+	m.log.Error("failed to send mail", sl.OpErr(op, sendErr), slog.Int64("mail_id", mail.ID), slog.Int("attempts", mail.Attempts))
+
+	if mail.Attempts >= m.outbox.MaxAttempts {
+		deliveries.WithLabelValues("failed").Inc()
+		if err := m.db.FailMail(ctx, mail.ID, sendErr.Error()); err != nil {
+			m.log.Error("failed to mark mail failed", sl.OpErr(op, err), slog.Int64("mail_id", mail.ID))
+		}
+		return
+	}
+
+	deliveries.WithLabelValues("retry").Inc()
+	if err := m.db.RetryMail(ctx, mail.ID, sendErr.Error(), retryDelay(m.outbox.RetryBackoff, mail.Attempts)); err != nil {
+		m.log.Error("failed to retry mail", sl.OpErr(op, err), slog.Int64("mail_id", mail.ID))
+	}
+}
+
+// retryDelay doubles the backoff for every attempt after the first.
+func retryDelay(backoff time.Duration, attempts int) time.Duration {
+	delay := backoff
+	for range attempts - 1 {
+		delay *= 2
+	}
+
+	return delay
+}
@@ -0,0 +1,251 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc/internal/config"
+	"grpc/internal/domain/models"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutboxDB keeps the outbox in memory. A claimed mail is due again only
+// if it is retried without delay.
+type fakeOutboxDB struct {
+	mu       sync.Mutex
+	mails    []*fakeOutboxMail
+	claims   []int
+	claimErr error
+	sent     []int64
+	retried  map[int64]time.Duration
+	failed   map[int64]string
+}
+
+type fakeOutboxMail struct {
+	mail models.OutboxMail
+	due  bool
+}
+
+func newFakeOutboxDB(mails ...models.OutboxMail) *fakeOutboxDB {
+	db := &fakeOutboxDB{
+		retried: make(map[int64]time.Duration),
+		failed:  make(map[int64]string),
+	}
+	for _, mail := range mails {
+		db.mails = append(db.mails, &fakeOutboxMail{mail: mail, due: true})
+	}
+
+	return db
+}
+
+func (f *fakeOutboxDB) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.claimErr != nil {
+		return nil, f.claimErr
+	}
+
+	var claimed []models.OutboxMail
+	for _, mail := range f.mails {
+		if len(claimed) == limit {
+			break
+		}
+		if mail.due {
+			mail.due = false
+			mail.mail.Attempts++
+			claimed = append(claimed, mail.mail)
+		}
+	}
+	f.claims = append(f.claims, len(claimed))
+
+	return claimed, nil
+}
+
+func (f *fakeOutboxDB) MarkMailSent(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeOutboxDB) RetryMail(ctx context.Context, id int64, lastError string, delay time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.retried[id] = delay
+	return nil
+}
+
+func (f *fakeOutboxDB) FailMail(ctx context.Context, id int64, lastError string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failed[id] = lastError
+	return nil
+}
+
+// fakeMailer records the mail it sent. Sending fails with the error of send,
+// if set, and for the recipients in errs.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []string
+	errs map[string]error
+	send func(ctx context.Context, mail models.Mail) error
+}
+
+func (f *fakeMailer) Send(ctx context.Context, mail models.Mail) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.send != nil {
+		if err := f.send(ctx, mail); err != nil {
+			return err
+		}
+	}
+	if err := f.errs[mail.To]; err != nil {
+		return err
+	}
+
+	f.sent = append(f.sent, mail.To)
+	return nil
+}
+
+var testOutbox = config.OutboxConfig{
+	BatchSize:    10,
+	MaxAttempts:  5,
+	RetryBackoff: time.Minute,
+	Lease:        5 * time.Minute,
+}
+
+func newTestService(db OutboxDB, mailer Mailer) *MailService {
+	return NewMailService(slog.New(slog.NewTextHandler(io.Discard, nil)), db, mailer, testOutbox)
+}
+
+func outboxMail(id int64, attempts int) models.OutboxMail {
+	return models.OutboxMail{
+		ID:       id,
+		Mail:     models.Mail{To: fmt.Sprintf("user%d@example.com", id), Subject: "Hello"},
+		Attempts: attempts,
+	}
+}
+
+func TestDeliverMail(t *testing.T) {
+	var mails []models.OutboxMail
+	for id := range int64(25) {
+		mails = append(mails, outboxMail(id, 0))
+	}
+	db := newFakeOutboxDB(mails...)
+	mailer := &fakeMailer{}
+
+	require.NoError(t, newTestService(db, mailer).DeliverMail(context.Background()))
+
+	// Batches are claimed until one is not full.
+	assert.Equal(t, []int{10, 10, 5}, db.claims)
+	assert.Len(t, mailer.sent, 25)
+	assert.Len(t, db.sent, 25)
+	assert.Empty(t, db.retried)
+	assert.Empty(t, db.failed)
+}
+
+func TestDeliverMailFailures(t *testing.T) {
+	sendErr := errors.New("550 mailbox unavailable")
+	first := outboxMail(1, 0)
+	third := outboxMail(2, 2)
+	last := outboxMail(3, testOutbox.MaxAttempts-1)
+	ok := outboxMail(4, 0)
+
+	db := newFakeOutboxDB(first, third, last, ok)
+	mailer := &fakeMailer{errs: map[string]error{
+		first.Mail.To: sendErr,
+		third.Mail.To: sendErr,
+		last.Mail.To:  sendErr,
+	}}
+
+	require.NoError(t, newTestService(db, mailer).DeliverMail(context.Background()))
+
+	assert.Equal(t, []int64{ok.ID}, db.sent)
+	assert.Equal(t, map[int64]time.Duration{
+		first.ID: testOutbox.RetryBackoff,
+		third.ID: 4 * testOutbox.RetryBackoff,
+	}, db.retried)
+	assert.Equal(t, map[int64]string{last.ID: sendErr.Error()}, db.failed)
+}
+
+func TestDeliverMailCanceled(t *testing.T) {
+	db := newFakeOutboxDB(outboxMail(1, 0), outboxMail(2, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stopping the outbox cuts the send short.
+	mailer := &fakeMailer{send: func(ctx context.Context, mail models.Mail) error {
+		cancel()
+		return ctx.Err()
+	}}
+
+	err := newTestService(db, mailer).DeliverMail(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The mail is neither retried nor failed: it is sent again once its
+	// lease ends. The next one is left alone.
+	assert.Empty(t, mailer.sent)
+	assert.Empty(t, db.sent)
+	assert.Empty(t, db.retried)
+	assert.Empty(t, db.failed)
+}
+
+func TestDeliverMailCanceledAfterSend(t *testing.T) {
+	db := newFakeOutboxDB(outboxMail(1, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The outbox stops right after the mail went out.
+	mailer := &fakeMailer{send: func(ctx context.Context, mail models.Mail) error {
+		cancel()
+		return nil
+	}}
+
+	require.NoError(t, newTestService(db, mailer).DeliverMail(ctx))
+
+	// The mail is not sent again.
+	assert.Equal(t, []int64{1}, db.sent)
+}
+
+func TestDeliverMailClaimError(t *testing.T) {
+	db := newFakeOutboxDB()
+	db.claimErr = errors.New("connection refused")
+
+	err := newTestService(db, &fakeMailer{}).DeliverMail(context.Background())
+	require.ErrorIs(t, err, db.claimErr)
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 5, want: 16 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			assert.Equal(t, tt.want, retryDelay(time.Minute, tt.attempts))
+		})
+	}
+}
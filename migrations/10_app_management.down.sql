@@ -0,0 +1,5 @@
+ALTER TABLE app DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE app DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE app ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS app_id_seq;
@@ -0,0 +1,6 @@
+CREATE SEQUENCE IF NOT EXISTS app_id_seq OWNED BY app.id;
+SELECT setval('app_id_seq', COALESCE((SELECT MAX(id) FROM app), 0) + 1, false);
+ALTER TABLE app ALTER COLUMN id SET DEFAULT nextval('app_id_seq');
+
+ALTER TABLE app ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE app ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS authorization_code;
+DROP TABLE IF EXISTS app_redirect_uri;
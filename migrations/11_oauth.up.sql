@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS app_redirect_uri
+(
+    app_id INTEGER NOT NULL REFERENCES app(id),
+    uri    TEXT NOT NULL,
+    PRIMARY KEY (app_id, uri)
+);
+
+CREATE TABLE IF NOT EXISTS authorization_code
+(
+    code_hash      TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL REFERENCES app(id),
+    user_id        INTEGER NOT NULL REFERENCES public.user(id),
+    redirect_uri   TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    scope          TEXT NOT NULL DEFAULT '',
+    session_id     TEXT,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    used_at        TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
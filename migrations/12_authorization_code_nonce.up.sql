@@ -0,0 +1 @@
+ALTER TABLE authorization_code ADD COLUMN IF NOT EXISTS nonce TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS service_client
+(
+    id          TEXT PRIMARY KEY,
+    app_id      INTEGER NOT NULL REFERENCES app(id),
+    name        TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    scope       TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_client_app_id ON service_client (app_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS device_code
+(
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    app_id           INTEGER NOT NULL REFERENCES app(id),
+    scope            TEXT NOT NULL DEFAULT '',
+    user_id          INTEGER REFERENCES public.user(id),
+    status           TEXT NOT NULL DEFAULT 'pending',
+    interval_seconds INTEGER NOT NULL,
+    last_polled_at   TIMESTAMPTZ,
+    expires_at       TIMESTAMPTZ NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_code_expires_at ON device_code (expires_at);
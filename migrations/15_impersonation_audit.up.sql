@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS impersonation_audit
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event      TEXT NOT NULL,
+    token_id   TEXT NOT NULL,
+    actor_id   INTEGER NOT NULL REFERENCES public.user(id),
+    user_id    INTEGER NOT NULL REFERENCES public.user(id),
+    app_id     INTEGER NOT NULL REFERENCES app(id),
+    reason     TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_user_id ON impersonation_audit(user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_token_id ON impersonation_audit(token_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS mfa_challenge;
+DROP TABLE IF EXISTS mfa_recovery_code;
+DROP TABLE IF EXISTS mfa_totp;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS mfa_totp
+(
+    user_id        INTEGER PRIMARY KEY REFERENCES public.user(id),
+    secret         TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at   TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_code
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES public.user(id),
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_challenge
+(
+    challenge_hash TEXT PRIMARY KEY,
+    user_id        INTEGER NOT NULL REFERENCES public.user(id),
+    app_id         INTEGER NOT NULL REFERENCES app(id),
+    scope          TEXT NOT NULL DEFAULT '',
+    attempts       INTEGER NOT NULL DEFAULT 0,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    consumed_at    TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_challenge_expires_at ON mfa_challenge (expires_at);
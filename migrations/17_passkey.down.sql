@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS passkey_challenge;
+DROP TABLE IF EXISTS passkey;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS passkey
+(
+    credential_id   BYTEA PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES public.user(id),
+    name            TEXT NOT NULL DEFAULT '',
+    public_key      BYTEA NOT NULL,
+    algorithm       INTEGER NOT NULL,
+    sign_count      BIGINT NOT NULL DEFAULT 0,
+    transports      TEXT[] NOT NULL DEFAULT '{}',
+    aaguid          BYTEA NOT NULL,
+    backup_eligible BOOLEAN NOT NULL DEFAULT false,
+    backed_up       BOOLEAN NOT NULL DEFAULT false,
+    last_used_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkey_user_id ON passkey (user_id);
+
+CREATE TABLE IF NOT EXISTS passkey_challenge
+(
+    challenge_hash TEXT PRIMARY KEY,
+    kind           TEXT NOT NULL,
+    user_id        INTEGER REFERENCES public.user(id),
+    app_id         INTEGER NOT NULL REFERENCES app(id),
+    scope          TEXT NOT NULL DEFAULT '',
+    expires_at     TIMESTAMPTZ NOT NULL,
+    consumed_at    TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkey_challenge_expires_at ON passkey_challenge (expires_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_verification_token;
+ALTER TABLE app DROP COLUMN IF EXISTS require_verified_email;
+ALTER TABLE public.user DROP COLUMN IF EXISTS email_verified;
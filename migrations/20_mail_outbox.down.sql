@@ -0,0 +1,3 @@
+ALTER TABLE password_reset_token DROP COLUMN IF EXISTS locale;
+ALTER TABLE password_reset_token DROP COLUMN IF EXISTS app_id;
+DROP TABLE IF EXISTS mail_outbox;
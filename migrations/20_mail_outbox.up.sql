@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS mail_outbox
+(
+    id              BIGSERIAL PRIMARY KEY,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    text_body       TEXT NOT NULL,
+    html_body       TEXT NOT NULL DEFAULT '',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT NOT NULL DEFAULT '',
+    sent_at         TIMESTAMPTZ,
+    failed_at       TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mail_outbox_pending ON mail_outbox (next_attempt_at)
+    WHERE sent_at IS NULL AND failed_at IS NULL;
+
+ALTER TABLE password_reset_token ADD COLUMN IF NOT EXISTS app_id INTEGER REFERENCES app(id) ON DELETE SET NULL;
+ALTER TABLE password_reset_token ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DELETE FROM revoked_token WHERE user_id IS NULL OR revoked_by IS NULL;
+ALTER TABLE revoked_token DROP COLUMN IF EXISTS revoked_by_client;
+ALTER TABLE revoked_token DROP COLUMN IF EXISTS client_id;
+ALTER TABLE revoked_token ALTER COLUMN revoked_by SET NOT NULL;
+ALTER TABLE revoked_token ALTER COLUMN user_id SET NOT NULL;
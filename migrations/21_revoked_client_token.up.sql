@@ -0,0 +1,5 @@
+-- Tokens of service clients have no user: they are recorded by client id.
+ALTER TABLE revoked_token ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE revoked_token ALTER COLUMN revoked_by DROP NOT NULL;
+ALTER TABLE revoked_token ADD COLUMN IF NOT EXISTS client_id TEXT;
+ALTER TABLE revoked_token ADD COLUMN IF NOT EXISTS revoked_by_client TEXT;
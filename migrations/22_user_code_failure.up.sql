@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_code_failure
+(
+    client_ip TEXT NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_code_failure_client_ip ON user_code_failure (client_ip, failed_at);
@@ -0,0 +1 @@
+ALTER TABLE service_client DROP COLUMN IF EXISTS audiences;
@@ -0,0 +1 @@
+ALTER TABLE service_client ADD COLUMN IF NOT EXISTS audiences INTEGER[] NOT NULL DEFAULT '{}';
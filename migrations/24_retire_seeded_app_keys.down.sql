@@ -0,0 +1,2 @@
+-- The retired keys are not brought back: their secrets are public.
+UPDATE app SET name = 'test app' WHERE id = 1 AND name = 'admin';
@@ -0,0 +1,9 @@
+-- App 1 was seeded with signing secrets that are public in the repository.
+-- Its keys are retired, so tokens signed with them are refused; the key
+-- rotator gives the app new keys when the server starts. The app stays the
+-- default admin app.
+UPDATE app_key SET status = 'retired', deactivated_at = COALESCE(deactivated_at, now())
+WHERE app_id = 1 AND status <> 'retired';
+
+UPDATE app SET name = 'admin'
+WHERE id = 1 AND name = 'test app' AND NOT EXISTS (SELECT 1 FROM app WHERE name = 'admin');
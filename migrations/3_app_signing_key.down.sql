@@ -0,0 +1,2 @@
+ALTER TABLE app DROP COLUMN IF EXISTS private_key;
+ALTER TABLE app DROP COLUMN IF EXISTS signing_alg;
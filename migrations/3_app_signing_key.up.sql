@@ -0,0 +1,2 @@
+ALTER TABLE app ADD COLUMN IF NOT EXISTS signing_alg TEXT NOT NULL DEFAULT 'HS512';
+ALTER TABLE app ADD COLUMN IF NOT EXISTS private_key TEXT NOT NULL DEFAULT '';
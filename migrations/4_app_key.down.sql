@@ -0,0 +1,28 @@
+ALTER TABLE app ADD COLUMN IF NOT EXISTS secret TEXT;
+ALTER TABLE app ADD COLUMN IF NOT EXISTS refresh_secret TEXT;
+ALTER TABLE app ADD COLUMN IF NOT EXISTS private_key TEXT NOT NULL DEFAULT '';
+
+UPDATE app SET
+    secret = COALESCE((
+        SELECT k.secret FROM app_key k
+        WHERE k.app_id = app.id AND k.kind = 'access' AND k.algorithm = 'HS512' AND k.status = 'active'
+        ORDER BY k.activates_at DESC LIMIT 1
+    ), md5(random()::text)),
+    refresh_secret = COALESCE((
+        SELECT k.secret FROM app_key k
+        WHERE k.app_id = app.id AND k.kind = 'refresh' AND k.status = 'active'
+        ORDER BY k.activates_at DESC LIMIT 1
+    ), md5(random()::text)),
+    private_key = COALESCE((
+        SELECT k.secret FROM app_key k
+        WHERE k.app_id = app.id AND k.kind = 'access' AND k.algorithm = app.signing_alg AND k.algorithm <> 'HS512' AND k.status = 'active'
+        ORDER BY k.activates_at DESC LIMIT 1
+    ), '');
+
+ALTER TABLE app ALTER COLUMN secret SET NOT NULL;
+ALTER TABLE app ALTER COLUMN refresh_secret SET NOT NULL;
+ALTER TABLE app ADD CONSTRAINT app_secret_key UNIQUE (secret);
+ALTER TABLE app ADD CONSTRAINT app_refresh_secret_key UNIQUE (refresh_secret);
+
+DROP INDEX IF EXISTS idx_app_key_app_id;
+DROP TABLE IF EXISTS app_key;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS app_key
+(
+    id             TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL REFERENCES app(id),
+    kind           TEXT NOT NULL,
+    algorithm      TEXT NOT NULL,
+    secret         TEXT NOT NULL,
+    status         TEXT NOT NULL DEFAULT 'active',
+    activates_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deactivated_at TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_app_key_app_id ON app_key(app_id);
+
+INSERT INTO app_key (id, app_id, kind, algorithm, secret)
+SELECT md5(random()::text || clock_timestamp()::text), id, 'access', signing_alg,
+       CASE WHEN signing_alg = 'HS512' THEN secret ELSE private_key END
+FROM app
+WHERE signing_alg = 'HS512' OR private_key <> '';
+
+INSERT INTO app_key (id, app_id, kind, algorithm, secret)
+SELECT md5(random()::text || clock_timestamp()::text), id, 'refresh', 'HS512', refresh_secret
+FROM app;
+
+ALTER TABLE app DROP COLUMN IF EXISTS secret;
+ALTER TABLE app DROP COLUMN IF EXISTS refresh_secret;
+ALTER TABLE app DROP COLUMN IF EXISTS private_key;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_refresh_token_family_id;
+DROP TABLE IF EXISTS refresh_token;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS refresh_token
+(
+    id          BIGSERIAL PRIMARY KEY,
+    token_hash  TEXT NOT NULL UNIQUE,
+    family_id   TEXT NOT NULL,
+    user_id     INTEGER NOT NULL REFERENCES public.user(id),
+    app_id      INTEGER NOT NULL REFERENCES app(id),
+    expires_at  TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_family_id ON refresh_token(family_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS session
+(
+    id           TEXT PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES public.user(id),
+    app_id       INTEGER NOT NULL REFERENCES app(id),
+    user_agent   TEXT NOT NULL DEFAULT '',
+    ip           TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON session(user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS revoked_token
+(
+    jti        TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES public.user(id),
+    app_id     INTEGER NOT NULL REFERENCES app(id),
+    revoked_by INTEGER NOT NULL REFERENCES public.user(id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_token_expires_at ON revoked_token(expires_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS admin
+(
+    id       INTEGER PRIMARY KEY,
+    user_id  INTEGER NOT NULL REFERENCES public.user(id),
+    app_id   INTEGER NOT NULL REFERENCES app(id)
+);
+CREATE INDEX IF NOT EXISTS idx_admin_user_id ON admin(user_id);
+
+INSERT INTO admin (id, user_id, app_id)
+SELECT row_number() OVER (ORDER BY ur.assigned_at), ur.user_id, r.app_id FROM user_role ur
+JOIN role r ON r.id = ur.role_id AND r.name = 'admin';
+
+DROP INDEX IF EXISTS idx_user_role_role_id;
+DROP TABLE IF EXISTS user_role;
+DROP TABLE IF EXISTS role_permission;
+DROP TABLE IF EXISTS role;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS role
+(
+    id          SERIAL PRIMARY KEY,
+    app_id      INTEGER NOT NULL REFERENCES app(id),
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (app_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS role_permission
+(
+    role_id    INTEGER NOT NULL REFERENCES role(id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_role
+(
+    user_id     INTEGER NOT NULL REFERENCES public.user(id),
+    role_id     INTEGER NOT NULL REFERENCES role(id) ON DELETE CASCADE,
+    assigned_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_role_role_id ON user_role(role_id);
+
+INSERT INTO role (app_id, name, description)
+SELECT id, 'admin', 'Built-in role with every permission' FROM app
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permission (role_id, permission)
+SELECT id, '*' FROM role WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_role (user_id, role_id)
+SELECT a.user_id, r.id FROM admin a
+JOIN role r ON r.app_id = a.app_id AND r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_admin_user_id;
+DROP TABLE IF EXISTS admin;
@@ -0,0 +1 @@
+ALTER TABLE refresh_token ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
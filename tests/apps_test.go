@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/tests/suite"
+	"slices"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestManageApps(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	name := "app " + gofakeit.UUID()
+
+	createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: token,
+		Name:  name,
+	})
+	require.NoError(t, err)
+	app := createResp.GetApp()
+	require.NotZero(t, app.GetId())
+	assert.Equal(t, name, app.GetName())
+	assert.Equal(t, "HS512", app.GetSigningAlg())
+	require.NotEmpty(t, createResp.GetSecret())
+
+	_, err = st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: token,
+		Name:  name,
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// The keys were created with the app: its users can sign in at once and
+	// the returned secret verifies their tokens.
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    app.GetId(),
+	})
+	require.NoError(t, err)
+
+	data, err := jwt.DecodeToken(loginResp.GetAccessToken(), jwt.Options{
+		Issuer:   st.Cfg.JWT.Issuer,
+		Audience: jwt.Audience(int(app.GetId())),
+	}, jwt.Key{Algorithm: jwt.AlgHS512, Secret: createResp.GetSecret()})
+	require.NoError(t, err)
+	assert.Equal(t, registerResp.GetUserId(), data.UserID)
+
+	updateResp, err := st.AppsClient.UpdateApp(ctx, &ssov1.UpdateAppRequest{
+		Token: token,
+		AppId: app.GetId(),
+		Name:  name + " renamed",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, name+" renamed", updateResp.GetApp().GetName())
+	assert.False(t, updateResp.GetApp().GetRequireVerifiedEmail())
+
+	updateResp, err = st.AppsClient.UpdateApp(ctx, &ssov1.UpdateAppRequest{
+		Token:                      token,
+		AppId:                      app.GetId(),
+		Name:                       name + " renamed",
+		RequireVerifiedEmail:       true,
+		UpdateRequireVerifiedEmail: true,
+	})
+	require.NoError(t, err)
+	assert.True(t, updateResp.GetApp().GetRequireVerifiedEmail())
+
+	// Settings that are not sent stay as they are.
+	updateResp, err = st.AppsClient.UpdateApp(ctx, &ssov1.UpdateAppRequest{
+		Token: token,
+		AppId: app.GetId(),
+		Name:  name + " renamed",
+	})
+	require.NoError(t, err)
+	assert.True(t, updateResp.GetApp().GetRequireVerifiedEmail())
+
+	listResp, err := st.AppsClient.ListApps(ctx, &ssov1.ListAppsRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, slices.ContainsFunc(listResp.GetApps(), func(listed *ssov1.App) bool {
+		return listed.GetId() == app.GetId() && listed.GetName() == name+" renamed"
+	}))
+
+	_, err = st.AppsClient.DeleteApp(ctx, &ssov1.DeleteAppRequest{
+		Token: token,
+		AppId: app.GetId(),
+	})
+	require.NoError(t, err)
+
+	listResp, err = st.AppsClient.ListApps(ctx, &ssov1.ListAppsRequest{Token: token})
+	require.NoError(t, err)
+	assert.False(t, slices.ContainsFunc(listResp.GetApps(), func(listed *ssov1.App) bool {
+		return listed.GetId() == app.GetId()
+	}))
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    app.GetId(),
+	})
+	require.Error(t, err)
+
+	// The admin app cannot be deleted.
+	_, err = st.AppsClient.DeleteApp(ctx, &ssov1.DeleteAppRequest{
+		Token: token,
+		AppId: int32(st.Cfg.Apps.AdminAppID),
+	})
+	requireStatus(t, ErrInvalidData, err)
+}
+
+func TestManageAppsWithoutPermission(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    int32(st.Cfg.Apps.AdminAppID),
+	})
+	require.NoError(t, err)
+	token := loginResp.GetAccessToken()
+
+	_, err = st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: token,
+		Name:  user.Email,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AppsClient.ListApps(ctx, &ssov1.ListAppsRequest{Token: token})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AppsClient.DeleteApp(ctx, &ssov1.DeleteAppRequest{
+		Token: token,
+		AppId: appID,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+// adminToken registers a user, makes it an admin of the admin app and
+// returns its access token to that app.
+func adminToken(t *testing.T, ctx context.Context, st *suite.Suite) string {
+	t.Helper()
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	grantRole(t, ctx, st, registerResp.GetUserId(), st.Cfg.Apps.AdminAppID, models.RoleAdmin)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    int32(st.Cfg.Apps.AdminAppID),
+	})
+	require.NoError(t, err)
+
+	return loginResp.GetAccessToken()
+}
+
+// createApp creates an app with a unique name and returns its id.
+func createApp(t *testing.T, ctx context.Context, st *suite.Suite, token string, requireVerifiedEmail bool) int32 {
+	t.Helper()
+
+	createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token:                token,
+		Name:                 "app " + gofakeit.UUID(),
+		RequireVerifiedEmail: requireVerifiedEmail,
+	})
+	require.NoError(t, err)
+
+	return createResp.GetApp().GetId()
+}
+
+// grantRole assigns the existing role of the app to the user directly in
+// the database.
+func grantRole(t *testing.T, ctx context.Context, st *suite.Suite, userID int64, appID int, role string) {
+	t.Helper()
+
+	tag, err := st.DB().Exec(ctx, `
+		INSERT INTO user_role (user_id, role_id)
+		SELECT $1, id FROM role WHERE app_id = $2 AND name = $3
+		ON CONFLICT DO NOTHING;
+	`, userID, appID, role)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, tag.RowsAffected())
+}
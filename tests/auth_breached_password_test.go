@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"bufio"
+	"grpc/tests/suite"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const breachedChecksMetric = `sso_breached_password_checks_total{result="breached"}`
+
+func TestRegisterBreachedPassword(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// Strong by the policy, but listed in testdata/breached_passwords.txt.
+	for _, password := range []string{"Tr0ub4dor&3", "zaq1@WSXcde3"} {
+		before := metricValue(t, st, breachedChecksMetric)
+
+		_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+			Email:    gofakeit.Email(),
+			Password: password,
+			Name:     gofakeit.FirstName(),
+		})
+		require.Error(t, err)
+		assert.Equal(t, []string{"breached"}, policyViolations(t, err))
+
+		assert.Equal(t, before+1, metricValue(t, st, breachedChecksMetric))
+	}
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+}
+
+// metricValue returns the value of the sample from the metrics endpoint,
+// or 0 when it was not recorded yet.
+func metricValue(t *testing.T, st *suite.Suite, sample string) float64 {
+	t.Helper()
+
+	resp, err := http.Get(st.HTTPURL("/metrics"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), sample+" ")
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		require.NoError(t, err)
+		return f
+	}
+	require.NoError(t, scanner.Err())
+
+	return 0
+}
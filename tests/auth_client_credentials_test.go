@@ -0,0 +1,276 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"grpc/internal/lib/secret"
+	"grpc/tests/suite"
+	"net/http"
+	"net/url"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidClient = status.Error(codes.Unauthenticated, "invalid client")
+
+func TestClientCredentialsUnknownClient(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		ClientId:     gofakeit.UUID(),
+		ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+	})
+	requireStatus(t, ErrInvalidClient, err)
+
+	resp, err := http.PostForm(st.HTTPURL("/token"), url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {gofakeit.UUID()},
+		"client_secret": {gofakeit.Password(true, true, true, false, false, 32)},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body oauthTokenResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "invalid_client", body.Error)
+}
+
+func TestClientCredentials(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	clientID, clientSecret := createServiceClient(t, ctx, st, token, appID, "billing:read billing:write")
+
+	tokenResp, err := st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		Scope:        "billing:read",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read", tokenResp.GetScope())
+	assert.Equal(t, int64(st.Cfg.OAuth.ClientTokenExpires.Seconds()), tokenResp.GetExpiresIn())
+
+	data := decodeAccessToken(t, st, tokenResp.GetAccessToken())
+	assert.Equal(t, clientID, data.ClientID)
+	assert.Equal(t, clientID, data.Subject)
+	assert.Zero(t, data.UserID)
+	assert.Empty(t, data.SessionID)
+	assert.Equal(t, "billing:read", data.Scope)
+
+	_, err = st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		Scope:        "users:delete",
+	})
+	requireStatus(t, ErrInvalidData, err)
+
+	resp, err := http.PostForm(st.HTTPURL("/token"), url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body oauthTokenResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, body.AccessToken)
+
+	// A client token carries no user and cannot act as one.
+	clientToken := tokenResp.GetAccessToken()
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{Token: clientToken, AppId: appID})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{Token: clientToken, AppId: appID})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.LogoutAll(ctx, &ssov1.LogoutAllRequest{Token: clientToken, AppId: appID})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  clientToken,
+		AppId:  appID,
+		UserId: 1,
+		Role:   "admin",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AppsClient.DeleteServiceClient(ctx, &ssov1.DeleteServiceClientRequest{
+		Token:    token,
+		ClientId: clientID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+	})
+	requireStatus(t, ErrInvalidClient, err)
+}
+
+func TestRevokeClientToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	firstID, firstSecret := createServiceClient(t, ctx, st, token, appID, "billing:read")
+	secondID, secondSecret := createServiceClient(t, ctx, st, token, appID, "billing:read")
+
+	issue := func(clientID string, clientSecret string) string {
+		tokenResp, err := st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+			ClientId:     clientID,
+			ClientSecret: clientSecret,
+		})
+		require.NoError(t, err)
+		return tokenResp.GetAccessToken()
+	}
+	first, firstAgain, second := issue(firstID, firstSecret), issue(firstID, firstSecret), issue(secondID, secondSecret)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	// Neither another client nor a user without tokens:revoke may revoke a
+	// client's token, and a client may not revoke a user's.
+	for _, tt := range []struct{ caller, revoked string }{
+		{caller: second, revoked: first},
+		{caller: loginResp.GetAccessToken(), revoked: first},
+		{caller: first, revoked: loginResp.GetAccessToken()},
+	} {
+		_, err := st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+			Token:       tt.caller,
+			AppId:       appID,
+			RevokeToken: tt.revoked,
+		})
+		requireStatus(t, ErrPermissionDenied, err)
+	}
+
+	// A client may revoke its own tokens.
+	_, err = st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+		Token:       first,
+		AppId:       appID,
+		RevokeToken: firstAgain,
+	})
+	require.NoError(t, err)
+
+	introspectResp, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{Token: firstAgain, AppId: appID})
+	require.NoError(t, err)
+	assert.False(t, introspectResp.GetActive())
+
+	// An admin may revoke any of them.
+	_, err = st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+		Token:       token,
+		AppId:       appID,
+		RevokeToken: second,
+	})
+	require.NoError(t, err)
+
+	introspectResp, err = st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{Token: second, AppId: appID})
+	require.NoError(t, err)
+	assert.False(t, introspectResp.GetActive())
+
+	introspectResp, err = st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{Token: first, AppId: appID})
+	require.NoError(t, err)
+	assert.True(t, introspectResp.GetActive())
+}
+
+func TestManageServiceClientsWithoutPermission(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    int32(st.Cfg.Apps.AdminAppID),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AppsClient.CreateServiceClient(ctx, &ssov1.CreateServiceClientRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+		Name:  "worker",
+		Scope: "billing:read",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AppsClient.DeleteServiceClient(ctx, &ssov1.DeleteServiceClientRequest{
+		Token:    loginResp.GetAccessToken(),
+		ClientId: gofakeit.UUID(),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+// createServiceClient creates a service client of the app with the scope
+// and audiences and returns its id and secret.
+func TestClientSecretHash(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	clientID, clientSecret := createServiceClient(t, ctx, st, token, appID, "billing:read")
+
+	storedHash := func() string {
+		var hash string
+		require.NoError(t, st.DB().QueryRow(ctx, `SELECT secret_hash FROM service_client WHERE id = $1;`, clientID).Scan(&hash))
+		return hash
+	}
+	assert.Equal(t, secret.Hash(clientSecret), storedHash())
+
+	// A client created while secrets were hashed with bcrypt keeps working
+	// and gets the plain hash on its first request.
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.DB().Exec(ctx, `UPDATE service_client SET secret_hash = $2 WHERE id = $1;`, clientID, string(legacyHash))
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+		ClientId:     clientID,
+		ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+	})
+	requireStatus(t, ErrInvalidClient, err)
+	assert.Equal(t, string(legacyHash), storedHash())
+
+	for range 2 {
+		_, err = st.AuthClient.ClientCredentials(ctx, &ssov1.ClientCredentialsRequest{
+			ClientId:     clientID,
+			ClientSecret: clientSecret,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, secret.Hash(clientSecret), storedHash())
+	}
+}
+
+func createServiceClient(t *testing.T, ctx context.Context, st *suite.Suite, token string, appID int32, scope string, audiences ...int32) (string, string) {
+	t.Helper()
+
+	createResp, err := st.AppsClient.CreateServiceClient(ctx, &ssov1.CreateServiceClientRequest{
+		Token:     token,
+		AppId:     appID,
+		Name:      "client " + gofakeit.UUID(),
+		Scope:     scope,
+		Audiences: audiences,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, createResp.GetClientId())
+	require.NotEmpty(t, createResp.GetClientSecret())
+
+	return createResp.GetClientId(), createResp.GetClientSecret()
+}
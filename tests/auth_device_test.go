@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"encoding/json"
+	"grpc/tests/suite"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrAuthorizationPending = status.Error(codes.FailedPrecondition, "authorization pending")
+	ErrSlowDown             = status.Error(codes.ResourceExhausted, "slow down")
+	ErrAccessDenied         = status.Error(codes.PermissionDenied, "access denied")
+	ErrInvalidGrant         = status.Error(codes.InvalidArgument, "invalid grant")
+)
+
+func TestDeviceAuthorization(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	authResp, err := st.AuthClient.DeviceAuthorization(ctx, &ssov1.DeviceAuthorizationRequest{
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, authResp.GetDeviceCode())
+	assert.Len(t, authResp.GetUserCode(), 9)
+	assert.Equal(t, st.Cfg.JWT.Issuer+"/device", authResp.GetVerificationUri())
+	assert.Contains(t, authResp.GetVerificationUriComplete(), url.Values{"user_code": {authResp.GetUserCode()}}.Encode())
+	assert.Equal(t, int64(st.Cfg.OAuth.DeviceCodeExpires.Seconds()), authResp.GetExpiresIn())
+	assert.Equal(t, int64(st.Cfg.OAuth.DevicePollInterval.Seconds()), authResp.GetInterval())
+
+	// The device polls before the user decided, then too soon.
+	_, err = st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	requireStatus(t, ErrAuthorizationPending, err)
+
+	_, err = st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	requireStatus(t, ErrSlowDown, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ApproveDevice(ctx, &ssov1.ApproveDeviceRequest{
+		Token:    loginResp.GetAccessToken(),
+		UserCode: authResp.GetUserCode(),
+	})
+	require.NoError(t, err)
+
+	// A device of another app cannot use up the code.
+	_, err = st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID + 1,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	requireStatus(t, ErrInvalidGrant, err)
+
+	tokenResp, err := st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokenResp.GetAccessToken())
+	assert.NotEmpty(t, tokenResp.GetRefreshToken())
+
+	currentResp, err := st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: tokenResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.GetEmail(), currentResp.GetEmail())
+
+	// The device code is used up once the tokens were issued.
+	_, err = st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	requireStatus(t, ErrInvalidGrant, err)
+}
+
+func TestDeviceAuthorizationDenied(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	authResp, err := st.AuthClient.DeviceAuthorization(ctx, &ssov1.DeviceAuthorizationRequest{
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ApproveDevice(ctx, &ssov1.ApproveDeviceRequest{
+		Token:    loginResp.GetAccessToken(),
+		UserCode: authResp.GetUserCode(),
+		Deny:     true,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.DeviceToken(ctx, &ssov1.DeviceTokenRequest{
+		AppId:      appID,
+		DeviceCode: authResp.GetDeviceCode(),
+	})
+	requireStatus(t, ErrAccessDenied, err)
+}
+
+func TestDeviceAuthorizationVerificationPage(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	resp, err := http.PostForm(st.HTTPURL("/device_authorization"), url.Values{
+		"client_id": {strconv.Itoa(appID)},
+		"scope":     {"openid profile"},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var auth struct {
+		DeviceCode string `json:"device_code"`
+		UserCode   string `json:"user_code"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&auth))
+
+	pending := postToken(t, st, http.DefaultClient, deviceTokenForm(auth.DeviceCode))
+	assert.Equal(t, http.StatusBadRequest, pending.status)
+	assert.Equal(t, "authorization_pending", pending.Error)
+
+	// The page names the app and the scope before the user signs in.
+	pageResp, err := http.Get(st.HTTPURL("/device?" + url.Values{"user_code": {auth.UserCode}}.Encode()))
+	require.NoError(t, err)
+	page, err := io.ReadAll(pageResp.Body)
+	pageResp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, pageResp.StatusCode)
+	assert.Contains(t, string(page), "test app")
+	assert.Contains(t, string(page), "openid profile")
+	assert.Contains(t, string(page), `name="password"`)
+
+	pageResp, err = http.Get(st.HTTPURL("/device?" + url.Values{"user_code": {"BCDF-GHJK"}}.Encode()))
+	require.NoError(t, err)
+	pageResp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, pageResp.StatusCode)
+
+	// A wrong password shows the page again without deciding.
+	pageResp, err = http.PostForm(st.HTTPURL("/device"), url.Values{
+		"user_code": {auth.UserCode},
+		"email":     {user.GetEmail()},
+		"password":  {gofakeit.Password(true, true, true, false, false, 12)},
+		"action":    {"approve"},
+	})
+	require.NoError(t, err)
+	pageResp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, pageResp.StatusCode)
+
+	// The user may type the code in lower case and without the separator.
+	pageResp, err = http.PostForm(st.HTTPURL("/device"), url.Values{
+		"user_code": {strings.ToLower(strings.ReplaceAll(auth.UserCode, "-", ""))},
+		"email":     {user.GetEmail()},
+		"password":  {user.GetPassword()},
+		"action":    {"approve"},
+	})
+	require.NoError(t, err)
+	pageResp.Body.Close()
+	require.Equal(t, http.StatusOK, pageResp.StatusCode)
+
+	tokens := postToken(t, st, http.DefaultClient, deviceTokenForm(auth.DeviceCode))
+	assert.Equal(t, http.StatusOK, tokens.status)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+}
+
+func deviceTokenForm(deviceCode string) url.Values {
+	return url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {strconv.Itoa(appID)},
+		"device_code": {deviceCode},
+	}
+}
@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"grpc/internal/domain/models"
+	"grpc/tests/suite"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const verificationSubject = "Verify your email address"
+
+var ErrEmailNotVerified = status.Error(codes.FailedPrecondition, "email not verified")
+
+var tokenParam = regexp.MustCompile(`[?&]token=([A-Za-z0-9_-]+)`)
+
+func TestVerifyEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	verifiedEmailAppID := createApp(t, ctx, st, adminToken(t, ctx, st), true)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginReq := &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    verifiedEmailAppID,
+	}
+
+	_, err = st.AuthClient.Login(ctx, loginReq)
+	requireStatus(t, ErrEmailNotVerified, err)
+
+	// Other apps let the user in and report the email as not verified.
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	currentResp, err := st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.False(t, currentResp.GetEmailVerified())
+
+	body := lastMail(t, st, user.GetEmail(), verificationSubject)
+	assert.Contains(t, body, st.Cfg.EmailVerification.URL)
+	match := tokenParam.FindStringSubmatch(body)
+	require.NotNil(t, match)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: match[1]})
+	require.NoError(t, err)
+
+	// A token is used once.
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: match[1]})
+	requireStatus(t, ErrInvalidData, err)
+
+	verifiedResp, err := st.AuthClient.Login(ctx, loginReq)
+	require.NoError(t, err)
+
+	currentResp, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: verifiedResp.GetAccessToken(),
+		AppId: verifiedEmailAppID,
+	})
+	require.NoError(t, err)
+	assert.True(t, currentResp.GetEmailVerified())
+}
+
+func TestSendVerificationEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	// A mail was sent on registration, so this one waits for the resend
+	// interval, and the first link keeps working.
+	_, err = st.AuthClient.SendVerificationEmail(ctx, &ssov1.SendVerificationEmailRequest{Email: user.GetEmail()})
+	require.NoError(t, err)
+
+	match := tokenParam.FindStringSubmatch(lastMail(t, st, user.GetEmail(), verificationSubject))
+	require.NotNil(t, match)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: match[1]})
+	require.NoError(t, err)
+
+	// Unknown addresses are not told apart from registered ones.
+	_, err = st.AuthClient.SendVerificationEmail(ctx, &ssov1.SendVerificationEmailRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+}
+
+func TestVerifiedEmailRequiredForTokens(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	app := createApp(t, ctx, st, token, false)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	grantRole(t, ctx, st, registerResp.GetUserId(), int(app), createRole(t, ctx, st, int(app), "orders:read"))
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    app,
+	})
+	require.NoError(t, err)
+
+	// Sessions started before the app required a verified email end on the
+	// next refresh.
+	_, err = st.AppsClient.UpdateApp(ctx, &ssov1.UpdateAppRequest{
+		Token:                      token,
+		AppId:                      app,
+		Name:                       "app " + gofakeit.UUID(),
+		RequireVerifiedEmail:       true,
+		UpdateRequireVerifiedEmail: true,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: app,
+	})
+	requireStatus(t, ErrEmailNotVerified, err)
+
+	// Nor can a token of another app be exchanged for one of the app.
+	clientID, clientSecret := createServiceClient(t, ctx, st, token, appID, "", app)
+	appLoginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		SubjectToken: appLoginResp.GetAccessToken(),
+		Audience:     app,
+		Scope:        "orders:read",
+	})
+	requireStatus(t, ErrEmailNotVerified, err)
+
+	// Nor can an admin of the app impersonate the user.
+	admin := generateFakeUsers(1)[0]
+	adminResp, err := st.AuthClient.Register(ctx, admin)
+	require.NoError(t, err)
+	grantRole(t, ctx, st, adminResp.GetUserId(), int(app), models.RoleAdmin)
+	_, err = st.DB().Exec(ctx, `UPDATE public.user SET email_verified = TRUE WHERE id = $1;`, adminResp.GetUserId())
+	require.NoError(t, err)
+
+	adminLoginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    admin.GetEmail(),
+		Password: admin.GetPassword(),
+		AppId:    app,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  adminLoginResp.GetAccessToken(),
+		AppId:  app,
+		UserId: registerResp.GetUserId(),
+		Reason: gofakeit.Sentence(5),
+	})
+	requireStatus(t, ErrEmailNotVerified, err)
+}
+
+func TestVerifyEmailValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.SendVerificationEmail(ctx, &ssov1.SendVerificationEmailRequest{})
+	requireStatus(t, ErrEmptyEmail, err)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: gofakeit.UUID()})
+	requireStatus(t, ErrInvalidData, err)
+}
+
+// lastMail waits for a mail with the subject to the address in the mail
+// directory of the server and returns the text of the latest one.
+func lastMail(t *testing.T, st *suite.Suite, to string, subject string) string {
+	t.Helper()
+
+	dir := filepath.Join("..", st.Cfg.Mail.Dir)
+
+	var body string
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+
+		// File names start with the time the mail was written.
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".eml") && !strings.HasPrefix(entry.Name(), ".") {
+				names = append(names, entry.Name())
+			}
+		}
+		slices.Sort(names)
+		slices.Reverse(names)
+
+		for _, name := range names {
+			if text, ok := readMail(filepath.Join(dir, name), to, subject); ok {
+				body = text
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+
+	return body
+}
+
+// readMail returns the text of the mail in the file if it has the
+// recipient and subject.
+func readMail(path string, to string, subject string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		return "", false
+	}
+
+	recipient, err := mail.ParseAddress(msg.Header.Get("To"))
+	if err != nil || !strings.EqualFold(recipient.Address, to) {
+		return "", false
+	}
+	decodedSubject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || decodedSubject != subject {
+		return "", false
+	}
+
+	body, err := textPart(msg.Header.Get("Content-Type"), msg.Body)
+	if err != nil {
+		return "", false
+	}
+
+	return body, true
+}
+
+// textPart returns the plain text of a quoted printable body, which may be
+// the first part of a multipart/alternative one.
+func textPart(contentType string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		part, err := multipart.NewReader(body, params["boundary"]).NextRawPart()
+		if err != nil {
+			return "", err
+		}
+		return textPart(part.Header.Get("Content-Type"), part)
+	}
+
+	text, err := io.ReadAll(quotedprintable.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	return string(text), nil
+}
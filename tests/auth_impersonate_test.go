@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"grpc/internal/domain/models"
+	"grpc/tests/suite"
+	"strconv"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestImpersonate(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	adminID := decodeAccessToken(t, st, token).UserID
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	reason := gofakeit.Sentence(5)
+	impersonateResp, err := st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  token,
+		AppId:  appID,
+		UserId: registerResp.GetUserId(),
+		Reason: reason,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(st.Cfg.JWT.ImpersonationExpires.Seconds()), impersonateResp.GetExpiresIn())
+
+	impersonation := impersonateResp.GetAccessToken()
+	data := decodeAccessToken(t, st, impersonation)
+	assert.Equal(t, registerResp.GetUserId(), data.UserID)
+	assert.Empty(t, data.SessionID)
+	require.NotNil(t, data.Actor)
+	assert.Equal(t, strconv.FormatInt(adminID, 10), data.Actor.Subject)
+	assert.Equal(t, adminID, data.Actor.UserID)
+
+	// The app sees the user.
+	currentResp, err := st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: impersonation,
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.GetEmail(), currentResp.GetEmail())
+
+	// Issuing and using the token were audited.
+	rows, err := st.DB().Query(ctx, `
+		SELECT event, actor_id, user_id, reason FROM impersonation_audit
+		WHERE token_id = $1 ORDER BY id;
+	`, data.ID)
+	require.NoError(t, err)
+	var events []models.ImpersonationEvent
+	for rows.Next() {
+		var event models.ImpersonationEvent
+		require.NoError(t, rows.Scan(&event.Event, &event.ActorID, &event.UserID, &event.Reason))
+		events = append(events, event)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, events, 2)
+	assert.Equal(t, models.ImpersonationEvent{
+		Event:   models.ImpersonationIssued,
+		ActorID: adminID,
+		UserID:  registerResp.GetUserId(),
+		Reason:  reason,
+	}, events[0])
+	assert.Equal(t, models.ImpersonationUsed, events[1].Event)
+	assert.Equal(t, adminID, events[1].ActorID)
+
+	// The token cannot be refreshed, start sessions or act for the user
+	// elsewhere.
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: impersonation,
+		AppId: appID,
+	})
+	require.Error(t, err)
+
+	authResp, err := st.AuthClient.DeviceAuthorization(ctx, &ssov1.DeviceAuthorizationRequest{AppId: appID})
+	require.NoError(t, err)
+	_, err = st.AuthClient.ApproveDevice(ctx, &ssov1.ApproveDeviceRequest{
+		Token:    impersonation,
+		UserCode: authResp.GetUserCode(),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	clientID, clientSecret := createServiceClient(t, ctx, st, token, appID, "", appID)
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		SubjectToken: impersonation,
+		Audience:     appID,
+		Scope:        "profile:read",
+	})
+	requireStatus(t, ErrInvalidGrant, err)
+
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{Token: impersonation, AppId: appID})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.LogoutAll(ctx, &ssov1.LogoutAllRequest{Token: impersonation, AppId: appID})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+		Token:       impersonation,
+		AppId:       appID,
+		RevokeToken: impersonation,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestImpersonateAdmin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	otherAdmin := decodeAccessToken(t, st, adminToken(t, ctx, st)).UserID
+
+	_, err := st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  token,
+		AppId:  appID,
+		UserId: otherAdmin,
+		Reason: gofakeit.Sentence(5),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestImpersonateMorePrivilegedUser(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	users := generateFakeUsers(2)
+
+	callerResp, err := st.AuthClient.Register(ctx, users[0])
+	require.NoError(t, err)
+	grantRole(t, ctx, st, callerResp.GetUserId(), appID, createRole(t, ctx, st, appID, "users:impersonate"))
+
+	targetResp, err := st.AuthClient.Register(ctx, users[1])
+	require.NoError(t, err)
+	grantRole(t, ctx, st, targetResp.GetUserId(), appID, createRole(t, ctx, st, appID, "roles:manage"))
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    users[0].Email,
+		Password: users[0].Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	// The caller cannot gain roles:manage by acting as the user.
+	_, err = st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  loginResp.GetAccessToken(),
+		AppId:  appID,
+		UserId: targetResp.GetUserId(),
+		Reason: gofakeit.Sentence(5),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestImpersonationTokenCannotManage(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	adminAppID := st.Cfg.Apps.AdminAppID
+
+	registerResp, err := st.AuthClient.Register(ctx, generateFakeUsers(1)[0])
+	require.NoError(t, err)
+	userID := registerResp.GetUserId()
+	grantRole(t, ctx, st, userID, adminAppID, createRole(t, ctx, st, adminAppID, "roles:manage", "apps:manage"))
+
+	impersonateResp, err := st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  token,
+		AppId:  int32(adminAppID),
+		UserId: userID,
+		Reason: gofakeit.Sentence(5),
+	})
+	require.NoError(t, err)
+	impersonation := impersonateResp.GetAccessToken()
+
+	// The token acts for the user, not with the rights of the user.
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  impersonation,
+		AppId:  int32(adminAppID),
+		UserId: userID,
+		Role:   models.RoleAdmin,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: impersonation,
+		Name:  "app " + gofakeit.UUID(),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestImpersonateWithoutPermission(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	users := generateFakeUsers(2)
+
+	_, err := st.AuthClient.Register(ctx, users[0])
+	require.NoError(t, err)
+
+	targetResp, err := st.AuthClient.Register(ctx, users[1])
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    users[0].Email,
+		Password: users[0].Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  loginResp.GetAccessToken(),
+		AppId:  appID,
+		UserId: targetResp.GetUserId(),
+		Reason: gofakeit.Sentence(5),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestImpersonateValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name        string
+		request     *ssov1.ImpersonateRequest
+		expectedErr error
+	}{
+		{
+			name: "empty user id",
+			request: &ssov1.ImpersonateRequest{
+				Token:  gofakeit.UUID(),
+				AppId:  appID,
+				Reason: gofakeit.Sentence(5),
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "empty user id"),
+		},
+		{
+			name: "empty reason",
+			request: &ssov1.ImpersonateRequest{
+				Token:  gofakeit.UUID(),
+				AppId:  appID,
+				UserId: gofakeit.Int64(),
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "empty reason"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Impersonate(ctx, tt.request)
+			requireStatus(t, tt.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"strconv"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	access, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	require.True(t, access.GetActive())
+	assert.Equal(t, "access_token", access.GetTokenType())
+	assert.Equal(t, registerResp.GetUserId(), access.GetUserId())
+	assert.Equal(t, strconv.FormatInt(registerResp.GetUserId(), 10), access.GetSub())
+	assert.Equal(t, int32(appID), access.GetAppId())
+	assert.NotEmpty(t, access.GetSid())
+	assert.NotEmpty(t, access.GetJti())
+	assert.Greater(t, access.GetExp(), int64(0))
+
+	refresh, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token:         loginResp.GetRefreshToken(),
+		AppId:         appID,
+		TokenTypeHint: "refresh_token",
+	})
+	require.NoError(t, err)
+	require.True(t, refresh.GetActive())
+	assert.Equal(t, "refresh_token", refresh.GetTokenType())
+	assert.Equal(t, access.GetSid(), refresh.GetSid())
+
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	for _, token := range []string{loginResp.GetAccessToken(), loginResp.GetRefreshToken()} {
+		resp, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+			Token: token,
+			AppId: appID,
+		})
+		require.NoError(t, err)
+		assert.False(t, resp.GetActive())
+		assert.Empty(t, resp.GetSub())
+	}
+}
+
+func TestIntrospectInvalidToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	resp, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token: "invalid token",
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.GetActive())
+}
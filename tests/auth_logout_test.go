@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogout(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginReq := &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	}
+
+	first, err := st.AuthClient.Login(ctx, loginReq)
+	require.NoError(t, err)
+	second, err := st.AuthClient.Login(ctx, loginReq)
+	require.NoError(t, err)
+
+	logoutResp, err := st.AuthClient.LogoutAll(ctx, &ssov1.LogoutAllRequest{
+		Token: first.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), logoutResp.GetSessions())
+
+	for _, tokens := range []*ssov1.LoginResponse{first, second} {
+		_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+			Token: tokens.GetAccessToken(),
+			AppId: appID,
+		})
+		requireStatus(t, ErrUnauthorized, err)
+	}
+}
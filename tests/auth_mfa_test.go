@@ -0,0 +1,284 @@
+package tests
+
+import (
+	"context"
+	"grpc/internal/lib/totp"
+	"grpc/tests/suite"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrInvalidMFACode     = status.Error(codes.InvalidArgument, "invalid mfa code")
+	ErrMFAAlreadyEnrolled = status.Error(codes.AlreadyExists, "mfa already enrolled")
+)
+
+var challengeIDInput = regexp.MustCompile(`name="challenge_id" value="([^"]+)"`)
+
+func TestMFALogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	secret, recoveryCodes, step := enrollTOTP(t, ctx, st, user)
+	assert.Len(t, recoveryCodes, st.Cfg.MFA.RecoveryCodes)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, loginResp.GetAccessToken())
+	assert.Empty(t, loginResp.GetRefreshToken())
+	require.NotEmpty(t, loginResp.GetMfaChallengeId())
+
+	// The code the authenticator was confirmed with cannot be used again.
+	usedCode, err := totp.Code(secret, step)
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		ChallengeId: loginResp.GetMfaChallengeId(),
+		Code:        usedCode,
+		AppId:       appID,
+	})
+	requireStatus(t, ErrInvalidMFACode, err)
+
+	nextCode, err := totp.Code(secret, step+1)
+	require.NoError(t, err)
+
+	verifyResp, err := st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		ChallengeId: loginResp.GetMfaChallengeId(),
+		Code:        nextCode,
+		AppId:       appID,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, verifyResp.GetRefreshToken())
+
+	currentResp, err := st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: verifyResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.GetEmail(), currentResp.GetEmail())
+
+	// A challenge is answered once.
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		ChallengeId: loginResp.GetMfaChallengeId(),
+		Code:        nextCode,
+		AppId:       appID,
+	})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The second factor cannot be enrolled twice.
+	_, err = st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{
+		Token: verifyResp.GetAccessToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrMFAAlreadyEnrolled, err)
+}
+
+func TestMFARecoveryCode(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	_, recoveryCodes, _ := enrollTOTP(t, ctx, st, user)
+
+	// Recovery codes may be typed in any case and without the separators.
+	code := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+
+	for i, wantErr := range []bool{false, true} {
+		loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+			Email:    user.GetEmail(),
+			Password: user.GetPassword(),
+			AppId:    appID,
+		})
+		require.NoError(t, err)
+
+		verifyResp, err := st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+			ChallengeId: loginResp.GetMfaChallengeId(),
+			Code:        code,
+			AppId:       appID,
+		})
+		if wantErr {
+			requireStatus(t, ErrInvalidMFACode, err, "attempt %d", i)
+			continue
+		}
+		require.NoError(t, err)
+		assert.NotEmpty(t, verifyResp.GetAccessToken())
+	}
+}
+
+func TestMFAChallengeAttempts(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	secret, _, step := enrollTOTP(t, ctx, st, user)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	for range st.Cfg.MFA.MaxAttempts {
+		_, err := st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+			ChallengeId: loginResp.GetMfaChallengeId(),
+			Code:        gofakeit.DigitN(6),
+			AppId:       appID,
+		})
+		require.Error(t, err)
+	}
+
+	// Out of attempts, even the right code does not pass.
+	code, err := totp.Code(secret, step+1)
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		ChallengeId: loginResp.GetMfaChallengeId(),
+		Code:        code,
+		AppId:       appID,
+	})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestMFALoginPage(t *testing.T) {
+	ctx, st := suite.New(t)
+	client := noRedirectClient()
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	secret, _, step := enrollTOTP(t, ctx, st, user)
+
+	verifier := gofakeit.Password(true, true, true, false, false, 64)
+	params := authorizeParams(verifier, "")
+
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	form.Set("email", user.GetEmail())
+	form.Set("password", user.GetPassword())
+
+	// The password alone shows the page again, asking for a code.
+	resp, err := client.PostForm(st.HTTPURL("/authorize"), form)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	match := challengeIDInput.FindSubmatch(body)
+	require.NotNil(t, match)
+
+	code, err := totp.Code(secret, step+1)
+	require.NoError(t, err)
+
+	form.Del("email")
+	form.Del("password")
+	form.Set("challenge_id", string(match[1]))
+	form.Set("mfa_code", code)
+
+	resp, err = client.PostForm(st.HTTPURL("/authorize"), form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	tokens := exchangeCode(t, st, client, location.Query().Get("code"), verifier)
+	assert.Equal(t, http.StatusOK, tokens.status)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
+
+func TestMFAValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{AppId: appID})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{
+		Token: gofakeit.UUID(),
+		AppId: appID,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		ChallengeId: gofakeit.UUID(),
+		Code:        gofakeit.DigitN(6),
+		AppId:       appID,
+	})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// enrollTOTP enrolls a TOTP authenticator for the user and returns its
+// secret, the recovery codes and the time step of the code it was
+// confirmed with.
+func enrollTOTP(t *testing.T, ctx context.Context, st *suite.Suite, user *ssov1.RegisterRequest) (string, []string, int64) {
+	t.Helper()
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	enrollResp, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, enrollResp.GetSecret())
+
+	uri, err := url.Parse(enrollResp.GetOtpauthUri())
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, enrollResp.GetSecret(), uri.Query().Get("secret"))
+	assert.Equal(t, st.Cfg.MFA.Issuer, uri.Query().Get("issuer"))
+
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+		Code:  "000000x",
+	})
+	requireStatus(t, ErrInvalidMFACode, err)
+
+	step := totp.Step(time.Now())
+	code, err := totp.Code(enrollResp.GetSecret(), step)
+	require.NoError(t, err)
+
+	confirmResp, err := st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+		Code:  code,
+	})
+	require.NoError(t, err)
+
+	return enrollResp.GetSecret(), confirmResp.GetRecoveryCodes(), step
+}
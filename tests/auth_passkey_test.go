@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"grpc/tests/authenticator"
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPasskeyLogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	passkey := registerPasskey(t, ctx, st, user)
+
+	assertion := passkeyAssertion(t, ctx, st, passkey)
+	loginResp, err := st.AuthClient.FinishPasskeyLogin(ctx, assertion)
+	require.NoError(t, err)
+	assert.NotEmpty(t, loginResp.GetRefreshToken())
+
+	currentResp, err := st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.GetEmail(), currentResp.GetEmail())
+
+	// A response is accepted once.
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, assertion)
+	requireStatus(t, ErrUnauthorized, err)
+
+	// The passkey is excluded when the user registers another one.
+	optionsResp, err := st.AuthClient.BeginPasskeyRegistration(ctx, &ssov1.BeginPasskeyRegistrationRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	var options struct {
+		ExcludeCredentials []struct {
+			ID string `json:"id"`
+		} `json:"excludeCredentials"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(optionsResp.GetOptions()), &options))
+	require.Len(t, options.ExcludeCredentials, 1)
+}
+
+func TestPasskeyLoginSkipsMFA(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	passkey := registerPasskey(t, ctx, st, user)
+	enrollTOTP(t, ctx, st, user)
+
+	// The authenticator verified the user, so no second factor is asked.
+	loginResp, err := st.AuthClient.FinishPasskeyLogin(ctx, passkeyAssertion(t, ctx, st, passkey))
+	require.NoError(t, err)
+	assert.NotEmpty(t, loginResp.GetAccessToken())
+}
+
+func TestPasskeyClonedCredential(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	passkey := registerPasskey(t, ctx, st, user)
+	clone := passkey.Clone()
+
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, passkeyAssertion(t, ctx, st, passkey))
+	require.NoError(t, err)
+
+	// The copy signs with a counter the server has seen already.
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, passkeyAssertion(t, ctx, st, clone))
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, passkeyAssertion(t, ctx, st, passkey))
+	require.NoError(t, err)
+}
+
+func TestPasskeyWrongOrigin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	passkey := registerPasskey(t, ctx, st, user)
+	passkey.Origin = "https://" + gofakeit.DomainName()
+
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, passkeyAssertion(t, ctx, st, passkey))
+	requireStatus(t, ErrUnauthorized, err)
+
+	// A passkey created for another origin is not stored.
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	optionsResp, err := st.AuthClient.BeginPasskeyRegistration(ctx, &ssov1.BeginPasskeyRegistrationRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	attestation, err := authenticator.New(passkey.Origin).Create(optionsResp.GetOptions())
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.FinishPasskeyRegistration(ctx, &ssov1.FinishPasskeyRegistrationRequest{
+		Token:             loginResp.GetAccessToken(),
+		AppId:             appID,
+		ClientDataJson:    attestation.ClientDataJSON,
+		AttestationObject: attestation.AttestationObject,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPasskeyValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.BeginPasskeyRegistration(ctx, &ssov1.BeginPasskeyRegistrationRequest{AppId: appID})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.FinishPasskeyRegistration(ctx, &ssov1.FinishPasskeyRegistrationRequest{
+		Token: gofakeit.UUID(),
+		AppId: appID,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.BeginPasskeyLogin(ctx, &ssov1.BeginPasskeyLoginRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, &ssov1.FinishPasskeyLoginRequest{
+		AppId:        appID,
+		CredentialId: []byte(gofakeit.UUID()),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// registerPasskey registers a passkey of a new software authenticator for
+// the user and returns the authenticator.
+func registerPasskey(t *testing.T, ctx context.Context, st *suite.Suite, user *ssov1.RegisterRequest) *authenticator.Authenticator {
+	t.Helper()
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	optionsResp, err := st.AuthClient.BeginPasskeyRegistration(ctx, &ssov1.BeginPasskeyRegistrationRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	passkey := authenticator.New(st.Cfg.WebAuthn.Origins[0])
+	attestation, err := passkey.Create(optionsResp.GetOptions())
+	require.NoError(t, err)
+
+	finishResp, err := st.AuthClient.FinishPasskeyRegistration(ctx, &ssov1.FinishPasskeyRegistrationRequest{
+		Token:             loginResp.GetAccessToken(),
+		AppId:             appID,
+		ClientDataJson:    attestation.ClientDataJSON,
+		AttestationObject: attestation.AttestationObject,
+		Transports:        []string{"internal", "hybrid"},
+		Name:              gofakeit.Word(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(attestation.CredentialID), finishResp.GetCredentialId())
+
+	// Each challenge registers one passkey.
+	_, err = st.AuthClient.FinishPasskeyRegistration(ctx, &ssov1.FinishPasskeyRegistrationRequest{
+		Token:             loginResp.GetAccessToken(),
+		AppId:             appID,
+		ClientDataJson:    attestation.ClientDataJSON,
+		AttestationObject: attestation.AttestationObject,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	return passkey
+}
+
+// passkeyAssertion starts a passkey login and returns the answer of the
+// authenticator to it.
+func passkeyAssertion(t *testing.T, ctx context.Context, st *suite.Suite, passkey *authenticator.Authenticator) *ssov1.FinishPasskeyLoginRequest {
+	t.Helper()
+
+	optionsResp, err := st.AuthClient.BeginPasskeyLogin(ctx, &ssov1.BeginPasskeyLoginRequest{AppId: appID})
+	require.NoError(t, err)
+
+	assertion, err := passkey.Get(optionsResp.GetOptions())
+	require.NoError(t, err)
+
+	return &ssov1.FinishPasskeyLoginRequest{
+		AppId:             appID,
+		CredentialId:      assertion.CredentialID,
+		ClientDataJson:    assertion.ClientDataJSON,
+		AuthenticatorData: assertion.AuthenticatorData,
+		Signature:         assertion.Signature,
+		UserHandle:        assertion.UserHandle,
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name     string
+		password string
+		rules    []string
+	}{
+		{
+			name:     "too short",
+			password: "123",
+			rules:    []string{"min_length", "strength"},
+		},
+		{
+			name:     "common password",
+			password: "password",
+			rules:    []string{"strength"},
+		},
+		{
+			name:     "keyboard sequence",
+			password: "qwerty123456",
+			rules:    []string{"strength"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+				Email:    gofakeit.Email(),
+				Password: tt.password,
+				Name:     gofakeit.FirstName(),
+			})
+			require.Error(t, err)
+
+			rules := policyViolations(t, err)
+			assert.ElementsMatch(t, tt.rules, rules)
+		})
+	}
+}
+
+func TestRegisterPasswordWithUserInfo(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	name := gofakeit.FirstName() + gofakeit.LetterN(4)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    gofakeit.Email(),
+		Password: name + "#" + gofakeit.Password(true, true, true, false, false, 12),
+		Name:     name,
+	})
+	require.Error(t, err)
+	assert.Contains(t, policyViolations(t, err), "user_info")
+}
+
+// policyViolations returns the rules reported in the ErrorInfo of a weak
+// password error and checks that every rule has a field violation.
+func policyViolations(t *testing.T, err error) []string {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Equal(t, "weak password", st.Message())
+
+	var (
+		rules      []string
+		violations int
+	)
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				assert.Equal(t, "password", violation.GetField())
+				assert.NotEmpty(t, violation.GetDescription())
+			}
+			violations = len(detail.GetFieldViolations())
+		case *errdetails.ErrorInfo:
+			assert.Equal(t, "PASSWORD_POLICY", detail.GetReason())
+			for rule := range detail.GetMetadata() {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	require.Equal(t, len(rules), violations)
+
+	return rules
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	passwordResetSubject = "Reset your password"
+	passwordResetNotice  = "Your password was reset"
+)
+
+func TestPasswordReset(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	impersonateResp, err := st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{
+		Token:  adminToken(t, ctx, st),
+		AppId:  appID,
+		UserId: registerResp.GetUserId(),
+		Reason: gofakeit.Sentence(5),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: user.GetEmail()})
+	require.NoError(t, err)
+
+	body := lastMail(t, st, user.GetEmail(), passwordResetSubject)
+	assert.Contains(t, body, st.Cfg.PasswordReset.URL)
+	match := tokenParam.FindStringSubmatch(body)
+	require.NotNil(t, match)
+
+	// The new password must meet the policy, and a rejected one does not
+	// use up the token.
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{
+		Token:    match[1],
+		Password: "Tr0ub4dor&3",
+	})
+	require.Error(t, err)
+	assert.Equal(t, []string{"breached"}, policyViolations(t, err))
+
+	newPassword := randomFakePassword()
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{
+		Token:    match[1],
+		Password: newPassword,
+	})
+	require.NoError(t, err)
+
+	// A token is used once.
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{
+		Token:    match[1],
+		Password: randomFakePassword(),
+	})
+	requireStatus(t, ErrInvalidData, err)
+
+	lastMail(t, st, user.GetEmail(), passwordResetNotice)
+
+	// Everyone signed in with the old password is signed out.
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: loginResp.GetAccessToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: impersonateResp.GetAccessToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: user.GetPassword(),
+		AppId:    appID,
+	})
+	requireStatus(t, ErrInvPassOrEmail, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.GetEmail(),
+		Password: newPassword,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+}
+
+func TestRequestPasswordResetUnknownEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// Unknown addresses are not told apart from registered ones.
+	_, err := st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+}
+
+func TestPasswordResetValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{})
+	requireStatus(t, ErrEmptyEmail, err)
+
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{Password: randomFakePassword()})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{Token: gofakeit.UUID()})
+	requireStatus(t, ErrEmptyPass, err)
+
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{
+		Token:    gofakeit.UUID(),
+		Password: randomFakePassword(),
+	})
+	requireStatus(t, ErrInvalidData, err)
+}
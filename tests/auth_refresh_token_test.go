@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrUnauthorized = status.Error(codes.Unauthenticated, "unauthorized")
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	refreshResp, err := st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshResp.GetAccessToken())
+	require.NotEqual(t, loginResp.GetRefreshToken(), refreshResp.GetRefreshToken())
+
+	// Presenting the consumed token again revokes the whole family, so the
+	// token issued by the first refresh stops working as well.
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: refreshResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+}
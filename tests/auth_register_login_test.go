@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"grpc/internal/lib/jwt"
 	"grpc/tests/suite"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,14 +13,15 @@ import (
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 const (
-	appID            = 1
-	appSecret        = "iYDFTuUHLIKyhads879fasyodfIRTUYDF"
-	appRefreshSecret = "fgsuyTERTCV7812RDCfasdTYFK78ghjlBuygsd78gliueBN"
+	appID            = suite.AppID
+	appSecret        = suite.AppSecret
+	appRefreshSecret = suite.AppRefreshSecret
 
 	passDefaultLength = 10
 	userCount         = 10
@@ -62,23 +65,62 @@ func TestAuthRegisterLogin(t *testing.T) {
 
 			token := loginResp.GetAccessToken()
 			refreshToken := loginResp.GetRefreshToken()
-			data, err := jwt.DecodeToken(token, appSecret)
+			opts := jwt.Options{
+				Issuer:    st.Cfg.JWT.Issuer,
+				Audience:  jwt.Audience(appID),
+				ClockSkew: st.Cfg.JWT.ClockSkew,
+			}
+			data, err := jwt.DecodeToken(token, opts, jwt.Key{Algorithm: jwt.AlgHS512, Secret: appSecret})
 			require.NoError(t, err)
-			refreshData, err := jwt.DecodeToken(refreshToken, appRefreshSecret)
+			refreshData, err := jwt.DecodeToken(refreshToken, opts, jwt.Key{Algorithm: jwt.AlgHS512, Secret: appRefreshSecret})
 			require.NoError(t, err)
 
 			assert.Equal(t, registerResp.GetUserId(), data.UserID)
 			assert.Equal(t, registerResp.GetUserId(), refreshData.UserID)
 			assert.Equal(t, appID, data.AppID)
 			assert.Equal(t, appID, refreshData.AppID)
+			assert.Equal(t, strconv.FormatInt(registerResp.GetUserId(), 10), data.Subject)
+			assert.NotEmpty(t, data.ID)
+			assert.NotEqual(t, data.ID, refreshData.ID)
 
 			const deltaSeconds = 2.0
-			assert.InDelta(t, loginTime.Add(st.Cfg.TokenExpires).Unix(), data.Expires, deltaSeconds)
-			assert.InDelta(t, loginTime.Add(st.Cfg.RefreshTokenExpires).Unix(), refreshData.Expires, deltaSeconds)
+			assert.InDelta(t, loginTime.Add(st.Cfg.TokenExpires).Unix(), data.ExpiresAt.Unix(), deltaSeconds)
+			assert.InDelta(t, loginTime.Add(st.Cfg.RefreshTokenExpires).Unix(), refreshData.ExpiresAt.Unix(), deltaSeconds)
+			assert.InDelta(t, loginTime.Unix(), data.IssuedAt.Unix(), deltaSeconds)
+			assert.InDelta(t, loginTime.Unix(), data.NotBefore.Unix(), deltaSeconds)
 		})
 	}
 }
 
+func TestLoginRehashesPassword(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	// Stand in for a user registered before the switch to argon2id.
+	legacy, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = st.DB().Exec(ctx, `UPDATE public.user SET hash_password = $2 WHERE id = $1;`, registerResp.GetUserId(), string(legacy))
+	require.NoError(t, err)
+
+	loginReq := &ssov1.LoginRequest{Email: user.Email, Password: user.Password, AppId: appID}
+	_, err = st.AuthClient.Login(ctx, loginReq)
+	require.NoError(t, err)
+
+	var hash string
+	require.NoError(t, st.DB().QueryRow(ctx, `SELECT hash_password FROM public.user WHERE id = $1;`, registerResp.GetUserId()).Scan(&hash))
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$"), hash)
+
+	_, err = st.AuthClient.Login(ctx, loginReq)
+	require.NoError(t, err)
+
+	loginReq.Password = user.Password + "x"
+	_, err = st.AuthClient.Login(ctx, loginReq)
+	requireStatus(t, ErrInvPassOrEmail, err)
+}
+
 func TestFailRegister(t *testing.T) {
 	ctx, st := suite.New(t)
 
@@ -142,7 +184,7 @@ func TestFailRegister(t *testing.T) {
 				require.NoError(t, err)
 				require.NotEmpty(t, registerResp.GetUserId())
 			} else {
-				require.Equal(t, test.err.Error(), err.Error())
+				requireStatus(t, test.err, err)
 				require.Empty(t, registerResp.GetUserId())
 			}
 		})
@@ -202,7 +244,7 @@ func TestFailLogin(t *testing.T) {
 			t.Parallel()
 
 			loginResp, err := st.AuthClient.Login(ctx, tt.request)
-			require.Equal(t, tt.err.Error(), err.Error())
+			requireStatus(t, tt.err, err)
 			require.Empty(t, loginResp.GetAccessToken())
 			require.Empty(t, loginResp.GetRefreshToken())
 		})
@@ -233,3 +275,14 @@ func randomFakePassword() string {
 		passDefaultLength,
 	)
 }
+
+// requireStatus checks that err is a gRPC status error with the code and
+// message of want.
+func requireStatus(t *testing.T, want error, err error, msgAndArgs ...any) {
+	t.Helper()
+
+	require.Error(t, err, msgAndArgs...)
+	expected := status.Convert(want)
+	require.Equal(t, expected.Code(), status.Code(err), msgAndArgs...)
+	require.Equal(t, expected.Message(), status.Convert(err).Message(), msgAndArgs...)
+}
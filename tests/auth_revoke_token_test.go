@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrPermissionDenied = status.Error(codes.PermissionDenied, "permission denied")
+
+func TestRevokeToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	users := generateFakeUsers(2)
+	owner, other := users[0], users[1]
+
+	for _, user := range users {
+		_, err := st.AuthClient.Register(ctx, user)
+		require.NoError(t, err)
+	}
+
+	login := func(user *ssov1.RegisterRequest) *ssov1.LoginResponse {
+		loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+			Email:    user.Email,
+			Password: user.Password,
+			AppId:    appID,
+		})
+		require.NoError(t, err)
+		return loginResp
+	}
+	first, second, foreign := login(owner), login(owner), login(other)
+
+	_, err := st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+		Token:       foreign.GetAccessToken(),
+		AppId:       appID,
+		RevokeToken: first.GetAccessToken(),
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+		Token:       first.GetAccessToken(),
+		AppId:       appID,
+		RevokeToken: second.GetAccessToken(),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: second.GetAccessToken(),
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+
+	introspectResp, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token: second.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.False(t, introspectResp.GetActive())
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: first.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,261 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRolesNewUser(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	userID := registerResp.GetUserId()
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	token := loginResp.GetAccessToken()
+
+	// Users may look up their own roles.
+	rolesResp, err := st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		Token:  token,
+		UserId: userID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, rolesResp.GetRoles())
+
+	permissionResp, err := st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+		Token:      token,
+		UserId:     userID,
+		AppId:      appID,
+		Permission: "roles:manage",
+	})
+	require.NoError(t, err)
+	assert.False(t, permissionResp.GetAllowed())
+
+	isAdminResp, err := st.AuthClient.IsAdmin(ctx, &ssov1.IsAdminRequest{
+		UserId: userID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	assert.False(t, isAdminResp.GetIsAdmin())
+}
+
+func TestAssignRole(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	userID := registerResp.GetUserId()
+
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  token,
+		AppId:  appID,
+		UserId: userID,
+		Role:   "admin",
+	})
+	require.NoError(t, err)
+
+	rolesResp, err := st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		Token:  token,
+		UserId: userID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	require.Len(t, rolesResp.GetRoles(), 1)
+	assert.Equal(t, "admin", rolesResp.GetRoles()[0].GetName())
+	assert.Equal(t, []string{"*"}, rolesResp.GetRoles()[0].GetPermissions())
+
+	permissionResp, err := st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+		Token:      token,
+		UserId:     userID,
+		AppId:      appID,
+		Permission: "roles:manage",
+	})
+	require.NoError(t, err)
+	assert.True(t, permissionResp.GetAllowed())
+
+	isAdminResp, err := st.AuthClient.IsAdmin(ctx, &ssov1.IsAdminRequest{
+		UserId: userID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	assert.True(t, isAdminResp.GetIsAdmin())
+
+	_, err = st.AuthClient.UnassignRole(ctx, &ssov1.UnassignRoleRequest{
+		Token:  token,
+		AppId:  appID,
+		UserId: userID,
+		Role:   "admin",
+	})
+	require.NoError(t, err)
+
+	rolesResp, err = st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		Token:  token,
+		UserId: userID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, rolesResp.GetRoles())
+
+	permissionResp, err = st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+		Token:      token,
+		UserId:     userID,
+		AppId:      appID,
+		Permission: "roles:manage",
+	})
+	require.NoError(t, err)
+	assert.False(t, permissionResp.GetAllowed())
+}
+
+func TestAssignRoleWithoutPermission(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	// A user cannot make itself an admin.
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  loginResp.GetAccessToken(),
+		AppId:  appID,
+		UserId: registerResp.GetUserId(),
+		Role:   "admin",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.UnassignRole(ctx, &ssov1.UnassignRoleRequest{
+		Token:  loginResp.GetAccessToken(),
+		AppId:  appID,
+		UserId: registerResp.GetUserId(),
+		Role:   "admin",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestAssignRoleBeyondCallerPermissions(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	userID := registerResp.GetUserId()
+	grantRole(t, ctx, st, userID, appID, createRole(t, ctx, st, appID, "roles:manage"))
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	token := loginResp.GetAccessToken()
+
+	otherResp, err := st.AuthClient.Register(ctx, generateFakeUsers(1)[0])
+	require.NoError(t, err)
+
+	// roles:manage does not make its holder an admin.
+	for _, target := range []int64{userID, otherResp.GetUserId()} {
+		_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+			Token:  token,
+			AppId:  appID,
+			UserId: target,
+			Role:   "admin",
+		})
+		requireStatus(t, ErrPermissionDenied, err)
+	}
+
+	// Roles within the permissions of the caller can be handed out.
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  token,
+		AppId:  appID,
+		UserId: otherResp.GetUserId(),
+		Role:   createRole(t, ctx, st, appID, "roles:manage"),
+	})
+	require.NoError(t, err)
+}
+
+func TestRoleLookupOfOtherUser(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	users := generateFakeUsers(2)
+
+	callerResp, err := st.AuthClient.Register(ctx, users[0])
+	require.NoError(t, err)
+
+	targetResp, err := st.AuthClient.Register(ctx, users[1])
+	require.NoError(t, err)
+	targetID := targetResp.GetUserId()
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    users[0].Email,
+		Password: users[0].Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	token := loginResp.GetAccessToken()
+
+	_, err = st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		Token:  token,
+		UserId: targetID,
+		AppId:  appID,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+		Token:      token,
+		UserId:     targetID,
+		AppId:      appID,
+		Permission: "roles:manage",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		UserId: targetID,
+		AppId:  appID,
+	})
+	requireStatus(t, status.Error(codes.InvalidArgument, "empty token"), err)
+
+	// Role managers may look up any user of the app.
+	grantRole(t, ctx, st, callerResp.GetUserId(), appID, createRole(t, ctx, st, appID, "roles:manage"))
+
+	rolesResp, err := st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{
+		Token:  token,
+		UserId: targetID,
+		AppId:  appID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, rolesResp.GetRoles())
+
+	permissionResp, err := st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+		Token:      token,
+		UserId:     targetID,
+		AppId:      appID,
+		Permission: "roles:manage",
+	})
+	require.NoError(t, err)
+	assert.False(t, permissionResp.GetAllowed())
+}
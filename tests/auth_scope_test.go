@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"grpc/internal/domain/models"
+	"grpc/internal/lib/jwt"
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidData = status.Error(codes.InvalidArgument, "invalid data")
+
+func TestLoginScope(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+		Scope:    "billing:read",
+	})
+	require.NoError(t, err)
+
+	// A new user has no roles, so nothing of the requested scope is granted.
+	data, err := jwt.DecodeToken(loginResp.GetAccessToken(), jwt.Options{
+		Issuer:    st.Cfg.JWT.Issuer,
+		Audience:  jwt.Audience(appID),
+		ClockSkew: st.Cfg.JWT.ClockSkew,
+	}, jwt.Key{Algorithm: jwt.AlgHS512, Secret: appSecret})
+	require.NoError(t, err)
+	assert.Empty(t, data.Roles)
+	assert.Empty(t, data.Scope)
+	assert.False(t, data.RolesOmitted)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+		Scope: "billing:read billing:write",
+	})
+	requireStatus(t, ErrInvalidData, err)
+
+	refreshResp, err := st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+		Scope: "billing:read",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshResp.GetAccessToken())
+}
+
+func TestLoginScopeWithRoles(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	billing := createRole(t, ctx, st, appID, "billing:read", "billing:write")
+	reports := createRole(t, ctx, st, appID, "reports:read")
+	grantRole(t, ctx, st, registerResp.GetUserId(), appID, billing)
+	grantRole(t, ctx, st, registerResp.GetUserId(), appID, reports)
+
+	// Without a scope every permission of the roles is granted.
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	data := decodeAccessToken(t, st, loginResp.GetAccessToken())
+	assert.ElementsMatch(t, []string{billing, reports}, data.Roles)
+	assert.Equal(t, "billing:read billing:write reports:read", data.Scope)
+
+	// A scope narrows the permissions and the roles to those granting them.
+	loginResp, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+		Scope:    "billing:read users:delete",
+	})
+	require.NoError(t, err)
+
+	data = decodeAccessToken(t, st, loginResp.GetAccessToken())
+	assert.Equal(t, []string{billing}, data.Roles)
+	assert.Equal(t, "billing:read", data.Scope)
+
+	refreshResp, err := st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	data = decodeAccessToken(t, st, refreshResp.GetAccessToken())
+	assert.Equal(t, []string{billing}, data.Roles)
+	assert.Equal(t, "billing:read", data.Scope)
+}
+
+func TestRefreshScopeKeepsPermissions(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	role := createRole(t, ctx, st, appID, "billing:read", "billing:write")
+	grantRole(t, ctx, st, registerResp.GetUserId(), appID, role)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+		Scope:    "openid billing:read",
+	})
+	require.NoError(t, err)
+
+	// Naming no permissions keeps the granted ones instead of widening the
+	// scope to every permission of the role.
+	refreshResp, err := st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+		Scope: "openid",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read", decodeAccessToken(t, st, refreshResp.GetAccessToken()).Scope)
+
+	// The rotated refresh token was saved with the same scope.
+	refreshResp, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: refreshResp.GetRefreshToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read", decodeAccessToken(t, st, refreshResp.GetAccessToken()).Scope)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: refreshResp.GetRefreshToken(),
+		AppId: appID,
+		Scope: "openid billing:write",
+	})
+	requireStatus(t, ErrInvalidData, err)
+}
+
+// createRole creates a role with a random name and the permissions in the
+// app directly in the database and returns its name.
+func createRole(t *testing.T, ctx context.Context, st *suite.Suite, appID int, permissions ...string) string {
+	t.Helper()
+
+	name := "role-" + gofakeit.UUID()
+	_, err := st.DB().Exec(ctx, `
+		WITH role AS (
+			INSERT INTO role (app_id, name) VALUES ($1, $2) RETURNING id
+		)
+		INSERT INTO role_permission (role_id, permission)
+		SELECT role.id, permission FROM role, unnest($3::text[]) AS permission;
+	`, appID, name, permissions)
+	require.NoError(t, err)
+
+	return name
+}
+
+// decodeAccessToken verifies an access token of the test app and returns
+// its claims.
+func decodeAccessToken(t *testing.T, st *suite.Suite, token string) models.Token {
+	t.Helper()
+
+	data, err := jwt.DecodeToken(token, jwt.Options{
+		Issuer:    st.Cfg.JWT.Issuer,
+		Audience:  jwt.Audience(appID),
+		ClockSkew: st.Cfg.JWT.ClockSkew,
+	}, jwt.Key{Algorithm: jwt.AlgHS512, Secret: appSecret})
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"grpc/internal/lib/jwt"
+	"grpc/tests/suite"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidTarget = status.Error(codes.InvalidArgument, "invalid target")
+
+func TestTokenExchange(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+	createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: token,
+		Name:  "orders " + gofakeit.UUID(),
+	})
+	require.NoError(t, err)
+	orders := createResp.GetApp().GetId()
+
+	// The client of the test app may call the orders app, whose client may
+	// call the test app back.
+	frontendID, frontendSecret := createServiceClient(t, ctx, st, token, appID, "", orders)
+	ordersID, ordersSecret := createServiceClient(t, ctx, st, token, orders, "", appID)
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	grantRole(t, ctx, st, registerResp.GetUserId(), int(orders), createRole(t, ctx, st, int(orders), "orders:read", "orders:write"))
+	grantRole(t, ctx, st, registerResp.GetUserId(), appID, createRole(t, ctx, st, appID, "profile:read"))
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	subject := decodeAccessToken(t, st, loginResp.GetAccessToken())
+
+	exchangeResp, err := st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     frontendID,
+		ClientSecret: frontendSecret,
+		SubjectToken: loginResp.GetAccessToken(),
+		Audience:     orders,
+		Scope:        "orders:read",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "orders:read", exchangeResp.GetScope())
+	assert.LessOrEqual(t, exchangeResp.GetExpiresIn(), int64(st.Cfg.TokenExpires.Seconds()))
+	assert.Positive(t, exchangeResp.GetExpiresIn())
+
+	claims, err := jwt.UnverifiedClaims(exchangeResp.GetAccessToken())
+	require.NoError(t, err)
+	assert.Equal(t, []string{jwt.Audience(int(orders))}, []string(claims.Audience))
+	assert.Equal(t, registerResp.GetUserId(), claims.UserID)
+	assert.Equal(t, subject.SessionID, claims.SessionID)
+	assert.Equal(t, "orders:read", claims.Scope)
+	require.NotNil(t, claims.Actor)
+	assert.Equal(t, frontendID, claims.Actor.Subject)
+	assert.Nil(t, claims.Actor.Actor)
+
+	// The orders app verifies the token like its own.
+	introspectResp, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token: exchangeResp.GetAccessToken(),
+		AppId: orders,
+	})
+	require.NoError(t, err)
+	assert.True(t, introspectResp.GetActive())
+	assert.Equal(t, frontendID, introspectResp.GetAct().GetSub())
+
+	// Exchanging it again nests the previous actor.
+	nestedResp, err := st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     ordersID,
+		ClientSecret: ordersSecret,
+		SubjectToken: exchangeResp.GetAccessToken(),
+		Audience:     appID,
+		Scope:        "profile:read",
+	})
+	require.NoError(t, err)
+
+	introspectResp, err = st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{
+		Token: nestedResp.GetAccessToken(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+	assert.True(t, introspectResp.GetActive())
+	assert.Equal(t, "profile:read", introspectResp.GetScope())
+	assert.Equal(t, ordersID, introspectResp.GetAct().GetSub())
+	assert.Equal(t, frontendID, introspectResp.GetAct().GetAct().GetSub())
+
+	// The client may not pick another audience or permissions the user lacks.
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     frontendID,
+		ClientSecret: frontendSecret,
+		SubjectToken: loginResp.GetAccessToken(),
+		Audience:     appID,
+		Scope:        "profile:read",
+	})
+	requireStatus(t, ErrInvalidTarget, err)
+
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     frontendID,
+		ClientSecret: frontendSecret,
+		SubjectToken: loginResp.GetAccessToken(),
+		Audience:     orders,
+		Scope:        "orders:delete",
+	})
+	requireStatus(t, ErrInvalidData, err)
+
+	// An exchanged token does not own the session or the roles of the user.
+	_, err = st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+		Token: exchangeResp.GetAccessToken(),
+		AppId: orders,
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+
+	_, err = st.AuthClient.AssignRole(ctx, &ssov1.AssignRoleRequest{
+		Token:  exchangeResp.GetAccessToken(),
+		AppId:  orders,
+		UserId: registerResp.GetUserId(),
+		Role:   "admin",
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestTokenExchangeValidation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name        string
+		request     *ssov1.TokenExchangeRequest
+		expectedErr error
+	}{
+		{
+			name: "empty subject token",
+			request: &ssov1.TokenExchangeRequest{
+				ClientId:     gofakeit.UUID(),
+				ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+				Audience:     appID,
+				Scope:        "orders:read",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "empty subject token"),
+		},
+		{
+			name: "empty audience",
+			request: &ssov1.TokenExchangeRequest{
+				ClientId:     gofakeit.UUID(),
+				ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+				SubjectToken: gofakeit.UUID(),
+				Scope:        "orders:read",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "empty audience"),
+		},
+		{
+			name: "empty scope",
+			request: &ssov1.TokenExchangeRequest{
+				ClientId:     gofakeit.UUID(),
+				ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+				SubjectToken: gofakeit.UUID(),
+				Audience:     appID,
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "empty scope"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.TokenExchange(ctx, tt.request)
+			requireStatus(t, tt.expectedErr, err)
+		})
+	}
+}
+
+func TestTokenExchangeUnknownClient(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ClientId:     gofakeit.UUID(),
+		ClientSecret: gofakeit.Password(true, true, true, false, false, 32),
+		SubjectToken: loginResp.GetAccessToken(),
+		Audience:     appID,
+		Scope:        "orders:read",
+	})
+	requireStatus(t, ErrInvalidClient, err)
+
+	form := url.Values{
+		"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"client_id":          {gofakeit.UUID()},
+		"client_secret":      {gofakeit.Password(true, true, true, false, false, 32)},
+		"subject_token":      {loginResp.GetAccessToken()},
+		"subject_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"audience":           {strconv.Itoa(appID)},
+		"scope":              {"orders:read"},
+	}
+
+	result := postToken(t, st, http.DefaultClient, form)
+	assert.Equal(t, http.StatusUnauthorized, result.status)
+	assert.Equal(t, "invalid_client", result.Error)
+
+	form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:refresh_token")
+	result = postToken(t, st, http.DefaultClient, form)
+	assert.Equal(t, http.StatusBadRequest, result.status)
+	assert.Equal(t, "invalid_request", result.Error)
+}
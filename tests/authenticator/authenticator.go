@@ -0,0 +1,254 @@
+// Package authenticator is a software WebAuthn authenticator for the tests.
+// It holds one ES256 passkey, always verifies the user and answers the
+// JSON options the server returns like a browser would.
+package authenticator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+
+	algES256 = -7
+
+	credentialIDBytes = 16
+)
+
+var encoding = base64.RawURLEncoding
+
+// Authenticator answers registration and login options with its passkey.
+// Origin is the origin the client data claims, and SignCount the counter
+// of the last signature.
+type Authenticator struct {
+	Origin    string
+	SignCount uint32
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+// Attestation is the response to registration options.
+type Attestation struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response to login options.
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// New returns an authenticator for pages on the origin.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Clone returns an authenticator with the same passkey and counter, as an
+// attacker who copied the key would have.
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	return &clone
+}
+
+// Create creates the passkey for the user and relying party in the
+// creation options.
+func (a *Authenticator) Create(optionsJSON string) (Attestation, error) {
+	var options struct {
+		RP struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Challenge        string `json:"challenge"`
+		PubKeyCredParams []struct {
+			Alg int64 `json:"alg"`
+		} `json:"pubKeyCredParams"`
+	}
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		return Attestation{}, err
+	}
+
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		supported = supported || param.Alg == algES256
+	}
+	if !supported {
+		return Attestation{}, errors.New("ES256 is not allowed")
+	}
+
+	userHandle, err := encoding.DecodeString(options.User.ID)
+	if err != nil {
+		return Attestation{}, fmt.Errorf("user id: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Attestation{}, err
+	}
+	credentialID := make([]byte, credentialIDBytes)
+	if _, err := rand.Read(credentialID); err != nil {
+		return Attestation{}, err
+	}
+
+	a.key = key
+	a.credentialID = credentialID
+	a.userHandle = userHandle
+	a.SignCount = 0
+
+	authData := authenticatorData(options.RP.ID, flagUserPresent|flagUserVerified|flagAttestedData, a.SignCount)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(credentialID)))
+	authData = append(authData, credentialID...)
+	authData = append(authData, a.coseKey()...)
+
+	var object []byte
+	object = appendHead(object, majorMap, 3)
+	object = appendText(object, "fmt")
+	object = appendText(object, "none")
+	object = appendText(object, "attStmt")
+	object = appendHead(object, majorMap, 0)
+	object = appendText(object, "authData")
+	object = appendBytes(object, authData)
+
+	return Attestation{
+		CredentialID:      credentialID,
+		ClientDataJSON:    a.clientData(typeCreate, options.Challenge),
+		AttestationObject: object,
+	}, nil
+}
+
+// Get signs the challenge of the login options with the passkey and
+// increases the sign counter.
+func (a *Authenticator) Get(optionsJSON string) (Assertion, error) {
+	if a.key == nil {
+		return Assertion{}, errors.New("no passkey")
+	}
+
+	var options struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+	}
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		return Assertion{}, err
+	}
+
+	a.SignCount++
+	authData := authenticatorData(options.RPID, flagUserPresent|flagUserVerified, a.SignCount)
+	clientData := a.clientData(typeGet, options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	return Assertion{
+		CredentialID:      a.credentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        a.userHandle,
+	}, nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// coseKey encodes the public key as a COSE_Key: kty EC2, alg ES256, crv
+// P-256 and the coordinates.
+func (a *Authenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	var key []byte
+	key = appendHead(key, majorMap, 5)
+	key = appendInt(key, 1)
+	key = appendInt(key, 2)
+	key = appendInt(key, 3)
+	key = appendInt(key, algES256)
+	key = appendInt(key, -1)
+	key = appendInt(key, 1)
+	key = appendInt(key, -2)
+	key = appendBytes(key, x)
+	key = appendInt(key, -3)
+	key = appendBytes(key, y)
+	return key
+}
+
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// The CBOR encoding of RFC 8949, limited to what attestation objects and
+// COSE keys use.
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorMap      = 5
+)
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, majorNegative, uint64(-1-n))
+	}
+	return appendHead(b, majorUnsigned, uint64(n))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(data))), data...)
+}
+
+func appendText(b []byte, text string) []byte {
+	return append(appendHead(b, majorText, uint64(len(text))), text...)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	ssojwt "grpc/internal/lib/jwt"
+	"grpc/tests/suite"
+	"math/big"
+	"net/http"
+	"strconv"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSVerifiesAsymmetricTokens(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		t.Run(alg, func(t *testing.T) {
+			createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+				Token:      token,
+				Name:       alg + " " + gofakeit.UUID(),
+				SigningAlg: alg,
+			})
+			require.NoError(t, err)
+			app := createResp.GetApp()
+			require.Equal(t, alg, app.GetSigningAlg())
+
+			user := generateFakeUsers(1)[0]
+			registerResp, err := st.AuthClient.Register(ctx, user)
+			require.NoError(t, err)
+
+			loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+				Email:    user.Email,
+				Password: user.Password,
+				AppId:    app.GetId(),
+			})
+			require.NoError(t, err)
+
+			jwks := fetchJWKS(t, st, int(app.GetId()))
+
+			parsed, err := jwt.Parse(loginResp.GetAccessToken(), func(token *jwt.Token) (any, error) {
+				kid, _ := token.Header["kid"].(string)
+				for _, key := range jwks.Keys {
+					if key.Kid == kid {
+						return publicKey(key)
+					}
+				}
+				return nil, fmt.Errorf("no key with kid %q", kid)
+			}, jwt.WithValidMethods([]string{alg}))
+			require.NoError(t, err)
+
+			subject, err := parsed.Claims.GetSubject()
+			require.NoError(t, err)
+			assert.Equal(t, strconv.FormatInt(registerResp.GetUserId(), 10), subject)
+
+			for _, key := range jwks.Keys {
+				assert.Equal(t, alg, key.Alg)
+				assert.Equal(t, "sig", key.Use)
+			}
+		})
+	}
+}
+
+func TestJWKSUnknownApp(t *testing.T) {
+	_, st := suite.New(t)
+
+	resp, err := http.Get(st.HTTPURL("/apps/2147483647/.well-known/jwks.json"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func fetchJWKS(t *testing.T, st *suite.Suite, appID int) ssojwt.JWKS {
+	t.Helper()
+
+	resp, err := http.Get(st.HTTPURL("/apps/" + strconv.Itoa(appID) + "/.well-known/jwks.json"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jwks ssojwt.JWKS
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&jwks))
+	require.NotEmpty(t, jwks.Keys)
+
+	return jwks
+}
+
+// publicKey builds the public key of a JWK.
+func publicKey(key ssojwt.JWK) (any, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+func TestSeededKeysRetired(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// The secrets the admin app was once seeded with are public.
+	var count int
+	require.NoError(t, st.DB().QueryRow(ctx, `
+		SELECT count(*) FROM app_key
+		WHERE secret IN ('iYDFTuUHLIKyhads879fasyodfIRTUYDF', 'fgsuyTERTCV7812RDCfasdTYFK78ghjlBuygsd78gliueBN')
+			AND status <> 'retired';
+	`).Scan(&count))
+	assert.Zero(t, count)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"grpc/tests/suite"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The templates used here are in testdata/mail_templates.
+func TestMailTemplates(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// A locale with a region falls back to its language.
+	user := generateFakeUsers(1)[0]
+	user.Locale = "de_AT"
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	body := lastMail(t, st, user.GetEmail(), "Bestätige deine E-Mail-Adresse")
+	assert.Contains(t, body, "Hallo "+user.GetName())
+	match := tokenParam.FindStringSubmatch(body)
+	require.NotNil(t, match)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: match[1]})
+	require.NoError(t, err)
+
+	// The test app has its own French template.
+	user = generateFakeUsers(1)[0]
+	user.AppId = appID
+	user.Locale = "fr"
+	_, err = st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	body = lastMail(t, st, user.GetEmail(), "Confirme ton adresse e-mail pour test app")
+	assert.Contains(t, body, "Bienvenue sur test app !")
+	assert.Regexp(t, tokenParam, body)
+
+	// Other apps get the built-in template.
+	user = generateFakeUsers(1)[0]
+	user.AppId = createApp(t, ctx, st, adminToken(t, ctx, st), false)
+	user.Locale = "fr"
+	_, err = st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	body = lastMail(t, st, user.GetEmail(), verificationSubject)
+	assert.Contains(t, body, "Hi "+user.GetName())
+}
+
+func TestMailUnknownApp(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	user.AppId = 1 << 30
+	_, err := st.AuthClient.Register(ctx, user)
+	requireStatus(t, ErrInvalidData, err)
+
+	_, err = st.AuthClient.SendVerificationEmail(ctx, &ssov1.SendVerificationEmailRequest{
+		Email: user.GetEmail(),
+		AppId: user.GetAppId(),
+	})
+	requireStatus(t, ErrInvalidData, err)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{
+		Email: user.GetEmail(),
+		AppId: user.GetAppId(),
+	})
+	requireStatus(t, ErrInvalidData, err)
+}
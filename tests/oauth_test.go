@@ -0,0 +1,273 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"grpc/tests/suite"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const redirectURI = "http://localhost:3000/callback"
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	Error        string `json:"error"`
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	ctx, st := suite.New(t)
+	client := noRedirectClient()
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	verifier := gofakeit.Password(true, true, true, false, false, 64)
+	state := gofakeit.UUID()
+	params := authorizeParams(verifier, state)
+
+	resp, err := client.Get(st.HTTPURL("/authorize?" + params.Encode()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+
+	code := authorize(t, st, client, params, user)
+
+	tokens := exchangeCode(t, st, client, code, verifier)
+	assert.Equal(t, http.StatusOK, tokens.status)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, int64(st.Cfg.TokenExpires.Seconds()), tokens.ExpiresIn)
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: tokens.AccessToken,
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	refreshed := postToken(t, st, client, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {strconv.Itoa(appID)},
+		"refresh_token": {tokens.RefreshToken},
+	})
+	assert.Equal(t, http.StatusOK, refreshed.status)
+	assert.NotEmpty(t, refreshed.AccessToken)
+
+	// Replaying the code fails and ends the session started with it.
+	replayed := exchangeCode(t, st, client, code, verifier)
+	assert.Equal(t, http.StatusBadRequest, replayed.status)
+	assert.Equal(t, "invalid_grant", replayed.Error)
+
+	_, err = st.AuthClient.CurrentUser(ctx, &ssov1.CurrentUserRequest{
+		Token: refreshed.AccessToken,
+		AppId: appID,
+	})
+	requireStatus(t, ErrUnauthorized, err)
+}
+
+func TestSetRedirectURIs(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := adminToken(t, ctx, st)
+
+	createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: token,
+		Name:  "redirect " + gofakeit.UUID(),
+	})
+	require.NoError(t, err)
+	id := createResp.GetApp().GetId()
+
+	uris := []string{
+		"https://example.com/callback",
+		"http://127.0.0.1:8000/callback",
+		"com.example.sso:/callback",
+	}
+	setResp, err := st.AppsClient.SetRedirectURIs(ctx, &ssov1.SetRedirectURIsRequest{
+		Token:        token,
+		AppId:        id,
+		RedirectUris: uris,
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, uris, setResp.GetRedirectUris())
+
+	for _, uri := range []string{
+		"javascript:alert(document.cookie)",
+		"data:text/html,<script>alert(1)</script>",
+		"file:///etc/passwd",
+		"http://example.com/callback",
+		"com.example.other:/callback",
+	} {
+		_, err := st.AppsClient.SetRedirectURIs(ctx, &ssov1.SetRedirectURIsRequest{
+			Token:        token,
+			AppId:        id,
+			RedirectUris: []string{uri},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), uri)
+	}
+
+	user := generateFakeUsers(1)[0]
+	_, err = st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    int32(st.Cfg.Apps.AdminAppID),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AppsClient.SetRedirectURIs(ctx, &ssov1.SetRedirectURIsRequest{
+		Token:        loginResp.GetAccessToken(),
+		AppId:        id,
+		RedirectUris: []string{"https://evil.example.com/callback"},
+	})
+	requireStatus(t, ErrPermissionDenied, err)
+}
+
+func TestOAuthInvalidCodeVerifier(t *testing.T) {
+	ctx, st := suite.New(t)
+	client := noRedirectClient()
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	verifier := gofakeit.Password(true, true, true, false, false, 64)
+	code := authorize(t, st, client, authorizeParams(verifier, ""), user)
+
+	tokens := exchangeCode(t, st, client, code, gofakeit.Password(true, true, true, false, false, 64))
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "invalid_grant", tokens.Error)
+}
+
+func TestOAuthUnregisteredRedirectURI(t *testing.T) {
+	_, st := suite.New(t)
+	client := noRedirectClient()
+
+	params := authorizeParams(gofakeit.Password(true, true, true, false, false, 64), "")
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+
+	resp, err := client.Get(st.HTTPURL("/authorize?" + params.Encode()))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+}
+
+func TestOAuthMissingCodeChallenge(t *testing.T) {
+	_, st := suite.New(t)
+	client := noRedirectClient()
+
+	params := authorizeParams("", "")
+	params.Del("code_challenge")
+
+	resp, err := client.Get(st.HTTPURL("/authorize?" + params.Encode()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "invalid_request", location.Query().Get("error"))
+}
+
+type tokenResult struct {
+	oauthTokenResponse
+	status int
+}
+
+func noRedirectClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func authorizeParams(verifier string, state string) url.Values {
+	sum := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {strconv.Itoa(appID)},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return params
+}
+
+// authorize submits the login page and returns the code from the redirect.
+func authorize(t *testing.T, st *suite.Suite, client *http.Client, params url.Values, user *ssov1.RegisterRequest) string {
+	t.Helper()
+
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	form.Set("email", user.GetEmail())
+	form.Set("password", user.GetPassword())
+
+	resp, err := client.PostForm(st.HTTPURL("/authorize"), form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location.String(), redirectURI))
+	assert.Equal(t, params.Get("state"), location.Query().Get("state"))
+
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	return code
+}
+
+func exchangeCode(t *testing.T, st *suite.Suite, client *http.Client, code string, verifier string) tokenResult {
+	t.Helper()
+
+	return postToken(t, st, client, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {strconv.Itoa(appID)},
+		"redirect_uri":  {redirectURI},
+		"code":          {code},
+		"code_verifier": {verifier},
+	})
+}
+
+func postToken(t *testing.T, st *suite.Suite, client *http.Client, form url.Values) tokenResult {
+	t.Helper()
+
+	resp, err := client.PostForm(st.HTTPURL("/token"), form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result tokenResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result.oauthTokenResponse))
+	result.status = resp.StatusCode
+
+	return result
+}
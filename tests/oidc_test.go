@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"encoding/json"
+	"grpc/internal/domain/models"
+	"grpc/tests/suite"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCDiscovery(t *testing.T) {
+	_, st := suite.New(t)
+
+	resp, err := http.Get(st.HTTPURL("/.well-known/openid-configuration"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var config map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&config))
+
+	assert.Equal(t, st.Cfg.JWT.Issuer, config["issuer"])
+	assert.Equal(t, st.Cfg.JWT.Issuer+"/authorize", config["authorization_endpoint"])
+	assert.Equal(t, st.Cfg.JWT.Issuer+"/token", config["token_endpoint"])
+	assert.Equal(t, st.Cfg.JWT.Issuer+"/userinfo", config["userinfo_endpoint"])
+	assert.Equal(t, st.Cfg.JWT.Issuer+"/.well-known/jwks.json", config["jwks_uri"])
+}
+
+func TestOIDCAuthorizationCode(t *testing.T) {
+	ctx, st := suite.New(t)
+	client := noRedirectClient()
+
+	user := generateFakeUsers(1)[0]
+	registerResp, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	verifier := gofakeit.Password(true, true, true, false, false, 64)
+	nonce := gofakeit.UUID()
+	params := authorizeParams(verifier, "")
+	params.Set("scope", "openid profile email")
+	params.Set("nonce", nonce)
+
+	loginTime := time.Now()
+	code := authorize(t, st, client, params, user)
+	tokens := exchangeCode(t, st, client, code, verifier)
+	require.Equal(t, http.StatusOK, tokens.status)
+	require.NotEmpty(t, tokens.IDToken)
+
+	claims := decodeIDToken(t, st, tokens.IDToken)
+	assert.Equal(t, strconv.FormatInt(registerResp.GetUserId(), 10), claims.Subject)
+	assert.Equal(t, nonce, claims.Nonce)
+	assert.Equal(t, user.GetName(), claims.Name)
+	assert.Equal(t, user.GetEmail(), claims.Email)
+	require.NotNil(t, claims.AuthTime)
+	assert.InDelta(t, loginTime.Unix(), claims.AuthTime.Unix(), 2.0)
+
+	req, err := http.NewRequest(http.MethodGet, st.HTTPURL("/userinfo"), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info models.UserInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, claims.Subject, info.Subject)
+	assert.Equal(t, user.GetName(), info.Name)
+	assert.Equal(t, user.GetEmail(), info.Email)
+}
+
+func TestOIDCLoginWithoutOpenIDScope(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	user := generateFakeUsers(1)[0]
+	_, err := st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, loginResp.GetIdToken())
+
+	refreshResp, err := st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: appID,
+		Scope: "openid",
+	})
+	requireStatus(t, ErrInvalidData, err)
+	assert.Empty(t, refreshResp.GetIdToken())
+}
+
+func TestUserInfoInvalidToken(t *testing.T) {
+	_, st := suite.New(t)
+
+	req, err := http.NewRequest(http.MethodGet, st.HTTPURL("/userinfo"), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+gofakeit.UUID())
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "invalid_token")
+}
+
+func decodeIDToken(t *testing.T, st *suite.Suite, token string) models.IDToken {
+	t.Helper()
+
+	var claims models.IDToken
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return []byte(appSecret), nil
+	},
+		jwt.WithValidMethods([]string{"HS512"}),
+		jwt.WithIssuer(st.Cfg.JWT.Issuer),
+		jwt.WithAudience(strconv.Itoa(appID)),
+		jwt.WithExpirationRequired(),
+	)
+	require.NoError(t, err)
+
+	return claims
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc/internal/config"
+	"grpc/internal/database/outbox"
+	"grpc/internal/domain/models"
+	mailservice "grpc/internal/services/mail"
+	"grpc/tests/suite"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRollback(t *testing.T) {
+	ctx, st := suite.New(t)
+	db, pool := outboxDB(t, ctx, st)
+
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Add(ctx, tx, testOutboxMail()))
+	require.NoError(t, tx.Rollback(ctx))
+
+	mails, err := db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, mails)
+
+	queueMail(t, ctx, pool)
+
+	mails, err = db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, mails, 1)
+}
+
+func TestOutboxClaimLease(t *testing.T) {
+	ctx, st := suite.New(t)
+	db, pool := outboxDB(t, ctx, st)
+
+	mail := queueMail(t, ctx, pool)
+
+	mails, err := db.ClaimMail(ctx, 10, 500*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, mails, 1)
+	assert.Equal(t, mail, mails[0].Mail)
+	assert.Equal(t, 1, mails[0].Attempts)
+
+	// The mail is left to its sender for the lease.
+	mails, err = db.ClaimMail(ctx, 10, 500*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, mails)
+
+	// A sender that died does not keep it.
+	require.Eventually(t, func() bool {
+		mails, err = db.ClaimMail(ctx, 10, time.Minute)
+		return err == nil && len(mails) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 2, mails[0].Attempts)
+}
+
+func TestOutboxClaimSkipsLocked(t *testing.T) {
+	ctx, st := suite.New(t)
+	db, pool := outboxDB(t, ctx, st)
+
+	queueMail(t, ctx, pool)
+	queueMail(t, ctx, pool)
+
+	// Another instance is claiming the first mail.
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	var locked int64
+	require.NoError(t, tx.QueryRow(ctx, `SELECT id FROM mail_outbox ORDER BY id LIMIT 1 FOR UPDATE;`).Scan(&locked))
+
+	claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	mails, err := db.ClaimMail(claimCtx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, mails, 1)
+	assert.NotEqual(t, locked, mails[0].ID)
+
+	require.NoError(t, tx.Rollback(ctx))
+
+	mails, err = db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, mails, 1)
+	assert.Equal(t, locked, mails[0].ID)
+}
+
+func TestOutboxRetryMail(t *testing.T) {
+	ctx, st := suite.New(t)
+	db, pool := outboxDB(t, ctx, st)
+
+	queueMail(t, ctx, pool)
+
+	mails, err := db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, mails, 1)
+	id := mails[0].ID
+
+	require.NoError(t, db.RetryMail(ctx, id, "421 try again later", 0))
+
+	mails, err = db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, mails, 1)
+	assert.Equal(t, 2, mails[0].Attempts)
+
+	var lastError string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT last_error FROM mail_outbox WHERE id = $1;`, id).Scan(&lastError))
+	assert.Equal(t, "421 try again later", lastError)
+
+	require.NoError(t, db.RetryMail(ctx, id, "421 try again later", time.Hour))
+
+	mails, err = db.ClaimMail(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, mails)
+}
+
+func TestOutboxFailMail(t *testing.T) {
+	ctx, st := suite.New(t)
+	db, pool := outboxDB(t, ctx, st)
+
+	queueMail(t, ctx, pool)
+
+	mailer := &failingMailer{}
+	service := mailservice.NewMailService(discardLogger(), db, mailer, config.OutboxConfig{
+		BatchSize:   10,
+		MaxAttempts: 2,
+		Lease:       time.Minute,
+	})
+
+	// The first attempt is retried at once, the second is the last.
+	require.NoError(t, service.DeliverMail(ctx))
+	require.NoError(t, service.DeliverMail(ctx))
+	require.NoError(t, service.DeliverMail(ctx))
+	assert.Equal(t, 2, mailer.calls)
+
+	var (
+		attempts  int
+		lastError string
+		textBody  string
+		failed    bool
+	)
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT attempts, last_error, text_body, failed_at IS NOT NULL FROM mail_outbox;
+	`).Scan(&attempts, &lastError, &textBody, &failed))
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, errMailboxUnavailable.Error(), lastError)
+	assert.Empty(t, textBody)
+	assert.True(t, failed)
+}
+
+var errMailboxUnavailable = errors.New("550 mailbox unavailable")
+
+// failingMailer fails to send every mail.
+type failingMailer struct {
+	calls int
+}
+
+func (f *failingMailer) Send(ctx context.Context, mail models.Mail) error {
+	f.calls++
+	return errMailboxUnavailable
+}
+
+// outboxDB returns an OutboxDB on a mail outbox of its own, in a schema
+// dropped after the test, so that the outbox of the server does not deliver
+// the mail of the test.
+func outboxDB(t *testing.T, ctx context.Context, st *suite.Suite) (*outbox.OutboxDB, *pgxpool.Pool) {
+	t.Helper()
+
+	schema := "outbox_test_" + strings.ReplaceAll(gofakeit.UUID(), "-", "")
+	_, err := st.DB().Exec(ctx, fmt.Sprintf(`CREATE SCHEMA %s;`, schema))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := st.DB().Exec(context.Background(), fmt.Sprintf(`DROP SCHEMA %s CASCADE;`, schema))
+		require.NoError(t, err)
+	})
+	_, err = st.DB().Exec(ctx, fmt.Sprintf(`CREATE TABLE %s.mail_outbox (LIKE public.mail_outbox INCLUDING ALL);`, schema))
+	require.NoError(t, err)
+
+	cfg := st.DB().Config()
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return outbox.NewOutboxDB(pool, discardLogger()), pool
+}
+
+// queueMail puts a mail into the outbox in a transaction of its own.
+func queueMail(t *testing.T, ctx context.Context, pool *pgxpool.Pool) models.Mail {
+	t.Helper()
+
+	mail := testOutboxMail()
+
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, outbox.Add(ctx, tx, mail))
+	require.NoError(t, tx.Commit(ctx))
+
+	return mail
+}
+
+func testOutboxMail() models.Mail {
+	return models.Mail{
+		To:      gofakeit.Email(),
+		Subject: gofakeit.Sentence(3),
+		Text:    gofakeit.Sentence(10),
+		HTML:    "<p>" + gofakeit.Sentence(10) + "</p>",
+	}
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
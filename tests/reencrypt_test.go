@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	appdb "grpc/internal/database/app"
+	"grpc/internal/lib/envelope"
+	"grpc/internal/lib/jwt"
+	"grpc/tests/suite"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/bordviz/sso-protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReencryptAppKeys(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	if st.Cfg.Encryption.Keys == "" {
+		t.Skip("no encryption key configured, set ENCRYPTION_KEYS for the server and the tests")
+	}
+
+	// The master key of the server and one it was rotated from.
+	current, err := envelope.NewLocalProvider(st.Cfg.Encryption.Keys)
+	require.NoError(t, err)
+	masterKey := make([]byte, 32)
+	_, err = rand.Read(masterKey)
+	require.NoError(t, err)
+	previousKey := "previous:" + base64.StdEncoding.EncodeToString(masterKey)
+	previous, err := envelope.NewLocalProvider(previousKey)
+	require.NoError(t, err)
+	rotated, err := envelope.NewLocalProvider(st.Cfg.Encryption.Keys + "," + previousKey)
+	require.NoError(t, err)
+
+	createResp, err := st.AppsClient.CreateApp(ctx, &ssov1.CreateAppRequest{
+		Token: adminToken(t, ctx, st),
+		Name:  "reencrypt " + gofakeit.UUID(),
+	})
+	require.NoError(t, err)
+	app := createResp.GetApp()
+
+	var kid, refreshKid string
+	require.NoError(t, st.DB().QueryRow(ctx, `
+		SELECT
+			(SELECT id FROM app_key WHERE app_id = $1 AND kind = 'access'),
+			(SELECT id FROM app_key WHERE app_id = $1 AND kind = 'refresh');
+	`, app.GetId()).Scan(&kid, &refreshKid))
+
+	// The access key is stored under the previous master key and the
+	// refresh key in plaintext, as before encryption was enabled.
+	underPrevious, err := envelope.New(previous).Encrypt(ctx, createResp.GetSecret())
+	require.NoError(t, err)
+	_, err = st.DB().Exec(ctx, `UPDATE app_key SET secret = $2 WHERE id = $1;`, kid, underPrevious)
+	require.NoError(t, err)
+
+	var refreshSecret string
+	require.NoError(t, st.DB().QueryRow(ctx, `SELECT secret FROM app_key WHERE id = $1;`, refreshKid).Scan(&refreshSecret))
+	refreshSecret, err = envelope.New(current).Decrypt(ctx, refreshSecret)
+	require.NoError(t, err)
+	_, err = st.DB().Exec(ctx, `UPDATE app_key SET secret = $2 WHERE id = $1;`, refreshKid, refreshSecret)
+	require.NoError(t, err)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	count, err := appdb.NewAppDB(st.DB(), log, envelope.New(rotated)).ReencryptAppKeys(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 2)
+
+	for _, id := range []string{kid, refreshKid} {
+		var value string
+		require.NoError(t, st.DB().QueryRow(ctx, `SELECT secret FROM app_key WHERE id = $1;`, id).Scan(&value))
+		assert.True(t, strings.HasPrefix(value, "enc:v1:"+current.KeyID()+":"), id)
+	}
+
+	// The server reads the keys with its own master key again.
+	user := generateFakeUsers(1)[0]
+	_, err = st.AuthClient.Register(ctx, user)
+	require.NoError(t, err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+		AppId:    app.GetId(),
+	})
+	require.NoError(t, err)
+
+	_, err = jwt.DecodeToken(loginResp.GetAccessToken(), jwt.Options{
+		Issuer:   st.Cfg.JWT.Issuer,
+		Audience: jwt.Audience(int(app.GetId())),
+	}, jwt.Key{Algorithm: jwt.AlgHS512, Secret: createResp.GetSecret()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RefreshToken(ctx, &ssov1.RefreshTokenRequest{
+		Token: loginResp.GetRefreshToken(),
+		AppId: app.GetId(),
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// AppID is the app the tests sign in to. It is the admin app as well.
+	AppID = 1
+	// AppSecret and AppRefreshSecret are the secrets the test app signs
+	// access and refresh tokens with.
+	AppSecret        = "gKh7iEz2rq0NlaJB1LbvzDUq08BfUqS0"
+	AppRefreshSecret = "sIDGnwbOH9R2G9ngaJLRcoTzOhFLhFPvQ5JHWIjpQkFFYi"
+)
+
+// fixtures are the rows the tests rely on that the migrations do not
+// create, since they must not exist outside of tests. They make the admin
+// app the test app: it gets its name, a redirect URI and keys with secrets
+// the tests know, which take over from the keys the key rotator created.
+const fixtures = `
+	UPDATE app SET name = 'test app' WHERE id = 1;
+
+	INSERT INTO app_key (id, app_id, kind, algorithm, secret) VALUES
+		('test-app-access', 1, 'access', 'HS512', '` + AppSecret + `'),
+		('test-app-refresh', 1, 'refresh', 'HS512', '` + AppRefreshSecret + `')
+	ON CONFLICT (id) DO UPDATE SET
+		secret = EXCLUDED.secret,
+		status = 'active',
+		activates_at = now(),
+		deactivated_at = NULL;
+
+	INSERT INTO app_redirect_uri (app_id, uri) VALUES (1, 'http://localhost:3000/callback')
+	ON CONFLICT DO NOTHING;
+`
+
+var (
+	dbOnce sync.Once
+	dbPool *pgxpool.Pool
+	dbErr  error
+)
+
+// DB returns a connection pool to the database of the server, shared by all
+// tests. Tests use it to set up what the API cannot, such as admin roles.
+func (s *Suite) DB() *pgxpool.Pool {
+	s.Helper()
+
+	dbOnce.Do(func() {
+		cfg := s.Cfg.Database
+		dsn := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=%s",
+			cfg.User,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.Name,
+			cfg.SSLMode,
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		dbPool, dbErr = pgxpool.New(ctx, dsn)
+		if dbErr != nil {
+			return
+		}
+		_, dbErr = dbPool.Exec(ctx, fixtures)
+	})
+	if dbErr != nil {
+		s.Fatalf("database connection error: %v", dbErr)
+	}
+
+	return dbPool
+}
@@ -16,9 +16,13 @@ type Suite struct {
 	*testing.T
 	Cfg        *config.Config
 	AuthClient ssov1.AuthClient
+	AppsClient ssov1.AppsClient
 }
 
-const gRPCHost = "localhost"
+const (
+	gRPCHost = "localhost"
+	httpHost = "localhost"
+)
 
 func New(t *testing.T) (context.Context, *Suite) {
 	t.Helper()
@@ -40,13 +44,24 @@ func New(t *testing.T) (context.Context, *Suite) {
 		t.Fatalf("gRPC server connection error: %v", err)
 	}
 
-	return ctx, &Suite{
+	s := &Suite{
 		T:          t,
 		Cfg:        cfg,
 		AuthClient: ssov1.NewAuthClient(cc),
+		AppsClient: ssov1.NewAppsClient(cc),
 	}
+
+	// Connecting loads the fixtures before the first test runs.
+	s.DB()
+
+	return ctx, s
 }
 
 func gRPCAddress(cfg *config.Config) string {
 	return net.JoinHostPort(gRPCHost, strconv.Itoa(cfg.GRPC.Port))
 }
+
+// HTTPURL returns the URL of a path on the HTTP server.
+func (s *Suite) HTTPURL(path string) string {
+	return "http://" + net.JoinHostPort(httpHost, strconv.Itoa(s.Cfg.HTTP.Port)) + path
+}